@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/clairitydev/cora/internal/filter"
+)
+
+// maxBaselineDelta caps the new omissions listed when a baseline check fails
+const maxBaselineDelta = 20
+
+// loadBaseline reads the filter baseline at path, or returns nil if no
+// baseline was given. It is loaded before filtering so a bad path fails fast.
+func loadBaseline(path string) (*filter.Baseline, error) {
+	if path == "" {
+		return nil, nil
+	}
+	return filter.LoadBaseline(path)
+}
+
+// checkBaseline compares a filter result with the baseline loaded from path.
+// Omissions the baseline does not have fail the command, or are printed as a
+// warning if warnOnly is set.
+func checkBaseline(baseline *filter.Baseline, path string, warnOnly bool, result *filter.FilterResult) error {
+	if baseline == nil {
+		return nil
+	}
+
+	added, resolved := baseline.Diff(result)
+	if len(resolved) > 0 {
+		LogVerbose("ℹ️  %d baseline omissions no longer occur; regenerate %s to drop them", len(resolved), path)
+	}
+	if len(added) == 0 {
+		LogVerbose("✅ No new sensitive omissions compared to %s", path)
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d new sensitive omissions not in %s:", len(added), path)
+	for i, o := range added {
+		if i >= maxBaselineDelta {
+			fmt.Fprintf(&b, "\n   ... and %d more", len(added)-maxBaselineDelta)
+			break
+		}
+		fmt.Fprintf(&b, "\n   🆕 %s\n      %s", o.Path, o.Reason)
+	}
+	b.WriteString("\n\nReview them, then regenerate the baseline with 'cora filter --write-baseline " + path + "'")
+
+	if warnOnly {
+		fmt.Fprintf(os.Stderr, "⚠️  %s\n", b.String())
+		return nil
+	}
+	return fmt.Errorf("⛔ %s", b.String())
+}
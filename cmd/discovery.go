@@ -8,6 +8,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/clairitydev/cora/internal/filter"
 )
 
 // CoraServiceDiscovery represents the service discovery document from .well-known/cora.json
@@ -48,6 +50,19 @@ type SensitiveFilteringConfig struct {
 	Enforced                 bool     `json:"enforced"`
 	AdditionalOmitTypes      []string `json:"additionalOmitTypes"`
 	AdditionalOmitAttributes []string `json:"additionalOmitAttributes"`
+	HonorTerraformSensitive  *bool    `json:"honorTerraformSensitive,omitempty"` // Mandated value, if set
+	OmitDataSources          *bool    `json:"omitDataSources,omitempty"`         // Mandated value, if set
+}
+
+// PlatformSettings converts the discovery settings for the filter package
+func (s SensitiveFilteringConfig) PlatformSettings() filter.PlatformSettings {
+	return filter.PlatformSettings{
+		OmitResourceTypes:       s.AdditionalOmitTypes,
+		OmitAttributes:          s.AdditionalOmitAttributes,
+		Enforced:                s.Enforced,
+		HonorTerraformSensitive: s.HonorTerraformSensitive,
+		OmitDataSources:         s.OmitDataSources,
+	}
 }
 
 // Default endpoints (fallback if discovery fails)
@@ -161,6 +176,12 @@ func FetchServiceDiscovery(baseURL, token string) (*CoraServiceDiscovery, error)
 	if len(discovery.Features.SensitiveFiltering.AdditionalOmitAttributes) > 0 {
 		LogVerbose("   Organization omit attributes: %v", discovery.Features.SensitiveFiltering.AdditionalOmitAttributes)
 	}
+	if v := discovery.Features.SensitiveFiltering.HonorTerraformSensitive; v != nil {
+		LogVerbose("   Organization requires honor_terraform_sensitive: %v", *v)
+	}
+	if v := discovery.Features.SensitiveFiltering.OmitDataSources; v != nil {
+		LogVerbose("   Organization requires omit_data_sources: %v", *v)
+	}
 
 	// Cache the result
 	discoveryMutex.Lock()
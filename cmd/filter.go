@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/clairitydev/cora/internal/filter"
+	"github.com/spf13/cobra"
+)
+
+var filterCmd = &cobra.Command{
+	Use:   "filter",
+	Short: "Filter sensitive data from Terraform state or plan JSON",
+	Long: `Filter applies the sensitive data filter to Terraform state or plan JSON
+and writes the result, without uploading anything.
+
+The input can be provided via stdin (pipe) or from a file. The filtered JSON
+is written to stdout unless --output is given, and the omission report is
+written to stderr unless --report names a JSON file to write it to.
+
+The filter uses the local .cora.yaml policy. Organization settings are not
+fetched, so nothing is sent to Cora.
+
+Examples:
+  # Filter state before sending it elsewhere
+  terraform show -json | cora filter > state.filtered.json
+
+  # Filter a plan file, with the report in a sidecar file
+  cora filter --plan -f plan.json -o plan.filtered.json --report plan.report.json
+
+  # Trace why an attribute was kept or omitted
+  cora filter -f state.json --explain 'aws_db_instance.main.password'
+
+  # Record the current omissions as the baseline for --filter-baseline
+  terraform show -json | cora filter -o /dev/null --write-baseline .cora-filter-baseline.json`,
+	RunE: runFilter,
+}
+
+var (
+	filterPlan       bool
+	filterState      bool
+	filterInputFile  string
+	filterOutputFile string
+	filterReportFile string
+	filterReportFmt  string
+	filterCmdWorkers int
+
+	filterBaseline       string
+	filterBaselineWarn   bool
+	filterProviderSchema string
+	filterWriteBaseline  string
+	filterExplain        []string
+)
+
+func init() {
+	rootCmd.AddCommand(filterCmd)
+	filterCmd.Flags().BoolVar(&filterPlan, "plan", false, "Treat the input as a Terraform plan (default: detected)")
+	filterCmd.Flags().BoolVar(&filterState, "state", false, "Treat the input as Terraform state (default: detected)")
+	filterCmd.Flags().StringVarP(&filterInputFile, "file", "f", "", "Path to Terraform JSON file (reads from stdin if not provided)")
+	filterCmd.Flags().StringVarP(&filterOutputFile, "output", "o", "", "Path to write the filtered JSON to (default: stdout)")
+	filterCmd.Flags().StringVar(&filterReportFile, "report", "", "Path to write the omission report to as JSON (default: text on stderr)")
+	filterCmd.Flags().StringVar(&filterReportFmt, "report-format", "", "Report format: text, json, sarif, markdown or junit (default: text on stderr, json for --report)")
+	filterCmd.Flags().IntVar(&filterCmdWorkers, "filter-workers", 0, "Number of resources to filter in parallel (default: number of CPUs)")
+	filterCmd.Flags().StringVar(&filterBaseline, "baseline", "", "Fail if filtering omits anything not in this baseline file")
+	filterCmd.Flags().BoolVar(&filterBaselineWarn, "baseline-warn", false, "Warn about omissions missing from the baseline instead of failing")
+	filterCmd.Flags().StringVar(&filterProviderSchema, "provider-schema", "", providerSchemaUsage)
+	filterCmd.Flags().StringVar(&filterWriteBaseline, "write-baseline", "", "Write the omissions to a baseline file (e.g. .cora-filter-baseline.json)")
+	filterCmd.Flags().StringArrayVar(&filterExplain, "explain", nil, "Explain why an address or attribute is kept or omitted instead of writing output (repeatable)")
+	filterCmd.MarkFlagsMutuallyExclusive("plan", "state")
+}
+
+func runFilter(cmd *cobra.Command, args []string) error {
+	input, closeInput, err := openInput(filterInputFile, "json", "terraform show -json | cora filter")
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	if inputSize(input) == 0 {
+		return fmt.Errorf("empty input provided")
+	}
+
+	doc, err := filter.NewDocument(input)
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	kind, err := filterInputKind(doc)
+	if err != nil {
+		return err
+	}
+
+	reportFormat := filter.OutputFormatText
+	if filterReportFile != "" {
+		reportFormat = filter.OutputFormatJSON
+	}
+	if filterReportFmt != "" {
+		if reportFormat, err = filter.ParseOutputFormat(filterReportFmt); err != nil {
+			return err
+		}
+	}
+
+	baseline, err := loadBaseline(filterBaseline)
+	if err != nil {
+		return err
+	}
+
+	providerSchema, err := loadProviderSchema(filterProviderSchema)
+	if err != nil {
+		return err
+	}
+
+	// Load filter configuration
+	// An invalid .cora.yaml is an error: output filtered under other rules
+	// than configured would look right but not be
+	filterConfig, configSource, err := filter.GetMergedConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load filter config: %w", err)
+	}
+	LogVerbose("🔒 Filter config source: %s", configSource)
+	filterConfig.Workers = filterCmdWorkers
+	filterConfig.ProviderSchema = providerSchema
+	filterConfig.InputPath = filterInputFile
+
+	run := func(w io.Writer) (*filter.FilterResult, error) {
+		if kind == "plan" {
+			return filter.FilterPlanStream(doc, w, filterConfig)
+		}
+		return filter.FilterStream(doc, w, filterConfig)
+	}
+
+	if len(filterExplain) > 0 {
+		return runExplain(kind, run, filterConfig, reportFormat)
+	}
+
+	// Open the output before filtering, so a bad path fails fast. It is
+	// removed again if filtering fails, rather than left half written.
+	var out io.Writer = os.Stdout
+	written := false
+	if filterOutputFile != "" {
+		f, err := os.Create(filterOutputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer func() {
+			f.Close()
+			if !written {
+				os.Remove(filterOutputFile)
+			}
+		}()
+		out = f
+	}
+
+	LogVerbose("🔒 Applying sensitive data filter to %s...", kind)
+	var result *filter.FilterResult
+	if filterConfig.LeakScan == filter.LeakScanOff && filterConfig.Pseudonymizer == nil {
+		result, err = run(out)
+		if err != nil {
+			return fmt.Errorf("failed to filter %s: %w", kind, err)
+		}
+	} else {
+		var spool *os.File
+		var cleanup func()
+		result, spool, cleanup, err = filterToSpool(kind, filterConfig, run)
+		if err != nil {
+			// Leaks are still reported, so they can be tracked down
+			if result != nil {
+				if reportErr := writeFilterReport(result, filterConfig, configSource, reportFormat); reportErr != nil {
+					return reportErr
+				}
+			}
+			return fmt.Errorf("failed to filter %s: %w", kind, err)
+		}
+		defer cleanup()
+		if _, err := io.Copy(out, spool); err != nil {
+			return fmt.Errorf("failed to write filtered %s: %w", kind, err)
+		}
+	}
+
+	written = true
+
+	if Verbose {
+		filter.PrintVerboseOmissions(result, LogVerbose)
+		filter.PrintVerboseLeaks(result, LogVerbose)
+	}
+	if err := writeFilterReport(result, filterConfig, configSource, reportFormat); err != nil {
+		return err
+	}
+
+	if filterWriteBaseline != "" {
+		if err := filter.NewBaseline(result).Save(filterWriteBaseline); err != nil {
+			return err
+		}
+		LogVerbose("📝 Wrote filter baseline to %s", filterWriteBaseline)
+	}
+	return checkBaseline(baseline, filterBaseline, filterBaselineWarn, result)
+}
+
+// runExplain filters the input and prints how the filter decided each
+// --explain target, without writing the filtered output
+func runExplain(kind string, run func(w io.Writer) (*filter.FilterResult, error), config *filter.MergedConfig, format filter.OutputFormat) error {
+	result, err := run(io.Discard)
+	if err != nil {
+		return fmt.Errorf("failed to filter %s: %w", kind, err)
+	}
+
+	explanations := make([]*filter.Explanation, 0, len(filterExplain))
+	for _, target := range filterExplain {
+		explanations = append(explanations, filter.Explain(target, result, config))
+	}
+
+	if format == filter.OutputFormatJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(explanations)
+	}
+	for i, e := range explanations {
+		if i > 0 {
+			fmt.Println()
+		}
+		filter.PrintExplanation(os.Stdout, e)
+	}
+	return nil
+}
+
+// filterInputKind returns "plan" or "state" for the input, from --plan or
+// --state if given and from the document layout otherwise
+func filterInputKind(doc *filter.Document) (string, error) {
+	format := doc.Format()
+	switch {
+	case filterPlan:
+		if format != filter.FormatPlan {
+			return "", fmt.Errorf("invalid Terraform plan: missing 'resource_changes' field.\n\nMake sure you're using 'terraform show -json <planfile>'")
+		}
+		return "plan", nil
+	case filterState:
+		if format != filter.FormatRawState && format != filter.FormatShowState {
+			return "", fmt.Errorf("invalid Terraform state: expected 'terraform show -json' output (format_version/values) or a raw state file (version/resources)")
+		}
+		return "state", nil
+	}
+
+	switch format {
+	case filter.FormatPlan:
+		return "plan", nil
+	case filter.FormatRawState, filter.FormatShowState:
+		return "state", nil
+	}
+	return "", fmt.Errorf("unrecognized input: expected Terraform state or plan JSON from 'terraform show -json'")
+}
+
+// writeFilterReport writes the omission report to the --report file, or to
+// stderr if there is none
+func writeFilterReport(result *filter.FilterResult, config *filter.MergedConfig, configSource string, format filter.OutputFormat) error {
+	if filterReportFile == "" {
+		return filter.WriteReport(os.Stderr, result, config, configSource, format)
+	}
+
+	f, err := os.Create(filterReportFile)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+	defer f.Close()
+	if err := filter.WriteReport(f, result, config, configSource, format); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
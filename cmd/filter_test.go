@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/clairitydev/cora/internal/filter"
+)
+
+func TestFilterInputKind(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		plan      bool
+		state     bool
+		want      string
+		wantError bool
+	}{
+		{name: "detected plan", input: `{"format_version":"1.2","resource_changes":[]}`, want: "plan"},
+		{name: "detected raw state", input: `{"version":4,"resources":[]}`, want: "state"},
+		{name: "detected show state", input: `{"format_version":"1.0"}`, want: "state"},
+		{name: "forced plan", input: `{"format_version":"1.2","resource_changes":[]}`, plan: true, want: "plan"},
+		{name: "state passed as plan", input: `{"version":4,"resources":[]}`, plan: true, wantError: true},
+		{name: "plan passed as state", input: `{"format_version":"1.2","resource_changes":[]}`, state: true, wantError: true},
+		{name: "unrecognized", input: `{"foo":1}`, wantError: true},
+	}
+
+	defer func() { filterPlan, filterState = false, false }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filterPlan, filterState = tt.plan, tt.state
+			doc, err := filter.NewDocument(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("NewDocument failed: %v", err)
+			}
+			got, err := filterInputKind(doc)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
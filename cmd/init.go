@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/clairitydev/cora/internal/filter"
 	"github.com/spf13/cobra"
 )
 
@@ -75,11 +77,16 @@ func generateMinimalConfig() string {
 	return `version: 1
 
 filtering:
+  mode: denylist
+  packs: []
   omit_resource_types: []
   omit_attributes: []
   preserve_attributes: []
   honor_terraform_sensitive: true
   omit_data_sources: true
+  omit_private_data: true
+  embedded_documents: true
+  leak_scan: abort
 `
 }
 
@@ -94,6 +101,25 @@ func generateFullConfig() string {
 version: 1
 
 filtering:
+  # ─────────────────────────────────────────────────────────────────────────
+  # Filtering mode
+  # ─────────────────────────────────────────────────────────────────────────
+  # denylist (default) removes what the rules below flag and keeps the rest.
+  # allowlist keeps only the listed resource types, and only their id, arn,
+  # name and tags plus any per-type extras; the rules below still apply to
+  # what is kept. Addresses and dependencies are kept, so the graph renders.
+  #
+  mode: denylist
+  # allowlist:
+  #   resource_types:
+  #     - aws_vpc
+  #     - aws_subnet
+  #     - aws_instance
+  #   attributes: [id, arn, name, tags]
+  #   type_attributes:
+  #     aws_instance: [instance_type, availability_zone]
+
+` + rulePacksSection() + `
   # ─────────────────────────────────────────────────────────────────────────
   # Additional resource types to omit entirely (merged with built-in defaults)
   # ─────────────────────────────────────────────────────────────────────────
@@ -109,9 +135,24 @@ filtering:
   #   - azurerm_key_vault_secret, azurerm_key_vault_key
   #   - google_secret_manager_secret_version
   #
+  # Entries can be exact types, globs (vault_*) or regular expressions
+  # prefixed with "re:" (re:^azurerm_key_vault_).
+  #
   omit_resource_types: []
     # - custom_secret_resource
-    # - my_internal_credential_store
+    # - vault_*
+
+  # ─────────────────────────────────────────────────────────────────────────
+  # Modules to omit
+  # ─────────────────────────────────────────────────────────────────────────
+  # Every resource in a matching module, and in the modules it calls, is
+  # removed. Patterns use the same forms as omit_resource_types and match the
+  # module address with or without its instance key (module.app matches
+  # module.app[0]).
+  #
+  omit_modules: []
+    # - module.secrets
+    # - module.vault_*
 
   # ─────────────────────────────────────────────────────────────────────────
   # Additional attribute patterns to omit (merged with built-in defaults)
@@ -128,9 +169,22 @@ filtering:
   #   - credential, credentials
   #   - connection_string, connection_url
   #
+  # Entries can also choose a matching mode: substring (default) or word.
+  # Word mode splits names on _, - and camelCase and matches whole words, so
+  # "token" matches auth_token but not tokenizer_config.
+  #
   omit_attributes: []
     # - internal_api_key
     # - my_custom_secret_field
+    # - pattern: token
+    #   match: word
+
+  # Matching mode for entries that don't choose one, including the defaults
+  attribute_match: substring
+
+  # Names that word-mode patterns never omit. Defaults: *_arn, *_id, *_name
+  # attribute_exceptions:
+  #   - "*_arn"
 
   # ─────────────────────────────────────────────────────────────────────────
   # Attributes to preserve (overrides defaults)
@@ -142,6 +196,22 @@ filtering:
     # - public_connection_string
     # - password_policy_name
 
+  # ─────────────────────────────────────────────────────────────────────────
+  # Scoped attribute rules
+  # ─────────────────────────────────────────────────────────────────────────
+  # Omit or preserve an attribute path only on matching resources. Rules are
+  # checked before omit_attributes and preserve_attributes; the first match
+  # wins. resource_type and address accept globs and "re:" patterns. In the
+  # attribute path, * matches any key and [*] any list index.
+  #
+  attribute_rules: []
+    # - action: preserve
+    #   resource_type: github_actions_runner_group
+    #   attribute: token
+    # - action: omit
+    #   resource_type: aws_lambda_function
+    #   attribute: environment[*].variables.*
+
   # ─────────────────────────────────────────────────────────────────────────
   # Honor Terraform's sensitive markers
   # ─────────────────────────────────────────────────────────────────────────
@@ -158,5 +228,113 @@ filtering:
   # visualization. Set to false if you want to include them.
   #
   omit_data_sources: true
+
+  # ─────────────────────────────────────────────────────────────────────────
+  # Omit provider private data
+  # ─────────────────────────────────────────────────────────────────────────
+  # When true (default), the opaque base64-encoded "private" blob stored with
+  # each resource instance is removed. It holds provider metadata (timeouts,
+  # schema details, occasionally credentials) that Cora does not use.
+  #
+  omit_private_data: true
+
+  # ─────────────────────────────────────────────────────────────────────────
+  # Filter documents embedded in strings
+  # ─────────────────────────────────────────────────────────────────────────
+  # When true (default), JSON and YAML documents held in string attributes
+  # (Helm values, ECS container definitions, cloud-init user data), plain or
+  # base64 encoded, are decoded and filtered with the same rules. Name/value
+  # pairs such as container environment variables are checked by name.
+  #
+  embedded_documents: true
+
+  # ─────────────────────────────────────────────────────────────────────────
+  # Value-based secret detectors
+  # ─────────────────────────────────────────────────────────────────────────
+  # Detectors scan string values (regardless of the attribute name) for known
+  # secret formats. Matching values are omitted and reported by detector name.
+  # The entropy heuristic flags long random-looking strings; it is off by
+  # default because it can be noisy.
+  #
+  detectors:
+    aws_access_key: true
+    gcp_key: true
+    azure_key: true
+    github_token: true
+    private_key: true
+    jwt: true
+    entropy: false
+  # entropy_threshold: 4.5
+
+  # ─────────────────────────────────────────────────────────────────────────
+  # Redaction modes
+  # ─────────────────────────────────────────────────────────────────────────
+  # What to do with a flagged value, per rule: omit (remove the key),
+  # redact (replace with "(sensitive)") or hash (replace with a keyed
+  # HMAC-SHA256, so Cora can show a value changed without ever seeing it).
+  # Rules: patterns, terraform_sensitive, provider_schema (follows
+  # terraform_sensitive unless set), detectors. "default" sets the rest.
+  # An omit_attributes pattern, attribute rule or detector can set its own
+  # mode, e.g. "- {pattern: connection_uri, mode: redact}".
+  #
+  # The hash key is created in hash_key_file on first use and never uploaded.
+  # Set CORA_HASH_KEY instead to share a key between CI runs.
+  #
+  redaction:
+    default: omit
+    # patterns: redact
+    # terraform_sensitive: hash
+  # hash_key_file: ~/.config/cora/hash.key
+
+  # ─────────────────────────────────────────────────────────────────────────
+  # Leak scan
+  # ─────────────────────────────────────────────────────────────────────────
+  # After filtering, the whole payload is searched for copies of removed
+  # secrets (values marked sensitive by Terraform or the provider schema, or
+  # flagged by a detector), as-is, base64 or URL encoded.
+  # abort (default) stops the upload and lists each copy, redact replaces
+  # each copy with "(sensitive)", off skips the scan.
+  #
+  leak_scan: abort
+
+  # ─────────────────────────────────────────────────────────────────────────
+  # Pseudonymization
+  # ─────────────────────────────────────────────────────────────────────────
+  # Replace account IDs, subscription IDs, IP addresses and CIDRs, and domain
+  # names with stable pseudonyms, e.g. for diagrams shared outside the team.
+  # The same value always gets the same pseudonym within an upload; set
+  # persistent to keep them stable across uploads (uses hash_key_file).
+  #
+  pseudonymize:
+    enabled: false
+    # kinds: [account_ids, arns, subscription_ids, ip_addresses, domains]
+    # persistent: true
+    # keep_domains:
+    #   - example.com
 `
 }
+
+// rulePacksSection describes the packs setting and lists the built-in rule
+// packs, so the generated file always matches the packs this CLI has
+func rulePacksSection() string {
+	var b strings.Builder
+	b.WriteString(`  # ─────────────────────────────────────────────────────────────────────────
+  # Rule packs
+  # ─────────────────────────────────────────────────────────────────────────
+  # Curated resource types and attribute rules for a provider, built into the
+  # CLI. A pinned version (aws@1) is reported as a config error if an upgrade
+  # changes the pack. attribute_rules below are checked before pack rules.
+  #
+  # Available packs:
+`)
+	for _, name := range filter.RulePackNames() {
+		pack := filter.RulePacks[name]
+		fmt.Fprintf(&b, "  #   - %-12s %s\n", pack.String(), pack.Description)
+	}
+	b.WriteString(`  #
+  packs: []
+    # - aws
+    # - kubernetes@1
+`)
+	return b.String()
+}
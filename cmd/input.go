@@ -0,0 +1,335 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/clairitydev/cora/internal/filter"
+)
+
+// openInput opens the Terraform JSON input for upload or review: the file at
+// path, or stdin if path is empty. The filter reads its input twice, so stdin
+// is spooled to a private temporary file (see createSpool) rather than into
+// memory. The returned function closes the input and removes any temporary
+// file.
+func openInput(path, kind, example string) (*os.File, func(), error) {
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s file: %w", kind, err)
+		}
+		return f, func() { f.Close() }, nil
+	}
+
+	// Check if stdin has data
+	stat, _ := os.Stdin.Stat()
+	if (stat.Mode() & os.ModeCharDevice) != 0 {
+		return nil, nil, fmt.Errorf("no input provided. Pipe terraform %s or use --file flag.\n\nExample: %s", kind, example)
+	}
+
+	spool, cleanup, err := createSpool("cora-" + kind + "-*.json")
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.Copy(spool, os.Stdin); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to read from stdin: %w", err)
+	}
+	return spool, cleanup, nil
+}
+
+// inputSize returns the size of an opened input in bytes
+func inputSize(f *os.File) int64 {
+	info, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// streamBody runs write in the background and returns a reader for what it
+// writes, for use as an HTTP request body without buffering the payload. wait
+// closes the body and returns write's error; call it once the request is done.
+func streamBody(write func(w io.Writer) error) (body io.ReadCloser, wait func() error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	return pr, func() error {
+		// Unblocks the writer if the server answered before reading the whole body
+		pr.Close()
+		err := <-done
+		if errors.Is(err, io.ErrClosedPipe) {
+			return nil
+		}
+		return err
+	}
+}
+
+// filterToSpool filters the input with run into a temporary file and, unless
+// the leak scan is off, scans the result for copies of the values it removed,
+// which the filter's own streamed output cannot be checked for until it is
+// complete. In redact mode the returned file holds the output with those
+// copies replaced. When pseudonymization is on, the returned file holds the
+// output with identifying values replaced, after the leak scan has checked it.
+// The returned function closes and removes the file. If the scan aborts the
+// upload, the filter result is returned along with the *filter.LeakError.
+func filterToSpool(kind string, config *filter.MergedConfig, run func(w io.Writer) (*filter.FilterResult, error)) (*filter.FilterResult, *os.File, func(), error) {
+	spool, cleanup, err := createSpool(filteredSpoolPattern(kind))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	result, err := run(spool)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+
+	// pass copies the spool through a second pass into a new spool
+	pass := func(scan func(r io.Reader, w io.Writer) error) error {
+		next, cleanupNext, err := createSpool(filteredSpoolPattern(kind))
+		if err != nil {
+			return err
+		}
+		err = scan(spool, next)
+		cleanup()
+		spool, cleanup = next, cleanupNext
+		if err == nil {
+			_, err = spool.Seek(0, io.SeekStart)
+		}
+		return err
+	}
+
+	if config.LeakScan == filter.LeakScanRedact {
+		err := pass(func(r io.Reader, w io.Writer) error {
+			return filter.ScanLeaks(r, w, result, config)
+		})
+		if err != nil {
+			cleanup()
+			return nil, nil, nil, err
+		}
+	} else if config.LeakScan != filter.LeakScanOff {
+		err := filter.ScanLeaks(spool, io.Discard, result, config)
+		if err == nil {
+			_, err = spool.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			cleanup()
+			return nil, nil, nil, err
+		}
+	}
+
+	if err := filter.CheckLeaks(result, config); err != nil {
+		cleanup()
+		return result, nil, nil, err
+	}
+
+	if config.Pseudonymizer != nil {
+		err := pass(func(r io.Reader, w io.Writer) error {
+			return filter.Pseudonymize(r, w, result, config)
+		})
+		if err != nil {
+			cleanup()
+			return nil, nil, nil, err
+		}
+	}
+	return result, spool, cleanup, nil
+}
+
+// dryRunFilter runs the filter for a dry run, including the leak scan unless it
+// is off and pseudonymization when it is on. Leaks are returned on the result
+// for the report rather than as an error.
+func dryRunFilter(kind string, config *filter.MergedConfig, run func(w io.Writer) (*filter.FilterResult, error)) (*filter.FilterResult, error) {
+	if config.LeakScan == filter.LeakScanOff && config.Pseudonymizer == nil {
+		return run(io.Discard)
+	}
+	result, _, cleanup, err := filterToSpool(kind, config, run)
+	var leakErr *filter.LeakError
+	if errors.As(err, &leakErr) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cleanup()
+	return result, nil
+}
+
+// streamFiltered filters the input with run straight into w, for a request
+// body, and is used instead of filterToSpool when nothing has to rewrite the
+// complete output. The leak scan, when not off, reads a private copy of the
+// output once the filter is done, and check (if any) is given the result. The
+// last byte of the output is held back until both pass, so an upload they
+// stop is never a complete document: the request fails instead.
+func streamFiltered(kind string, w io.Writer, config *filter.MergedConfig, run func(w io.Writer) (*filter.FilterResult, error), check func(*filter.FilterResult) error) (*filter.FilterResult, error) {
+	held := &holdBackWriter{w: w}
+	out := io.Writer(held)
+	var spool *os.File
+	if config.LeakScan != filter.LeakScanOff {
+		f, cleanup, err := createSpool(filteredSpoolPattern(kind))
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		spool, out = f, io.MultiWriter(held, f)
+	}
+
+	result, err := run(out)
+	if err != nil {
+		return nil, err
+	}
+	if spool != nil {
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := filter.ScanLeaks(spool, io.Discard, result, config); err != nil {
+			return nil, err
+		}
+		if err := filter.CheckLeaks(result, config); err != nil {
+			return result, err
+		}
+	}
+	if check != nil {
+		if err := check(result); err != nil {
+			return result, err
+		}
+	}
+	return result, held.release()
+}
+
+// holdBackWriter passes writes through to w, except for the last byte written
+// so far, which is only written by release
+type holdBackWriter struct {
+	w       io.Writer
+	last    byte
+	pending bool
+}
+
+func (h *holdBackWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	out := p[:len(p)-1]
+	if h.pending {
+		out = append([]byte{h.last}, out...)
+	}
+	if _, err := h.w.Write(out); err != nil {
+		return 0, err
+	}
+	h.last, h.pending = p[len(p)-1], true
+	return len(p), nil
+}
+
+// release writes the byte held back
+func (h *holdBackWriter) release() error {
+	if !h.pending {
+		return nil
+	}
+	h.pending = false
+	_, err := h.w.Write([]byte{h.last})
+	return err
+}
+
+// filteredSpoolPattern names the spool for filtered output of a kind
+func filteredSpoolPattern(kind string) string {
+	return "cora-" + kind + "-filtered-*.json"
+}
+
+var (
+	spoolMu  sync.Mutex
+	spoolDir string
+)
+
+// createSpool creates a temporary file in the spool directory, readable only
+// by the current user. Spools hold Terraform JSON in plain text, unfiltered
+// for stdin, so the directory is private and is removed with everything in it
+// when the process is interrupted or the command returns (see removeSpools).
+func createSpool(pattern string) (*os.File, func(), error) {
+	dir, err := spoolDirectory()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	spool, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	return spool, func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}, nil
+}
+
+// spoolDirectory returns the private spool directory, creating it and the
+// handler that removes it on SIGINT or SIGTERM on first use
+func spoolDirectory() (string, error) {
+	spoolMu.Lock()
+	defer spoolMu.Unlock()
+	if spoolDir != "" {
+		return spoolDir, nil
+	}
+
+	// MkdirTemp creates the directory with mode 0700, and CreateTemp its files with 0600
+	dir, err := os.MkdirTemp("", "cora-")
+	if err != nil {
+		return "", err
+	}
+	spoolDir = dir
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		removeSpools()
+		code := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		os.Exit(code)
+	}()
+	return dir, nil
+}
+
+// removeSpools removes the spool directory and any spool still in it
+func removeSpools() {
+	spoolMu.Lock()
+	defer spoolMu.Unlock()
+	if spoolDir != "" {
+		os.RemoveAll(spoolDir)
+		spoolDir = ""
+	}
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// uploadClient returns an HTTP client for streamed uploads. The body is
+// filtered while it is sent, which can take minutes for large states, so the
+// timeout only covers waiting for the server's response once the body is sent.
+func uploadClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 60 * time.Second
+	return &http.Client{Transport: transport}
+}
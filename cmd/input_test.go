@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clairitydev/cora/internal/filter"
+)
+
+func TestStreamFilteredHoldsBackOnLeak(t *testing.T) {
+	leaky := `{"version":4,"resources":[{"mode":"managed","type":"aws_db_instance","name":"main","instances":[{"attributes":{"password":"s3cr3t-Passw0rd!","description":"copy of s3cr3t-Passw0rd!"},"sensitive_attributes":[[{"type":"get_attr","value":"password"}]]}]}]}`
+	clean := `{"version":4,"resources":[{"mode":"managed","type":"aws_db_instance","name":"main","instances":[{"attributes":{"password":"s3cr3t-Passw0rd!"},"sensitive_attributes":[[{"type":"get_attr","value":"password"}]]}]}]}`
+	defer removeSpools()
+
+	stream := func(input string) (string, error) {
+		doc, err := filter.NewDocument(strings.NewReader(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := filter.DefaultConfig()
+		var out bytes.Buffer
+		_, err = streamFiltered("state", &out, config, func(w io.Writer) (*filter.FilterResult, error) {
+			return filter.FilterStream(doc, w, config)
+		}, nil)
+		return out.String(), err
+	}
+
+	out, err := stream(clean)
+	if err != nil {
+		t.Fatalf("streamFiltered failed: %v", err)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(out), "}") || strings.Contains(out, "s3cr3t") {
+		t.Errorf("Expected the complete filtered document, got %s", out)
+	}
+
+	out, err = stream(leaky)
+	var leakErr *filter.LeakError
+	if !errors.As(err, &leakErr) {
+		t.Fatalf("Expected a LeakError, got %v", err)
+	}
+	if strings.HasSuffix(strings.TrimSpace(out), "}") {
+		t.Errorf("Expected the last byte to be held back, got %s", out)
+	}
+}
+
+func TestCreateSpoolIsPrivate(t *testing.T) {
+	defer removeSpools()
+
+	spool, cleanup, err := createSpool("cora-test-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	dir := filepath.Dir(spool.Name())
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o700 {
+		t.Errorf("Expected the spool directory to be 0700, got %o", perm)
+	}
+	if info, err := spool.Stat(); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the spool to be 0600, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	removeSpools()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected removeSpools to remove %s", dir)
+	}
+}
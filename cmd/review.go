@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -69,9 +68,13 @@ var (
 	commitSha   string
 
 	// Filtering flags for review command
-	reviewNoFilter     bool
-	reviewFilterDryRun bool
-	reviewOutputFormat string
+	reviewNoFilter       bool
+	reviewFilterDryRun   bool
+	reviewOutputFormat   string
+	reviewFilterWorkers  int
+	reviewBaseline       string
+	reviewBaselineWarn   bool
+	reviewProviderSchema string
 )
 
 // autoDetectEnvironment detects CI/CD environment and auto-populates flags
@@ -145,16 +148,63 @@ func init() {
 	// Filtering flags
 	reviewCmd.Flags().BoolVar(&reviewNoFilter, "no-filter", false, "Disable sensitive data filtering")
 	reviewCmd.Flags().BoolVar(&reviewFilterDryRun, "filter-dry-run", false, "Show what would be filtered without uploading")
-	reviewCmd.Flags().StringVar(&reviewOutputFormat, "output-format", "text", "Output format for dry-run: text or json")
+	reviewCmd.Flags().StringVar(&reviewOutputFormat, "output-format", "text", "Output format for dry-run: text, json, sarif, markdown or junit")
+	reviewCmd.Flags().IntVar(&reviewFilterWorkers, "filter-workers", 0, "Number of resources to filter in parallel (default: number of CPUs)")
+	reviewCmd.Flags().StringVar(&reviewBaseline, "filter-baseline", "", "Fail if filtering omits anything not in this baseline file (e.g. .cora-filter-baseline.json)")
+	reviewCmd.Flags().BoolVar(&reviewBaselineWarn, "filter-baseline-warn", false, "Warn about omissions missing from the baseline instead of failing")
+	addFilterProviderSchemaFlag(reviewCmd, &reviewProviderSchema)
 }
 
 // PlanUploadRequest matches the server-side PlanUploadRequest type
 type PlanUploadRequest struct {
-	Workspace  string                 `json:"workspace"`
-	Plan       map[string]interface{} `json:"plan"`
-	GitHub     *GitHubContext         `json:"github,omitempty"`
-	Source     string                 `json:"source,omitempty"`
-	CapturedAt string                 `json:"capturedAt,omitempty"`
+	Workspace  string          `json:"workspace"`
+	Plan       json.RawMessage `json:"plan"`
+	GitHub     *GitHubContext  `json:"github,omitempty"`
+	Source     string          `json:"source,omitempty"`
+	CapturedAt string          `json:"capturedAt,omitempty"`
+}
+
+// encode writes the request as JSON, in the same form json.Marshal produces.
+// The plan is written by writePlan rather than taken from r.Plan, so that it
+// can be streamed without holding it in memory.
+func (r PlanUploadRequest) encode(w io.Writer, writePlan func(w io.Writer) error) error {
+	field := func(name string, value interface{}) error {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, ",%q:%s", name, encoded)
+		return err
+	}
+
+	// Fields are written in PlanUploadRequest order
+	workspace, err := json.Marshal(r.Workspace)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, `{"workspace":%s,"plan":`, workspace); err != nil {
+		return err
+	}
+	if err := writePlan(w); err != nil {
+		return err
+	}
+	if r.GitHub != nil {
+		if err := field("github", r.GitHub); err != nil {
+			return err
+		}
+	}
+	if r.Source != "" {
+		if err := field("source", r.Source); err != nil {
+			return err
+		}
+	}
+	if r.CapturedAt != "" {
+		if err := field("capturedAt", r.CapturedAt); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "}")
+	return err
 }
 
 // GitHubContext contains GitHub PR information for posting comments
@@ -220,66 +270,63 @@ func runReview(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Read plan from file or stdin
-	var planData []byte
-	if reviewPlanFile != "" {
-		planData, err = os.ReadFile(reviewPlanFile)
-		if err != nil {
-			return fmt.Errorf("failed to read plan file: %w", err)
-		}
-	} else {
-		// Check if stdin has data
-		stat, _ := os.Stdin.Stat()
-		if (stat.Mode() & os.ModeCharDevice) != 0 {
-			return fmt.Errorf("no input provided. Pipe terraform plan or use --file flag.\n\nExample: terraform show -json tfplan | cora review --workspace my-app")
-		}
-
-		planData, err = io.ReadAll(os.Stdin)
-		if err != nil {
-			return fmt.Errorf("failed to read from stdin: %w", err)
-		}
+	// Open plan from file or stdin
+	input, closeInput, err := openInput(reviewPlanFile, "plan", "terraform show -json tfplan | cora review --workspace my-app")
+	if err != nil {
+		return err
 	}
+	defer closeInput()
 
-	if len(planData) == 0 {
+	planSize := inputSize(input)
+	if planSize == 0 {
 		return fmt.Errorf("empty plan data provided")
 	}
 
-	// Parse plan JSON
-	var planJSON map[string]interface{}
-	if err := json.Unmarshal(planData, &planJSON); err != nil {
+	// Scan the plan JSON (the plan is streamed from the input when uploading,
+	// so it is forwarded exactly as Terraform produced it)
+	doc, err := filter.NewDocument(input)
+	if err != nil {
 		return fmt.Errorf("invalid JSON: %w", err)
 	}
 
 	// Validate this looks like a Terraform plan (not state)
-	if _, hasResourceChanges := planJSON["resource_changes"]; !hasResourceChanges {
+	if !doc.Has("resource_changes") {
 		// Check if this is state instead of plan
-		if _, hasResources := planJSON["resources"]; hasResources {
+		if doc.Has("resources") {
 			return fmt.Errorf("this appears to be Terraform state, not a plan.\n\nUse 'terraform show -json tfplan' to output plan JSON, not 'terraform show -json'")
 		}
 		return fmt.Errorf("invalid Terraform plan: missing 'resource_changes' field.\n\nMake sure you're using 'terraform show -json <planfile>'")
 	}
 
+	baseline, err := loadBaseline(reviewBaseline)
+	if err != nil {
+		return err
+	}
+
+	providerSchema, err := loadProviderSchema(reviewProviderSchema)
+	if err != nil {
+		return err
+	}
+
 	// Load filter configuration
+	// A missing .cora.yaml means defaults; an invalid one is an error, since
+	// uploading under other rules than configured could expose what it omits
 	filterConfig, configSource, err := filter.GetMergedConfig()
 	if err != nil {
-		LogVerbose("⚠️  Failed to load filter config: %v", err)
-		filterConfig = &filter.MergedConfig{
-			OmitResourceTypes:       filter.DefaultOmitResourceTypes,
-			OmitAttributes:          filter.DefaultOmitAttributes,
-			PreserveAttributes:      []string{},
-			HonorTerraformSensitive: true,
-		}
-		configSource = "defaults"
+		return fmt.Errorf("failed to load filter config: %w", err)
 	}
 	LogVerbose("🔒 Filter config source: %s", configSource)
+	filterConfig.Workers = reviewFilterWorkers
+	filterConfig.ProviderSchema = providerSchema
+	filterConfig.InputPath = reviewPlanFile
 
 	// Merge with platform settings if available
 	if discovery != nil && discovery.Features.SensitiveFiltering.Available {
-		filterConfig.MergeWithPlatformSettings(
-			discovery.Features.SensitiveFiltering.AdditionalOmitTypes,
-			discovery.Features.SensitiveFiltering.AdditionalOmitAttributes,
-		)
+		filterConfig.MergeWithPlatformSettings(discovery.Features.SensitiveFiltering.PlatformSettings())
 		LogVerbose("🔒 Merged platform filtering settings")
+		for _, r := range filterConfig.RejectedOverrides {
+			LogVerbose("⚠️  Ignoring %s '%s': %s", r.Setting, r.Value, r.Reason)
+		}
 
 		// Check if filtering is enforced by the platform
 		if reviewNoFilter && discovery.Features.SensitiveFiltering.Enforced {
@@ -287,10 +334,26 @@ func runReview(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Apply filtering to the plan JSON unless disabled
-	if !reviewNoFilter {
+	if reviewNoFilter {
+		LogVerbose("⚠️  Sensitive data filtering disabled")
+		if reviewFilterDryRun {
+			fmt.Println("ℹ️  Dry-run has no effect when --no-filter is used")
+			return nil
+		}
+	} else {
 		LogVerbose("🔒 Applying sensitive data filter to plan...")
-		filterResult, err := filter.FilterPlan(planData, filterConfig)
+	}
+
+	// Handle dry-run mode: filter without uploading
+	if reviewFilterDryRun {
+		format, err := filter.ParseOutputFormat(reviewOutputFormat)
+		if err != nil {
+			return err
+		}
+
+		filterResult, err := dryRunFilter("plan", filterConfig, func(w io.Writer) (*filter.FilterResult, error) {
+			return filter.FilterPlanStream(doc, w, filterConfig)
+		})
 		if err != nil {
 			return fmt.Errorf("failed to filter plan: %w", err)
 		}
@@ -300,33 +363,15 @@ func runReview(cmd *cobra.Command, args []string) error {
 			filter.PrintVerboseOmissions(filterResult, LogVerbose)
 		}
 
-		// Handle dry-run mode
-		if reviewFilterDryRun {
-			format := filter.OutputFormatText
-			if reviewOutputFormat == "json" {
-				format = filter.OutputFormatJSON
-			}
-			return filter.PrintDryRunReport(filterResult, filterConfig, configSource, format)
-		}
-
-		// Re-parse the filtered plan
-		if err := json.Unmarshal(filterResult.FilteredJSON, &planJSON); err != nil {
-			return fmt.Errorf("failed to parse filtered plan: %w", err)
-		}
-		LogVerbose("📊 Filtered plan size: %d bytes (original: %d bytes)",
-			len(filterResult.FilteredJSON), len(planData))
-	} else {
-		LogVerbose("⚠️  Sensitive data filtering disabled")
-		if reviewFilterDryRun {
-			fmt.Println("ℹ️  Dry-run has no effect when --no-filter is used")
-			return nil
+		if err := filter.PrintDryRunReport(filterResult, filterConfig, configSource, format); err != nil {
+			return err
 		}
+		return checkBaseline(baseline, reviewBaseline, reviewBaselineWarn, filterResult)
 	}
 
-	// Build request payload
+	// Build request payload (the plan itself is streamed into it below)
 	request := PlanUploadRequest{
 		Workspace:  reviewWorkspace,
-		Plan:       planJSON,
 		Source:     reviewSource,
 		CapturedAt: time.Now().UTC().Format(time.RFC3339),
 	}
@@ -344,11 +389,6 @@ func runReview(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(os.Stderr, "Warning: Incomplete GitHub context. All of --github-owner, --github-repo, --pr-number, and --commit-sha are required for PR comments.\n")
 	}
 
-	requestBody, err := json.Marshal(request)
-	if err != nil {
-		return fmt.Errorf("failed to serialize request: %w", err)
-	}
-
 	// Build upload URL using discovered endpoint
 	planEndpoint := discovery.Endpoints.PlanUpload
 	if planEndpoint == "" {
@@ -356,12 +396,57 @@ func runReview(cmd *cobra.Command, args []string) error {
 	}
 	uploadURL := GetEndpointURL(apiBaseURL, planEndpoint)
 
-	client := &http.Client{
-		Timeout: 60 * time.Second,
+	client := uploadClient()
+
+	// Filter ahead of the upload when the leak scan redacts or values are
+	// pseudonymized, since each rewrites the complete filtered output
+	var filterResult *filter.FilterResult
+	var spool *os.File
+	if !reviewNoFilter && (filterConfig.LeakScan == filter.LeakScanRedact || filterConfig.Pseudonymizer != nil) {
+		result, f, cleanup, err := filterToSpool("plan", filterConfig, func(w io.Writer) (*filter.FilterResult, error) {
+			return filter.FilterPlanStream(doc, w, filterConfig)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to filter plan: %w", err)
+		}
+		defer cleanup()
+		if err := checkBaseline(baseline, reviewBaseline, reviewBaselineWarn, result); err != nil {
+			return err
+		}
+		filterResult, spool = result, f
 	}
 
-	req, err := http.NewRequest("POST", uploadURL, bytes.NewReader(requestBody))
+	// Stream the request into the body, filtering the plan on the way unless
+	// it was filtered above or filtering is disabled. The leak scan and the
+	// baseline check run before the body is complete, so either can stop it
+	filtered := &countingWriter{}
+	body, waitBody := streamBody(func(w io.Writer) error {
+		return request.encode(w, func(w io.Writer) error {
+			if reviewNoFilter {
+				if _, err := input.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				_, err := io.Copy(w, input)
+				return err
+			}
+			filtered.w = w
+			if spool != nil {
+				_, err := io.Copy(filtered, spool)
+				return err
+			}
+			result, err := streamFiltered("plan", filtered, filterConfig, func(w io.Writer) (*filter.FilterResult, error) {
+				return filter.FilterPlanStream(doc, w, filterConfig)
+			}, func(result *filter.FilterResult) error {
+				return checkBaseline(baseline, reviewBaseline, reviewBaselineWarn, result)
+			})
+			filterResult = result
+			return err
+		})
+	})
+
+	req, err := http.NewRequest("POST", uploadURL, body)
 	if err != nil {
+		waitBody()
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
@@ -371,11 +456,29 @@ func runReview(cmd *cobra.Command, args []string) error {
 	req.Header.Set("X-Cora-CLI-Version", Version)
 
 	resp, err := client.Do(req)
+	if filterErr := waitBody(); filterErr != nil {
+		if reviewNoFilter {
+			return fmt.Errorf("failed to read plan: %w", filterErr)
+		}
+		return fmt.Errorf("failed to filter plan: %w", filterErr)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to upload plan: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if filterResult != nil {
+		// Log omissions in verbose mode
+		if Verbose {
+			filter.PrintVerboseOmissions(filterResult, LogVerbose)
+			filter.PrintVerboseLeaks(filterResult, LogVerbose)
+		}
+		if len(filterResult.Leaks) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: Redacted %d copies of removed sensitive values (use --verbose to list them)\n", len(filterResult.Leaks))
+		}
+		LogVerbose("📊 Filtered plan size: %d bytes (original: %d bytes)", filtered.n, planSize)
+	}
+
 	// Check for CLI version warnings/errors in response headers
 	checkVersionHeaders(resp)
 
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestPlanUploadRequestEncode(t *testing.T) {
+	plan := `{"format_version":"1.2","resource_changes":[]}`
+
+	tests := []struct {
+		name    string
+		request PlanUploadRequest
+	}{
+		{"minimal", PlanUploadRequest{Workspace: "app-prod"}},
+		{"full", PlanUploadRequest{
+			Workspace:  `app "prod"`,
+			Source:     "atlantis",
+			CapturedAt: "2024-01-02T03:04:05Z",
+			GitHub:     &GitHubContext{Owner: "org", Repo: "repo", PRNumber: 12, CommitSHA: "abc123"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withPlan := tt.request
+			withPlan.Plan = json.RawMessage(plan)
+			want, err := json.Marshal(withPlan)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+
+			var got bytes.Buffer
+			err = tt.request.encode(&got, func(w io.Writer) error {
+				_, err := io.WriteString(w, plan)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("Expected %s, got %s", want, got.String())
+			}
+		})
+	}
+}
+
+func TestStreamBody(t *testing.T) {
+	body, wait := streamBody(func(w io.Writer) error {
+		_, err := io.WriteString(w, "streamed")
+		return err
+	})
+	data, _ := io.ReadAll(body)
+	if string(data) != "streamed" {
+		t.Errorf("Expected streamed body, got %q", data)
+	}
+	if err := wait(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// A write error reaches both the reader and wait
+	failure := errors.New("filter failed")
+	body, wait = streamBody(func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return failure
+	})
+	if _, err := io.ReadAll(body); !errors.Is(err, failure) {
+		t.Errorf("Expected the reader to fail with the write error, got %v", err)
+	}
+	if err := wait(); !errors.Is(err, failure) {
+		t.Errorf("Expected wait to return the write error, got %v", err)
+	}
+
+	// Closing the body early unblocks the writer
+	body, wait = streamBody(func(w io.Writer) error {
+		_, err := io.Copy(w, strings.NewReader(strings.Repeat("x", 1<<20)))
+		return err
+	})
+	body.Read(make([]byte, 10))
+	if err := wait(); err != nil {
+		t.Errorf("Expected no error after the reader closed early, got %v", err)
+	}
+}
+
+func TestFilterProviderSchemaFlagAlias(t *testing.T) {
+	for _, flag := range []string{"--filter-provider-schema", "--provider-schema"} {
+		var path string
+		cmd := &cobra.Command{Use: "review", RunE: func(*cobra.Command, []string) error { return nil }}
+		addFilterProviderSchemaFlag(cmd, &path)
+		cmd.SetArgs([]string{flag, "schema.json"})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%s: %v", flag, err)
+		}
+		if path != "schema.json" {
+			t.Errorf("Expected %s to set the provider schema, got %q", flag, path)
+		}
+	}
+}
@@ -32,6 +32,8 @@ For more information, visit https://thecora.app/docs/atlantis`,
 }
 
 func Execute() error {
+	// Runs on errors and panics too, before main exits
+	defer removeSpools()
 	return rootCmd.Execute()
 }
 
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/clairitydev/cora/internal/filter"
+	"github.com/spf13/cobra"
+)
+
+// providerSchemaAuto asks for the provider schema to be read by running
+// terraform in the working directory instead of from a file
+const providerSchemaAuto = "auto"
+
+// providerSchemaUsage is the help text of the provider schema flags
+const providerSchemaUsage = "Terraform provider schema JSON to read sensitive attributes from, or 'auto' to run 'terraform providers schema -json'"
+
+// addFilterProviderSchemaFlag registers --filter-provider-schema on a command
+// that filters before sending, with --provider-schema, the name the filter
+// command uses, as a hidden alias
+func addFilterProviderSchemaFlag(cmd *cobra.Command, path *string) {
+	cmd.Flags().StringVar(path, "filter-provider-schema", "", providerSchemaUsage)
+	cmd.Flags().StringVar(path, "provider-schema", "", providerSchemaUsage)
+	cmd.Flags().MarkHidden("provider-schema")
+}
+
+// loadProviderSchema reads the provider schema for --provider-schema, or
+// returns nil if none was given. With "auto" it runs
+// `terraform providers schema -json`, which needs an initialized working
+// directory.
+func loadProviderSchema(path string) (*filter.ProviderSchema, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	var schema *filter.ProviderSchema
+	var err error
+	if path == providerSchemaAuto {
+		schema, err = runProviderSchema()
+	} else {
+		schema, err = filter.LoadProviderSchema(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	LogVerbose("📐 Provider schema: %d resource types with sensitive attributes", schema.ResourceTypes())
+	return schema, nil
+}
+
+// runProviderSchema reads the provider schema from terraform
+func runProviderSchema() (*filter.ProviderSchema, error) {
+	LogVerbose("📐 Running 'terraform providers schema -json'...")
+	var stdout, stderr bytes.Buffer
+	command := exec.Command("terraform", "providers", "schema", "-json")
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("failed to read provider schema: %w\n\n%s\n\nRun 'terraform init' first, or pass a file from 'terraform providers schema -json'", err, msg)
+		}
+		return nil, fmt.Errorf("failed to read provider schema: %w\n\nRun 'terraform init' first, or pass a file from 'terraform providers schema -json'", err)
+	}
+	return filter.ReadProviderSchema(&stdout)
+}
@@ -1,13 +1,11 @@
 package cmd
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"time"
 
 	"github.com/clairitydev/cora/internal/environment"
 	"github.com/clairitydev/cora/internal/filter"
@@ -48,12 +46,17 @@ Environment Variables:
 }
 
 var (
-	workspace    string
-	stateFile    string
-	uploadSource string
-	noFilter     bool
-	filterDryRun bool
-	outputFormat string
+	workspace     string
+	stateFile     string
+	uploadSource  string
+	noFilter      bool
+	filterDryRun  bool
+	outputFormat  string
+	filterWorkers int
+
+	uploadBaseline       string
+	uploadBaselineWarn   bool
+	uploadProviderSchema string
 )
 
 // autoDetectUploadEnvironment detects CI/CD environment and auto-populates flags for upload
@@ -92,7 +95,11 @@ func init() {
 	uploadCmd.Flags().StringVar(&uploadSource, "source", "cli", "Source identifier (auto-detected: 'atlantis', 'github-actions', or 'cli')")
 	uploadCmd.Flags().BoolVar(&noFilter, "no-filter", false, "Disable sensitive data filtering")
 	uploadCmd.Flags().BoolVar(&filterDryRun, "filter-dry-run", false, "Show what would be filtered without uploading")
-	uploadCmd.Flags().StringVar(&outputFormat, "output-format", "text", "Output format for dry-run: text or json")
+	uploadCmd.Flags().StringVar(&outputFormat, "output-format", "text", "Output format for dry-run: text, json, sarif, markdown or junit")
+	uploadCmd.Flags().IntVar(&filterWorkers, "filter-workers", 0, "Number of resources to filter in parallel (default: number of CPUs)")
+	uploadCmd.Flags().StringVar(&uploadBaseline, "filter-baseline", "", "Fail if filtering omits anything not in this baseline file (e.g. .cora-filter-baseline.json)")
+	uploadCmd.Flags().BoolVar(&uploadBaselineWarn, "filter-baseline-warn", false, "Warn about omissions missing from the baseline instead of failing")
+	addFilterProviderSchemaFlag(uploadCmd, &uploadProviderSchema)
 }
 
 func runUpload(cmd *cobra.Command, args []string) error {
@@ -122,66 +129,64 @@ func runUpload(cmd *cobra.Command, args []string) error {
 		checkCLIVersionFromDiscovery(discovery)
 	}
 
-	// Read state from file or stdin
-	var stateData []byte
-	if stateFile != "" {
-		stateData, err = os.ReadFile(stateFile)
-		if err != nil {
-			return fmt.Errorf("failed to read state file: %w", err)
-		}
-	} else {
-		// Check if stdin has data
-		stat, _ := os.Stdin.Stat()
-		if (stat.Mode() & os.ModeCharDevice) != 0 {
-			return fmt.Errorf("no input provided. Pipe terraform state or use --file flag.\n\nExample: terraform show -json | cora upload --workspace my-app")
-		}
-
-		stateData, err = io.ReadAll(os.Stdin)
-		if err != nil {
-			return fmt.Errorf("failed to read from stdin: %w", err)
-		}
+	// Open state from file or stdin
+	input, closeInput, err := openInput(stateFile, "state", "terraform show -json | cora upload --workspace my-app")
+	if err != nil {
+		return err
 	}
+	defer closeInput()
 
-	if len(stateData) == 0 {
+	stateSize := inputSize(input)
+	if stateSize == 0 {
 		return fmt.Errorf("empty state data provided")
 	}
 
-	// Validate JSON
-	var stateJSON map[string]interface{}
-	if err := json.Unmarshal(stateData, &stateJSON); err != nil {
+	// Validate JSON and detect the state layout
+	doc, err := filter.NewDocument(input)
+	if err != nil {
 		return fmt.Errorf("invalid JSON: %w", err)
 	}
 
-	// Check for required Terraform state fields
-	if _, hasVersion := stateJSON["version"]; !hasVersion {
-		return fmt.Errorf("invalid Terraform state: missing 'version' field")
+	switch doc.Format() {
+	case filter.FormatRawState:
+		LogVerbose("📄 Detected raw Terraform state")
+	case filter.FormatShowState:
+		LogVerbose("📄 Detected 'terraform show -json' state")
+	case filter.FormatPlan:
+		return fmt.Errorf("this appears to be a Terraform plan, not state.\n\nUse 'cora review' for plans, or 'terraform show -json' (without a plan file) for state")
+	default:
+		return fmt.Errorf("invalid Terraform state: expected 'terraform show -json' output (format_version/values) or a raw state file (version/resources)")
 	}
-	if _, hasResources := stateJSON["resources"]; !hasResources {
-		return fmt.Errorf("invalid Terraform state: missing 'resources' field")
+
+	baseline, err := loadBaseline(uploadBaseline)
+	if err != nil {
+		return err
+	}
+
+	providerSchema, err := loadProviderSchema(uploadProviderSchema)
+	if err != nil {
+		return err
 	}
 
 	// Load filter configuration
+	// A missing .cora.yaml means defaults; an invalid one is an error, since
+	// uploading under other rules than configured could expose what it omits
 	filterConfig, configSource, err := filter.GetMergedConfig()
 	if err != nil {
-		LogVerbose("⚠️  Failed to load filter config: %v", err)
-		// Continue with defaults
-		filterConfig = &filter.MergedConfig{
-			OmitResourceTypes:       filter.DefaultOmitResourceTypes,
-			OmitAttributes:          filter.DefaultOmitAttributes,
-			PreserveAttributes:      []string{},
-			HonorTerraformSensitive: true,
-		}
-		configSource = "defaults"
+		return fmt.Errorf("failed to load filter config: %w", err)
 	}
 	LogVerbose("🔒 Filter config source: %s", configSource)
+	filterConfig.Workers = filterWorkers
+	filterConfig.ProviderSchema = providerSchema
+	filterConfig.InputPath = stateFile
 
 	// Merge with platform settings if available
 	if discovery != nil && discovery.Features.SensitiveFiltering.Available {
-		filterConfig.MergeWithPlatformSettings(
-			discovery.Features.SensitiveFiltering.AdditionalOmitTypes,
-			discovery.Features.SensitiveFiltering.AdditionalOmitAttributes,
-		)
+		filterConfig.MergeWithPlatformSettings(discovery.Features.SensitiveFiltering.PlatformSettings())
 		LogVerbose("🔒 Merged platform filtering settings")
+		for _, r := range filterConfig.RejectedOverrides {
+			LogVerbose("⚠️  Ignoring %s '%s': %s", r.Setting, r.Value, r.Reason)
+		}
 
 		// Check if filtering is enforced by the platform
 		if noFilter && discovery.Features.SensitiveFiltering.Enforced {
@@ -189,15 +194,17 @@ func runUpload(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Apply filtering unless disabled
-	var uploadData []byte
-	sensitiveFiltered := false
-	if noFilter {
-		LogVerbose("⚠️  Sensitive data filtering disabled")
-		uploadData = stateData
-	} else {
+	// Handle dry-run mode: filter without uploading
+	if filterDryRun && !noFilter {
 		LogVerbose("🔒 Applying sensitive data filter...")
-		filterResult, err := filter.Filter(stateData, filterConfig)
+		format, err := filter.ParseOutputFormat(outputFormat)
+		if err != nil {
+			return err
+		}
+
+		filterResult, err := dryRunFilter("state", filterConfig, func(w io.Writer) (*filter.FilterResult, error) {
+			return filter.FilterStream(doc, w, filterConfig)
+		})
 		if err != nil {
 			return fmt.Errorf("failed to filter state: %w", err)
 		}
@@ -207,20 +214,10 @@ func runUpload(cmd *cobra.Command, args []string) error {
 			filter.PrintVerboseOmissions(filterResult, LogVerbose)
 		}
 
-		// Handle dry-run mode
-		if filterDryRun {
-			// Suppress verbose output for JSON format
-			format := filter.OutputFormatText
-			if outputFormat == "json" {
-				format = filter.OutputFormatJSON
-			}
-			return filter.PrintDryRunReport(filterResult, filterConfig, configSource, format)
+		if err := filter.PrintDryRunReport(filterResult, filterConfig, configSource, format); err != nil {
+			return err
 		}
-
-		uploadData = filterResult.FilteredJSON
-		sensitiveFiltered = true
-		LogVerbose("📊 Filtered state size: %d bytes (original: %d bytes)",
-			len(uploadData), len(stateData))
+		return checkBaseline(baseline, uploadBaseline, uploadBaselineWarn, filterResult)
 	}
 
 	// Build upload URL using discovered endpoint
@@ -230,13 +227,61 @@ func runUpload(cmd *cobra.Command, args []string) error {
 	}
 	uploadURL := fmt.Sprintf("%s?workspace=%s", GetEndpointURL(apiBaseURL, stateEndpoint), workspace)
 
-	client := &http.Client{
-		Timeout: 60 * time.Second,
+	client := uploadClient()
+
+	// Filter ahead of the upload when the leak scan redacts or values are
+	// pseudonymized, since each rewrites the complete filtered output
+	var filterResult *filter.FilterResult
+	var spool *os.File
+	if noFilter {
+		LogVerbose("⚠️  Sensitive data filtering disabled")
+	} else {
+		LogVerbose("🔒 Applying sensitive data filter...")
+		if filterConfig.LeakScan == filter.LeakScanRedact || filterConfig.Pseudonymizer != nil {
+			result, f, cleanup, err := filterToSpool("state", filterConfig, func(w io.Writer) (*filter.FilterResult, error) {
+				return filter.FilterStream(doc, w, filterConfig)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to filter state: %w", err)
+			}
+			defer cleanup()
+			if err := checkBaseline(baseline, uploadBaseline, uploadBaselineWarn, result); err != nil {
+				return err
+			}
+			filterResult, spool = result, f
+		}
 	}
 
+	// Stream the state into the request body, filtering it on the way unless
+	// it was filtered above or filtering is disabled. The leak scan and the
+	// baseline check run before the body is complete, so either can stop it
+	filtered := &countingWriter{}
+	body, waitBody := streamBody(func(w io.Writer) error {
+		if noFilter {
+			if _, err := input.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			_, err := io.Copy(w, input)
+			return err
+		}
+		filtered.w = w
+		if spool != nil {
+			_, err := io.Copy(filtered, spool)
+			return err
+		}
+		result, err := streamFiltered("state", filtered, filterConfig, func(w io.Writer) (*filter.FilterResult, error) {
+			return filter.FilterStream(doc, w, filterConfig)
+		}, func(result *filter.FilterResult) error {
+			return checkBaseline(baseline, uploadBaseline, uploadBaselineWarn, result)
+		})
+		filterResult = result
+		return err
+	})
+
 	LogVerbose("📤 POST %s", uploadURL)
-	req, err := http.NewRequest("POST", uploadURL, bytes.NewReader(uploadData))
+	req, err := http.NewRequest("POST", uploadURL, body)
 	if err != nil {
+		waitBody()
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
@@ -245,16 +290,34 @@ func runUpload(cmd *cobra.Command, args []string) error {
 	req.Header.Set("User-Agent", fmt.Sprintf("cora-cli/%s", Version))
 	req.Header.Set("X-Cora-CLI-Version", Version)
 	req.Header.Set("X-Cora-Source", uploadSource)
-	if sensitiveFiltered {
+	if !noFilter {
 		req.Header.Set("X-Cora-Sensitive-Filtered", "true")
 	}
 
 	resp, err := client.Do(req)
+	if filterErr := waitBody(); filterErr != nil {
+		if noFilter {
+			return fmt.Errorf("failed to read state: %w", filterErr)
+		}
+		return fmt.Errorf("failed to filter state: %w", filterErr)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to upload state: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if filterResult != nil {
+		// Log omissions in verbose mode
+		if Verbose {
+			filter.PrintVerboseOmissions(filterResult, LogVerbose)
+			filter.PrintVerboseLeaks(filterResult, LogVerbose)
+		}
+		if len(filterResult.Leaks) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: Redacted %d copies of removed sensitive values (use --verbose to list them)\n", len(filterResult.Leaks))
+		}
+		LogVerbose("📊 Filtered state size: %d bytes (original: %d bytes)", filtered.n, stateSize)
+	}
+
 	LogVerbose("📥 Response: %s", resp.Status)
 
 	// Check for CLI version warnings/errors in response headers
@@ -0,0 +1,243 @@
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Filtering modes, selected with filtering.mode in .cora.yaml
+const (
+	// FilterModeDenylist removes what the rules flag and keeps the rest (the default)
+	FilterModeDenylist = "denylist"
+	// FilterModeAllowlist keeps only listed resource types and attributes
+	FilterModeAllowlist = "allowlist"
+)
+
+// ReasonNotAllowlisted is the omission reason for resources, attributes and
+// named values dropped in allowlist mode
+const ReasonNotAllowlisted = "not in the allowlist"
+
+// DefaultAllowlistAttributes are the attributes kept on every allowlisted
+// resource type, unless filtering.allowlist.attributes replaces them
+var DefaultAllowlistAttributes = []string{"id", "arn", "name", "tags"}
+
+// AllowlistConfig is the filtering.allowlist section of .cora.yaml
+type AllowlistConfig struct {
+	// ResourceTypes are the resource types that are uploaded. Required in allowlist mode
+	ResourceTypes []string `yaml:"resource_types"`
+
+	// Attributes are the top-level attributes kept on every allowlisted type
+	// (replaces DefaultAllowlistAttributes if set)
+	Attributes []string `yaml:"attributes"`
+
+	// TypeAttributes are additional attributes kept per resource type
+	TypeAttributes map[string][]string `yaml:"type_attributes"`
+}
+
+// Allowlist is the merged allowlist used in allowlist mode. Everything it
+// does not list is dropped; what it lists still goes through the usual rules,
+// so a listed attribute holding a secret is removed all the same.
+//
+// Resource addresses and dependencies are kept, so the graph still renders.
+type Allowlist struct {
+	ResourceTypes  []string
+	Attributes     []string
+	TypeAttributes map[string][]string
+}
+
+// newAllowlist validates the allowlist section
+func newAllowlist(section AllowlistConfig) (*Allowlist, error) {
+	if len(section.ResourceTypes) == 0 {
+		return nil, fmt.Errorf("resource_types is required in allowlist mode")
+	}
+	a := &Allowlist{
+		ResourceTypes:  section.ResourceTypes,
+		Attributes:     append([]string{}, DefaultAllowlistAttributes...),
+		TypeAttributes: section.TypeAttributes,
+	}
+	if section.Attributes != nil {
+		a.Attributes = section.Attributes
+	}
+
+	if err := validatePatterns(a.ResourceTypes); err != nil {
+		return nil, fmt.Errorf("resource_types: %w", err)
+	}
+	if err := validatePatterns(a.Attributes); err != nil {
+		return nil, fmt.Errorf("attributes: %w", err)
+	}
+	for resourceType, attributes := range a.TypeAttributes {
+		if err := validatePatterns(append([]string{resourceType}, attributes...)); err != nil {
+			return nil, fmt.Errorf("type_attributes: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// allowsType returns the resource_types entry matching a resource type, if any
+func (a *Allowlist) allowsType(resourceType string) (string, bool) {
+	return ResourceTypeMatchingPattern(resourceType, a.ResourceTypes)
+}
+
+// allowsAttribute returns the entry that keeps a top-level attribute of a
+// resource type, if any
+func (a *Allowlist) allowsAttribute(resourceType, key string) (string, bool) {
+	if pattern, found := ResourceTypeMatchingPattern(key, a.Attributes); found {
+		return pattern, true
+	}
+	for typePattern, attributes := range a.TypeAttributes {
+		if !matchPattern(resourceType, typePattern) {
+			continue
+		}
+		if pattern, found := ResourceTypeMatchingPattern(key, attributes); found {
+			return typePattern + ": " + pattern, true
+		}
+	}
+	return "", false
+}
+
+// KeptResource records the attributes an allowlisted resource kept
+type KeptResource struct {
+	Address    string   `json:"address"`
+	Type       string   `json:"type"`
+	Attributes []string `json:"attributes"`
+}
+
+// allowlistAttributes removes the top-level attributes of a resource that the
+// allowlist does not list, in place, and records what was kept. The sensitive
+// values among the removed attributes are captured for the leak scan, so a
+// copy of one in a kept attribute is still caught.
+func allowlistAttributes(
+	attrs *object,
+	basePath, address, resourceType string,
+	terraformSensitive *sensitivePaths,
+	providerSensitive *schemaNode,
+	config *MergedConfig,
+	result *FilterResult,
+) {
+	if attrs == nil {
+		return
+	}
+
+	kept := KeptResource{Address: address, Type: resourceType, Attributes: []string{}}
+	for _, key := range append([]string{}, attrs.orderedKeys()...) {
+		if _, found := config.Allowlist.allowsAttribute(resourceType, key); found {
+			kept.Attributes = append(kept.Attributes, key)
+			continue
+		}
+
+		value := attrs.values[key]
+		omission := OmittedField{
+			Path:   basePath + "." + key,
+			Reason: ReasonNotAllowlisted,
+			Type:   "attribute",
+		}
+		single := newObject()
+		single.set(key, value)
+		omission.values = captureSecretValues(nil, single, terraformSensitive, providerSensitive, config)
+		attrs.remove(key)
+
+		result.Omissions = append(result.Omissions, omission)
+		result.Summary.OmittedAttributes++
+	}
+
+	result.Kept = append(result.Kept, kept)
+}
+
+// omitNamedValues drops every remaining output, output change or variable in
+// allowlist mode. They are not resources, so the allowlist never lists them.
+func omitNamedValues(values *object, basePath string, result *FilterResult) {
+	for _, name := range append([]string{}, values.orderedKeys()...) {
+		values.remove(name)
+		result.Omissions = append(result.Omissions, OmittedField{
+			Path:   basePath + "." + name,
+			Reason: ReasonNotAllowlisted,
+			Type:   "attribute",
+		})
+		result.Summary.OmittedAttributes++
+	}
+}
+
+// stripConfigurationValues removes every constant value and variable default
+// from a plan's configuration section in allowlist mode. References are kept,
+// since they only name other objects and draw the edges of the graph.
+func stripConfigurationValues(value interface{}) {
+	switch v := value.(type) {
+	case *object:
+		v.remove("constant_value")
+		if variables := getObject(v, "variables"); variables != nil {
+			for _, name := range variables.orderedKeys() {
+				if variable := getObject(variables, name); variable != nil {
+					variable.remove("default")
+				}
+			}
+		}
+		for _, key := range v.orderedKeys() {
+			stripConfigurationValues(v.values[key])
+		}
+	case []interface{}:
+		for _, item := range v {
+			stripConfigurationValues(item)
+		}
+	}
+}
+
+// KeptType summarizes the resources of one type kept by the allowlist
+type KeptType struct {
+	Type       string   `json:"type"`
+	Resources  int      `json:"resources"`
+	Attributes []string `json:"attributes"`
+}
+
+// keptByType groups kept resources by type. A resource appears once per
+// instance, and once per section of a plan, so resources are counted by
+// address without instance keys.
+func keptByType(kept []KeptResource) []KeptType {
+	type group struct {
+		addresses  map[string]bool
+		attributes map[string]bool
+	}
+	groups := make(map[string]*group)
+	for _, k := range kept {
+		g := groups[k.Type]
+		if g == nil {
+			g = &group{addresses: make(map[string]bool), attributes: make(map[string]bool)}
+			groups[k.Type] = g
+		}
+		g.addresses[stripIndexKeys(k.Address)] = true
+		for _, attr := range k.Attributes {
+			g.attributes[attr] = true
+		}
+	}
+
+	types := make([]KeptType, 0, len(groups))
+	for resourceType, g := range groups {
+		attributes := make([]string, 0, len(g.attributes))
+		for attr := range g.attributes {
+			attributes = append(attributes, attr)
+		}
+		sort.Strings(attributes)
+		types = append(types, KeptType{Type: resourceType, Resources: len(g.addresses), Attributes: attributes})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Type < types[j].Type })
+	return types
+}
+
+// Mode returns the filtering mode, denylist or allowlist
+func (m *MergedConfig) Mode() string {
+	if m.Allowlist != nil {
+		return FilterModeAllowlist
+	}
+	return FilterModeDenylist
+}
+
+// parseFilterMode validates filtering.mode
+func parseFilterMode(value string) (string, error) {
+	switch mode := strings.ToLower(value); mode {
+	case "", FilterModeDenylist:
+		return FilterModeDenylist, nil
+	case FilterModeAllowlist:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid mode '%s' (expected denylist or allowlist)", value)
+}
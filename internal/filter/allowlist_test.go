@@ -0,0 +1,228 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func allowlistConfig(t *testing.T) *MergedConfig {
+	t.Helper()
+	allowlist, err := newAllowlist(AllowlistConfig{
+		ResourceTypes:  []string{"aws_instance", "aws_s3_*"},
+		TypeAttributes: map[string][]string{"aws_instance": {"instance_type"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.Allowlist = allowlist
+	return config
+}
+
+func TestFilterAllowlistState(t *testing.T) {
+	state := `{
+  "version": 4,
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_instance",
+      "name": "web",
+      "instances": [
+        {
+          "attributes": {
+            "id": "i-123",
+            "arn": "arn:aws:ec2:us-east-1:123456789012:instance/i-123",
+            "instance_type": "t3.micro",
+            "user_data": "export DB=postgres://app:hunter22@db/app",
+            "tags": {"Name": "web"}
+          },
+          "identity": {"id": "i-123"},
+          "dependencies": ["aws_s3_bucket.logs"]
+        }
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_s3_bucket",
+      "name": "logs",
+      "instances": [{"attributes": {"id": "logs", "bucket": "logs", "policy": "{}"}}]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_lambda_function",
+      "name": "api",
+      "instances": [{"attributes": {"id": "api", "environment": [{"variables": {"MODE": "prod"}}]}}]
+    }
+  ],
+  "outputs": {"endpoint": {"value": "https://web.example.com"}}
+}`
+
+	result, err := Filter([]byte(state), allowlistConfig(t))
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+
+	var filtered struct {
+		Resources []struct {
+			Type      string `json:"type"`
+			Instances []struct {
+				Attributes   map[string]interface{} `json:"attributes"`
+				Identity     interface{}            `json:"identity"`
+				Dependencies []string               `json:"dependencies"`
+			} `json:"instances"`
+		} `json:"resources"`
+		Outputs map[string]interface{} `json:"outputs"`
+	}
+	if err := json.Unmarshal(result.FilteredJSON, &filtered); err != nil {
+		t.Fatalf("Filtered output is not valid JSON: %v", err)
+	}
+
+	if len(filtered.Resources) != 2 {
+		t.Fatalf("Expected the two allowlisted resources, got %d", len(filtered.Resources))
+	}
+	web := filtered.Resources[0].Instances[0]
+	for _, key := range []string{"id", "arn", "instance_type", "tags"} {
+		if _, ok := web.Attributes[key]; !ok {
+			t.Errorf("Expected %s to be kept, got %v", key, web.Attributes)
+		}
+	}
+	if _, ok := web.Attributes["user_data"]; ok {
+		t.Errorf("Expected user_data to be dropped")
+	}
+	if web.Identity != nil {
+		t.Errorf("Expected identity to be dropped")
+	}
+	if len(web.Dependencies) != 1 {
+		t.Errorf("Expected dependencies to be kept, got %v", web.Dependencies)
+	}
+	bucket := filtered.Resources[1].Instances[0].Attributes
+	if _, ok := bucket["bucket"]; ok {
+		t.Errorf("Expected instance_type extras not to apply to aws_s3_bucket, got %v", bucket)
+	}
+	if len(filtered.Outputs) != 0 {
+		t.Errorf("Expected outputs to be dropped, got %v", filtered.Outputs)
+	}
+
+	for _, path := range []string{"aws_lambda_function.api", "aws_instance.web.user_data", "aws_s3_bucket.logs.policy", "outputs.endpoint"} {
+		if !hasOmission(result, path) {
+			t.Errorf("Expected omission at %s", path)
+		}
+	}
+
+	kept := keptByType(result.Kept)
+	if len(kept) != 2 || kept[0].Type != "aws_instance" || strings.Join(kept[0].Attributes, ",") != "arn,id,instance_type,tags" {
+		t.Errorf("Unexpected kept resources: %+v", kept)
+	}
+
+	config := allowlistConfig(t)
+	if e := Explain("aws_instance.web.user_data", result, config); e.Verdict != "omitted" || e.Reason != ReasonNotAllowlisted {
+		t.Errorf("Expected user_data to be explained as not allowlisted, got %s: %s", e.Verdict, e.Reason)
+	}
+	if e := Explain("aws_instance.web.instance_type", result, config); e.Verdict != "kept" {
+		t.Errorf("Expected instance_type to be explained as kept, got %s: %s", e.Verdict, e.Reason)
+	}
+
+	// Allowlist omissions are not sensitive findings
+	for _, o := range NewBaseline(result).Omissions {
+		if o.Reason == ReasonNotAllowlisted {
+			t.Errorf("Expected %s to be left out of the baseline", o.Path)
+		}
+	}
+}
+
+func TestFilterAllowlistPlan(t *testing.T) {
+	plan := `{
+  "format_version": "1.2",
+  "variables": {"region": {"value": "us-east-1"}},
+  "planned_values": {
+    "root_module": {
+      "resources": [
+        {"address": "aws_instance.web", "mode": "managed", "type": "aws_instance", "name": "web",
+         "values": {"id": "i-123", "ami": "ami-123", "name": "web"}, "sensitive_values": {}}
+      ]
+    }
+  },
+  "resource_changes": [
+    {
+      "address": "aws_instance.web", "mode": "managed", "type": "aws_instance", "name": "web",
+      "change": {
+        "actions": ["create"],
+        "before": null,
+        "after": {"ami": "ami-123", "name": "web", "subnet_id": "subnet-1"},
+        "after_unknown": {"id": true, "subnet_id": false},
+        "after_sensitive": {}
+      }
+    },
+    {
+      "address": "aws_iam_role.app", "mode": "managed", "type": "aws_iam_role", "name": "app",
+      "change": {"actions": ["create"], "before": null, "after": {"name": "app"}}
+    }
+  ],
+  "configuration": {
+    "root_module": {
+      "variables": {"region": {"default": "us-east-1"}},
+      "resources": [
+        {
+          "address": "aws_instance.web", "mode": "managed", "type": "aws_instance", "name": "web",
+          "expressions": {
+            "ami": {"constant_value": "ami-123"},
+            "subnet_id": {"references": ["aws_subnet.a.id", "aws_subnet.a"]}
+          }
+        }
+      ]
+    }
+  }
+}`
+
+	result, err := FilterPlan([]byte(plan), allowlistConfig(t))
+	if err != nil {
+		t.Fatalf("FilterPlan failed: %v", err)
+	}
+
+	output := string(result.FilteredJSON)
+	for _, leaked := range []string{"ami-123", "subnet-1", "us-east-1", "aws_iam_role.app"} {
+		if strings.Contains(output, leaked) {
+			t.Errorf("Expected %q to be dropped from the plan", leaked)
+		}
+	}
+	for _, kept := range []string{`"aws_subnet.a.id"`, `"name":"web"`, `"id":true`} {
+		if !strings.Contains(output, kept) {
+			t.Errorf("Expected %s to be kept in the plan", kept)
+		}
+	}
+	for _, path := range []string{"aws_iam_role.app", "aws_instance.web.after.ami", "variables.region"} {
+		if !hasOmission(result, path) {
+			t.Errorf("Expected omission at %s", path)
+		}
+	}
+
+	var report bytes.Buffer
+	if err := WriteReport(&report, result, allowlistConfig(t), ".cora.yaml", OutputFormatText); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), "Kept by Allowlist") || !strings.Contains(report.String(), "aws_instance (1 resources)") {
+		t.Errorf("Expected the report to list kept resources, got:\n%s", report.String())
+	}
+}
+
+func TestNewAllowlist(t *testing.T) {
+	if _, err := newAllowlist(AllowlistConfig{}); err == nil {
+		t.Error("Expected an error for an allowlist without resource types")
+	}
+	if _, err := newAllowlist(AllowlistConfig{ResourceTypes: []string{"re:("}}); err == nil {
+		t.Error("Expected an error for an invalid resource type pattern")
+	}
+	if _, err := parseFilterMode("blocklist"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+
+	a, err := newAllowlist(AllowlistConfig{ResourceTypes: []string{"aws_vpc"}, Attributes: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := a.allowsAttribute("aws_vpc", "tags"); found {
+		t.Error("Expected attributes to replace the defaults")
+	}
+}
@@ -0,0 +1,129 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// baselineVersion is the current filter baseline file format
+const baselineVersion = 1
+
+// Baseline records the omissions a workspace is known to have, so CI can flag
+// omissions a change introduces. It is committed as .cora-filter-baseline.json.
+type Baseline struct {
+	Version   int             `json:"version"`
+	Omissions []BaselineEntry `json:"omissions"`
+}
+
+// BaselineEntry is one known omission. Entries are matched by path and type;
+// the reason is kept for reviewers reading the file.
+type BaselineEntry struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// NewBaseline builds a baseline from the omissions in result. Data source
+// lookups and provider private data are left out: every data source and
+// instance has them, so they say nothing about secret material.
+func NewBaseline(result *FilterResult) *Baseline {
+	b := &Baseline{Version: baselineVersion, Omissions: []BaselineEntry{}}
+	seen := make(map[BaselineEntry]bool)
+	for _, o := range result.Omissions {
+		if !inBaseline(o) {
+			continue
+		}
+		key := BaselineEntry{Path: o.Path, Type: o.Type}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		b.Omissions = append(b.Omissions, BaselineEntry{Path: o.Path, Type: o.Type, Reason: o.Reason})
+	}
+
+	// Sorted so regenerating the file gives a minimal diff
+	sort.Slice(b.Omissions, func(i, j int) bool {
+		if b.Omissions[i].Path != b.Omissions[j].Path {
+			return b.Omissions[i].Path < b.Omissions[j].Path
+		}
+		return b.Omissions[i].Type < b.Omissions[j].Type
+	})
+	return b
+}
+
+// inBaseline reports whether an omission is tracked by baselines
+func inBaseline(o OmittedField) bool {
+	return o.Reason != ReasonDataSource && o.Reason != ReasonPrivateData && o.Reason != ReasonNotAllowlisted
+}
+
+// LoadBaseline reads a baseline file
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filter baseline: %w", err)
+	}
+
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("invalid filter baseline %s: %w", path, err)
+	}
+	if b.Version != baselineVersion {
+		return nil, fmt.Errorf("unsupported filter baseline version %d in %s (expected %d)", b.Version, path, baselineVersion)
+	}
+	return &b, nil
+}
+
+// Write writes the baseline as indented JSON
+func (b *Baseline) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
+
+// Save writes the baseline to a file
+func (b *Baseline) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create filter baseline: %w", err)
+	}
+	if err := b.Write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write filter baseline: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write filter baseline: %w", err)
+	}
+	return nil
+}
+
+// Diff compares the omissions in result with the baseline. It returns the
+// omissions the baseline does not have, in result order, and the baseline
+// entries that were not omitted this time.
+func (b *Baseline) Diff(result *FilterResult) (added []OmittedField, resolved []BaselineEntry) {
+	known := make(map[BaselineEntry]bool, len(b.Omissions))
+	for _, e := range b.Omissions {
+		known[BaselineEntry{Path: e.Path, Type: e.Type}] = true
+	}
+
+	current := make(map[BaselineEntry]bool)
+	for _, o := range result.Omissions {
+		if !inBaseline(o) {
+			continue
+		}
+		key := BaselineEntry{Path: o.Path, Type: o.Type}
+		if !known[key] && !current[key] {
+			added = append(added, o)
+		}
+		current[key] = true
+	}
+
+	for _, e := range b.Omissions {
+		if !current[BaselineEntry{Path: e.Path, Type: e.Type}] {
+			resolved = append(resolved, e)
+		}
+	}
+	return added, resolved
+}
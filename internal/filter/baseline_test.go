@@ -0,0 +1,59 @@
+package filter
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBaselineDiff(t *testing.T) {
+	before := &FilterResult{Omissions: []OmittedField{
+		{Path: "aws_db_instance.main.password", Reason: "matches pattern 'password'", Type: "attribute"},
+		{Path: "random_password.db", Reason: "resource type 'random_password' is in omit list", Type: "resource"},
+		{Path: "data.aws_ami.ubuntu", Reason: ReasonDataSource, Type: "resource"},
+	}}
+	baseline := NewBaseline(before)
+
+	if len(baseline.Omissions) != 2 {
+		t.Fatalf("Expected data sources to be left out of the baseline, got %+v", baseline.Omissions)
+	}
+	if baseline.Omissions[0].Path != "aws_db_instance.main.password" {
+		t.Errorf("Expected entries sorted by path, got %+v", baseline.Omissions)
+	}
+
+	after := &FilterResult{Omissions: []OmittedField{
+		{Path: "aws_db_instance.main.password", Reason: "matches organization pattern 'password'", Type: "attribute"},
+		{Path: "aws_db_instance.replica.password", Reason: "matches pattern 'password'", Type: "attribute"},
+		{Path: "data.aws_ami.debian", Reason: ReasonDataSource, Type: "resource"},
+		{Path: "aws_instance.web", Reason: ReasonPrivateData, Type: "attribute"},
+	}}
+	added, resolved := baseline.Diff(after)
+
+	if len(added) != 1 || added[0].Path != "aws_db_instance.replica.password" {
+		t.Errorf("Expected only the new password as added, got %+v", added)
+	}
+	if len(resolved) != 1 || resolved[0].Path != "random_password.db" {
+		t.Errorf("Expected the dropped resource as resolved, got %+v", resolved)
+	}
+}
+
+func TestBaselineSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".cora-filter-baseline.json")
+	baseline := NewBaseline(&FilterResult{Omissions: []OmittedField{
+		{Path: "aws_db_instance.main.password", Reason: "matches pattern 'password'", Type: "attribute"},
+	}})
+	if err := baseline.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := LoadBaseline(path)
+	if err != nil {
+		t.Fatalf("LoadBaseline failed: %v", err)
+	}
+	if len(loaded.Omissions) != 1 || loaded.Omissions[0] != baseline.Omissions[0] {
+		t.Errorf("Expected %+v, got %+v", baseline.Omissions, loaded.Omissions)
+	}
+
+	if _, err := LoadBaseline(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Expected an error for a missing baseline")
+	}
+}
@@ -0,0 +1,148 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// syntheticResources is the size of the generated benchmark state
+const syntheticResources = 100000
+
+var (
+	syntheticStateOnce sync.Once
+	syntheticState     []byte
+)
+
+// generateSyntheticState builds a raw state with n resources of a few common
+// shapes: instances with nested blocks and tags, databases with credentials,
+// and Lambda functions with environment variables.
+func generateSyntheticState(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"version":4,"terraform_version":"1.9.0","serial":1,"lineage":"bench","outputs":{},"resources":[`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		switch i % 3 {
+		case 0:
+			fmt.Fprintf(&buf, `{"mode":"managed","type":"aws_instance","name":"web_%d","provider":"provider[\"registry.terraform.io/hashicorp/aws\"]","instances":[{"schema_version":1,"attributes":{"id":"i-%08x","ami":"ami-0abcdef1234567890","instance_type":"t3.micro","subnet_id":"subnet-%d","vpc_security_group_ids":["sg-1","sg-2"],"root_block_device":[{"volume_size":20,"volume_type":"gp3","encrypted":true,"kms_key_id":"arn:aws:kms:us-east-1:123456789012:key/abc"}],"metadata_options":[{"http_tokens":"required","http_endpoint":"enabled"}],"tags":{"Name":"web-%d","Environment":"prod","Team":"platform","CostCenter":"cc-%d"}},"sensitive_attributes":[],"private":"eyJzY2hlbWFfdmVyc2lvbiI6IjEifQ=="}]}`, i, i, i%50, i, i%20)
+		case 1:
+			fmt.Fprintf(&buf, `{"mode":"managed","type":"aws_db_instance","name":"db_%d","provider":"provider[\"registry.terraform.io/hashicorp/aws\"]","instances":[{"schema_version":2,"attributes":{"id":"db-%d","engine":"postgres","engine_version":"16.2","instance_class":"db.t3.medium","username":"app","password":"p@ssw0rd-%d","master_user_secret":[{"secret_arn":"arn:aws:secretsmanager:us-east-1:123456789012:secret:db-%d","kms_key_id":"alias/aws/rds"}],"parameter_group_name":"default.postgres16","tags":{"Name":"db-%d"}},"sensitive_attributes":[[{"type":"get_attr","value":"password"}]]}]}`, i, i, i, i, i)
+		default:
+			fmt.Fprintf(&buf, `{"module":"module.svc_%d","mode":"managed","type":"aws_lambda_function","name":"fn","provider":"provider[\"registry.terraform.io/hashicorp/aws\"]","instances":[{"schema_version":0,"attributes":{"id":"fn-%d","function_name":"fn-%d","runtime":"python3.12","handler":"app.handler","memory_size":256,"environment":[{"variables":{"STAGE":"prod","LOG_LEVEL":"info","DATABASE_URL":"postgres://app@db-%d/app","FEATURE_FLAGS":"a,b,c"}}],"tracing_config":[{"mode":"Active"}],"tags":{"Name":"fn-%d"}},"sensitive_attributes":[]}]}`, i%500, i, i, i, i)
+		}
+	}
+	buf.WriteString(`]}`)
+	return buf.Bytes()
+}
+
+// benchmarkState returns the shared 100k-resource synthetic state
+func benchmarkState() []byte {
+	syntheticStateOnce.Do(func() {
+		syntheticState = generateSyntheticState(syntheticResources)
+	})
+	return syntheticState
+}
+
+// collectAttributeNames returns every attribute name in the order the filter visits them
+func collectAttributeNames(b *testing.B, data []byte) []string {
+	state, err := decodeObject(data)
+	if err != nil {
+		b.Fatalf("Failed to decode synthetic state: %v", err)
+	}
+
+	var names []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch val := v.(type) {
+		case *object:
+			for _, key := range val.orderedKeys() {
+				names = append(names, key)
+				walk(val.values[key])
+			}
+		case []interface{}:
+			for _, item := range val {
+				walk(item)
+			}
+		}
+	}
+	for _, item := range getArray(state, "resources") {
+		for _, instance := range getArray(item.(*object), "instances") {
+			walk(getObject(instance.(*object), "attributes"))
+		}
+	}
+	return names
+}
+
+// benchmarkPatterns is a realistic pattern set: the defaults plus organization
+// and project additions, some in word mode
+func benchmarkPatterns() []string {
+	patterns := append([]string{}, DefaultOmitAttributes...)
+	return append(patterns,
+		"ssn", "social_security", "employee_email", "internal_ref",
+		"word:pin", "word:signing_key", "word:client_secret", "word:webhook_url",
+	)
+}
+
+// BenchmarkAttributeMatchLinear matches every attribute name in the synthetic
+// state by scanning the pattern list, as AttributeMatchingPattern does
+func BenchmarkAttributeMatchLinear(b *testing.B) {
+	names := collectAttributeNames(b, benchmarkState())
+	patterns := benchmarkPatterns()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, name := range names {
+			AttributeMatchingPatternExcept(name, patterns, DefaultAttributeExceptions)
+		}
+	}
+	b.ReportMetric(float64(len(names)), "names/op")
+}
+
+// BenchmarkAttributeMatchCompiled matches the same names with the compiled matcher
+func BenchmarkAttributeMatchCompiled(b *testing.B) {
+	names := collectAttributeNames(b, benchmarkState())
+	config := DefaultConfig()
+	config.OmitAttributes = benchmarkPatterns()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, name := range names {
+			config.attributeMatchingPattern(name, config.OmitAttributes)
+		}
+	}
+	b.ReportMetric(float64(len(names)), "names/op")
+}
+
+// BenchmarkFilterLargeState filters the whole synthetic state end to end
+func BenchmarkFilterLargeState(b *testing.B) {
+	data := benchmarkState()
+	config := DefaultConfig()
+	config.OmitAttributes = benchmarkPatterns()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Filter(data, config); err != nil {
+			b.Fatalf("Filter failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkFilterLargeStateSerial filters the synthetic state on a single worker
+func BenchmarkFilterLargeStateSerial(b *testing.B) {
+	data := benchmarkState()
+	config := DefaultConfig()
+	config.OmitAttributes = benchmarkPatterns()
+	config.Workers = 1
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Filter(data, config); err != nil {
+			b.Fatalf("Filter failed: %v", err)
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package filter
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,15 +18,43 @@ type FilterConfig struct {
 
 // FilteringConfigSection contains the filtering-specific settings
 type FilteringConfigSection struct {
+	// Mode selects denylist filtering (the default), which removes what the
+	// rules flag, or allowlist filtering, which keeps only what Allowlist lists
+	Mode string `yaml:"mode"`
+
+	// Allowlist lists the resource types and attributes kept in allowlist mode
+	Allowlist AllowlistConfig `yaml:"allowlist"`
+
 	// OmitResourceTypes are additional resource types to omit entirely (merged with defaults)
 	OmitResourceTypes []string `yaml:"omit_resource_types"`
 
-	// OmitAttributes are additional attribute patterns to omit (merged with defaults)
-	OmitAttributes []string `yaml:"omit_attributes"`
+	// OmitModules are module address patterns whose whole subtree is omitted
+	// (e.g. module.secrets or module.vault_*)
+	OmitModules []string `yaml:"omit_modules"`
+
+	// OmitAttributes are additional attribute patterns to omit (merged with defaults).
+	// Entries are pattern strings or {pattern, match} mappings
+	OmitAttributes []AttributePattern `yaml:"omit_attributes"`
+
+	// AttributeMatch is the matching mode for patterns that don't choose one,
+	// including the built-in defaults: "substring" (default) or "word"
+	AttributeMatch string `yaml:"attribute_match"`
+
+	// AttributeExceptions are names that word-mode patterns never omit
+	// (replaces DefaultAttributeExceptions if set)
+	AttributeExceptions []string `yaml:"attribute_exceptions"`
 
 	// PreserveAttributes are attribute patterns to never omit (overrides defaults)
 	PreserveAttributes []string `yaml:"preserve_attributes"`
 
+	// AttributeRules omit or preserve attribute paths on specific resource types
+	// or addresses. They are checked before omit_attributes and preserve_attributes
+	AttributeRules []AttributeRule `yaml:"attribute_rules"`
+
+	// Packs selects built-in rule packs by name, optionally pinned to a
+	// version (aws or aws@1). See RulePacks
+	Packs []string `yaml:"packs"`
+
 	// HonorTerraformSensitive controls whether to use Terraform's sensitive_attributes
 	// Defaults to true if not specified
 	HonorTerraformSensitive *bool `yaml:"honor_terraform_sensitive"`
@@ -31,19 +62,76 @@ type FilteringConfigSection struct {
 	// OmitDataSources controls whether to omit data source lookups entirely
 	// Defaults to true if not specified
 	OmitDataSources *bool `yaml:"omit_data_sources"`
+
+	// OmitPrivateData controls whether to omit opaque provider data such as the
+	// base64-encoded instance "private" blob. Defaults to true if not specified
+	OmitPrivateData *bool `yaml:"omit_private_data"`
+
+	// EmbeddedDocuments controls whether JSON and YAML documents held in string
+	// attributes (optionally base64 encoded) are filtered too. Defaults to true
+	EmbeddedDocuments *bool `yaml:"embedded_documents"`
+
+	// Detectors enables or disables value-based secret detectors by name
+	// (merged with DefaultDetectors), optionally with a redaction mode
+	Detectors map[string]DetectorSetting `yaml:"detectors"`
+
+	// EntropyThreshold is the minimum Shannon entropy (bits per character) for
+	// the entropy detector. Defaults to DefaultEntropyThreshold if not specified
+	EntropyThreshold *float64 `yaml:"entropy_threshold"`
+
+	// Redaction selects how flagged values are handled per rule category
+	// (default, patterns, terraform_sensitive, provider_schema, detectors):
+	// omit, redact or hash
+	Redaction map[string]string `yaml:"redaction"`
+
+	// HashKeyFile is the local file holding the HMAC key for hash mode.
+	// Defaults to ~/.config/cora/hash.key, created on first use
+	HashKeyFile string `yaml:"hash_key_file"`
+
+	// LeakScan selects what happens when a removed value is still found
+	// elsewhere in the filtered output: abort (default), redact or off
+	LeakScan string `yaml:"leak_scan"`
+
+	// Pseudonymize replaces account IDs, subscription IDs, IP addresses and
+	// domain names in the filtered output with stable pseudonyms
+	Pseudonymize PseudonymizeConfig `yaml:"pseudonymize"`
 }
 
 // MergedConfig represents the final merged configuration with defaults
 type MergedConfig struct {
 	OmitResourceTypes       []string
-	OmitAttributes          []string
+	OmitModules             []string
+	OmitAttributes          []string // Word-mode patterns carry a "word:" prefix
+	AttributeExceptions     []string
 	PreserveAttributes      []string
+	AttributeRules          []AttributeRule
 	HonorTerraformSensitive bool
 	OmitDataSources         bool
+	OmitPrivateData         bool
+	EmbeddedDocuments       bool
+	Detectors               []Detector
+	Redaction               map[string]RedactionMode // Mode per rule category; missing means omit
+	PatternModes            map[string]RedactionMode // Mode per omit_attributes pattern that sets one, by internal form
+	DetectorModes           map[string]RedactionMode // Mode per detector that sets one
+	HashKey                 []byte                   // HMAC key for hash mode (never uploaded)
+	Workers                 int                      // Resources filtered in parallel; 0 uses GOMAXPROCS, 1 filters serially
+	LeakScan                LeakScanMode             // What to do with copies of removed values found by ScanLeaks
+	ProviderSchema          *ProviderSchema          // Attributes providers declare sensitive; nil if no schema was given
+	Packs                   []string                 // Selected rule packs, as name@version
+	Allowlist               *Allowlist               // Resource types and attributes to keep; nil in denylist mode
+	Pseudonymizer           *Pseudonymizer           // Replaces identifying values after filtering; nil when off
+	ConfigPath              string                   // Path of the .cora.yaml loaded; empty for the defaults
+	InputPath               string                   // Path of the Terraform JSON filtered; empty for stdin
 
 	// Platform-specific settings (tracked separately for reporting)
 	PlatformOmitResourceTypes []string
 	PlatformOmitAttributes    []string
+	PlatformEnforced          bool               // Organization patterns override local preserve rules
+	RejectedOverrides         []RejectedOverride // Local settings ignored in favor of platform settings
+
+	compiled  atomic.Pointer[compiledMatchers] // Attribute matchers, built on first use
+	sources   *ruleSources                     // Where .cora.yaml entries were set, for --explain
+	packTypes map[string]string                // Rule pack that added each resource type, for --explain
 }
 
 // LoadConfig searches for .cora.yaml in the current directory and parent directories,
@@ -100,34 +188,87 @@ func findConfigFile() (string, error) {
 	}
 }
 
-// GetMergedConfig loads the config file (if exists) and merges with defaults.
-func GetMergedConfig() (*MergedConfig, string, error) {
-	cfg, err := LoadConfig()
-	if err != nil {
-		return nil, "", err
-	}
+// DefaultConfig returns the built-in filtering configuration used when no
+// .cora.yaml is present.
+func DefaultConfig() *MergedConfig {
+	// The built-in detector set is always valid
+	detectors, _ := buildDetectors(DefaultDetectors, DefaultEntropyThreshold)
 
-	merged := &MergedConfig{
+	return &MergedConfig{
 		OmitResourceTypes:       append([]string{}, DefaultOmitResourceTypes...),
 		OmitAttributes:          append([]string{}, DefaultOmitAttributes...),
+		AttributeExceptions:     append([]string{}, DefaultAttributeExceptions...),
 		PreserveAttributes:      []string{},
 		HonorTerraformSensitive: true,
 		OmitDataSources:         true,
+		OmitPrivateData:         true,
+		EmbeddedDocuments:       true,
+		Detectors:               detectors,
+		LeakScan:                LeakScanAbort,
+	}
+}
+
+// GetMergedConfig loads the config file (if exists) and merges with defaults.
+func GetMergedConfig() (*MergedConfig, string, error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, "", err
 	}
 
+	merged := DefaultConfig()
+
 	configSource := "defaults"
 
 	if cfg != nil {
 		configSource = ".cora.yaml"
+		if configPath, err := findConfigFile(); err == nil && configPath != "" {
+			merged.ConfigPath = configPath
+			merged.sources = loadRuleSources(configPath)
+		}
 
 		// Merge additional resource types
 		if len(cfg.Filtering.OmitResourceTypes) > 0 {
 			merged.OmitResourceTypes = append(merged.OmitResourceTypes, cfg.Filtering.OmitResourceTypes...)
 		}
 
+		// Omitted modules
+		if len(cfg.Filtering.OmitModules) > 0 {
+			merged.OmitModules = cfg.Filtering.OmitModules
+		}
+
 		// Merge additional attributes
-		if len(cfg.Filtering.OmitAttributes) > 0 {
-			merged.OmitAttributes = append(merged.OmitAttributes, cfg.Filtering.OmitAttributes...)
+		for _, pattern := range cfg.Filtering.OmitAttributes {
+			merged.OmitAttributes = append(merged.OmitAttributes, pattern.Pattern)
+			if pattern.Mode != "" {
+				if merged.PatternModes == nil {
+					merged.PatternModes = make(map[string]RedactionMode)
+				}
+				merged.PatternModes[pattern.Pattern] = pattern.Mode
+			}
+		}
+
+		// Default matching mode for patterns that don't choose one
+		switch cfg.Filtering.AttributeMatch {
+		case "", AttributeMatchSubstring:
+		case AttributeMatchWord:
+			for i, pattern := range merged.OmitAttributes {
+				if !strings.HasPrefix(pattern, wordMatchPrefix) && !strings.HasPrefix(pattern, substringMatchPrefix) {
+					merged.OmitAttributes[i] = wordMatchPrefix + pattern
+				}
+			}
+		default:
+			return nil, "", fmt.Errorf("invalid attribute_match '%s' (expected substring or word)", cfg.Filtering.AttributeMatch)
+		}
+		for i, pattern := range merged.OmitAttributes {
+			merged.OmitAttributes[i] = strings.TrimPrefix(pattern, substringMatchPrefix)
+		}
+
+		// Word-mode exceptions
+		if cfg.Filtering.AttributeExceptions != nil {
+			merged.AttributeExceptions = cfg.Filtering.AttributeExceptions
+		}
+		if err := validatePatterns(merged.AttributeExceptions); err != nil {
+			return nil, "", fmt.Errorf("attribute_exceptions: %w", err)
 		}
 
 		// Set preserve attributes
@@ -135,6 +276,20 @@ func GetMergedConfig() (*MergedConfig, string, error) {
 			merged.PreserveAttributes = cfg.Filtering.PreserveAttributes
 		}
 
+		// Scoped attribute rules
+		if len(cfg.Filtering.AttributeRules) > 0 {
+			rules, err := compileAttributeRules(cfg.Filtering.AttributeRules)
+			if err != nil {
+				return nil, "", err
+			}
+			merged.AttributeRules = rules
+		}
+
+		// Rule packs, after the local rules so that those take precedence
+		if err := merged.applyRulePacks(cfg.Filtering.Packs); err != nil {
+			return nil, "", fmt.Errorf("packs: %w", err)
+		}
+
 		// Honor Terraform sensitive
 		if cfg.Filtering.HonorTerraformSensitive != nil {
 			merged.HonorTerraformSensitive = *cfg.Filtering.HonorTerraformSensitive
@@ -144,20 +299,312 @@ func GetMergedConfig() (*MergedConfig, string, error) {
 		if cfg.Filtering.OmitDataSources != nil {
 			merged.OmitDataSources = *cfg.Filtering.OmitDataSources
 		}
+
+		// Omit provider private data
+		if cfg.Filtering.OmitPrivateData != nil {
+			merged.OmitPrivateData = *cfg.Filtering.OmitPrivateData
+		}
+
+		// Allowlist mode
+		mode, err := parseFilterMode(cfg.Filtering.Mode)
+		if err != nil {
+			return nil, "", err
+		}
+		if mode == FilterModeAllowlist {
+			allowlist, err := newAllowlist(cfg.Filtering.Allowlist)
+			if err != nil {
+				return nil, "", fmt.Errorf("allowlist: %w", err)
+			}
+			merged.Allowlist = allowlist
+			// Opaque provider data is never on the list
+			merged.OmitPrivateData = true
+		}
+
+		// Documents embedded in strings
+		if cfg.Filtering.EmbeddedDocuments != nil {
+			merged.EmbeddedDocuments = *cfg.Filtering.EmbeddedDocuments
+		}
+
+		// Value detectors
+		if len(cfg.Filtering.Detectors) > 0 || cfg.Filtering.EntropyThreshold != nil {
+			enabled := make(map[string]bool)
+			for name, on := range DefaultDetectors {
+				enabled[name] = on
+			}
+			for name, setting := range cfg.Filtering.Detectors {
+				enabled[name] = setting.Enabled
+				if setting.Mode != "" {
+					if merged.DetectorModes == nil {
+						merged.DetectorModes = make(map[string]RedactionMode)
+					}
+					merged.DetectorModes[name] = setting.Mode
+				}
+			}
+			threshold := DefaultEntropyThreshold
+			if cfg.Filtering.EntropyThreshold != nil {
+				threshold = *cfg.Filtering.EntropyThreshold
+			}
+			detectors, err := buildDetectors(enabled, threshold)
+			if err != nil {
+				return nil, "", err
+			}
+			merged.Detectors = detectors
+		}
+
+		// Reject invalid regular expressions up front rather than never matching
+		if err := validatePatterns(merged.OmitResourceTypes); err != nil {
+			return nil, "", fmt.Errorf("omit_resource_types: %w", err)
+		}
+		if err := validatePatterns(merged.OmitModules); err != nil {
+			return nil, "", fmt.Errorf("omit_modules: %w", err)
+		}
+
+		// Redaction modes
+		if len(cfg.Filtering.Redaction) > 0 {
+			modes, err := parseRedactionModes(cfg.Filtering.Redaction)
+			if err != nil {
+				return nil, "", err
+			}
+			merged.Redaction = modes
+		}
+
+		// Only touch the key file when hashing is actually used
+		if merged.usesHashing() {
+			key, err := loadHashKey(cfg.Filtering.HashKeyFile)
+			if err != nil {
+				return nil, "", err
+			}
+			merged.HashKey = key
+		}
+
+		// Leak scan
+		leakScan, err := parseLeakScanMode(cfg.Filtering.LeakScan)
+		if err != nil {
+			return nil, "", err
+		}
+		merged.LeakScan = leakScan
+
+		// Pseudonymization
+		if cfg.Filtering.Pseudonymize.Enabled {
+			pseudonymizer, err := newPseudonymizer(cfg.Filtering.Pseudonymize, func() ([]byte, error) {
+				return loadHashKey(cfg.Filtering.HashKeyFile)
+			})
+			if err != nil {
+				return nil, "", fmt.Errorf("pseudonymize: %w", err)
+			}
+			merged.Pseudonymizer = pseudonymizer
+		}
 	}
 
 	return merged, configSource, nil
 }
 
+// Attribute pattern matching modes
+const (
+	AttributeMatchSubstring = "substring"
+	AttributeMatchWord      = "word"
+)
+
+// substringMatchPrefix pins a pattern to substring mode when attribute_match is word.
+// It only exists while the config is merged.
+const substringMatchPrefix = "substring:"
+
+// AttributePattern is an omit_attributes entry. In YAML it is either a plain
+// pattern string or a mapping that selects the matching mode and, optionally,
+// the redaction mode for the values it flags:
+//
+//	omit_attributes:
+//	  - internal_api_key
+//	  - pattern: token
+//	    match: word
+//	    mode: hash
+type AttributePattern struct {
+	Pattern string        // Internal form, with a "word:" prefix for word mode
+	Mode    RedactionMode // Empty uses the patterns category's mode
+}
+
+// UnmarshalYAML accepts both the string and the mapping form
+func (p *AttributePattern) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = AttributePattern{Pattern: node.Value}
+		return nil
+	}
+
+	var entry struct {
+		Pattern string `yaml:"pattern"`
+		Match   string `yaml:"match"`
+		Mode    string `yaml:"mode"`
+	}
+	if err := node.Decode(&entry); err != nil {
+		return err
+	}
+	if entry.Pattern == "" {
+		return fmt.Errorf("line %d: omit_attributes entry is missing a pattern", node.Line)
+	}
+
+	*p = AttributePattern{}
+	switch entry.Match {
+	case "":
+		p.Pattern = entry.Pattern
+	case AttributeMatchSubstring:
+		p.Pattern = substringMatchPrefix + entry.Pattern
+	case AttributeMatchWord:
+		p.Pattern = wordMatchPrefix + entry.Pattern
+	default:
+		return fmt.Errorf("line %d: invalid match '%s' (expected substring or word)", node.Line, entry.Match)
+	}
+	if entry.Mode != "" {
+		mode, err := parseRedactionMode(entry.Pattern, entry.Mode)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		p.Mode = mode
+	}
+	return nil
+}
+
+// DetectorSetting is a detectors entry. In YAML it is either a boolean that
+// turns the detector on or off, or a mapping that also selects the redaction
+// mode for the values it flags:
+//
+//	detectors:
+//	  jwt: false
+//	  aws_access_key:
+//	    mode: hash
+type DetectorSetting struct {
+	Enabled bool
+	Mode    RedactionMode // Empty uses the detectors category's mode
+}
+
+// UnmarshalYAML accepts both the boolean and the mapping form
+func (d *DetectorSetting) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*d = DetectorSetting{}
+		return node.Decode(&d.Enabled)
+	}
+
+	entry := struct {
+		Enabled *bool  `yaml:"enabled"`
+		Mode    string `yaml:"mode"`
+	}{}
+	if err := node.Decode(&entry); err != nil {
+		return err
+	}
+	// A detector given a mode is on unless it says otherwise
+	*d = DetectorSetting{Enabled: entry.Enabled == nil || *entry.Enabled}
+	if entry.Mode != "" {
+		mode, err := parseRedactionMode("detector", entry.Mode)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		d.Mode = mode
+	}
+	return nil
+}
+
+// attributeMatchingPattern matches an attribute name against patterns,
+// applying the configured word-mode exceptions. The config's own pattern lists
+// use compiled matchers; any other list is matched directly.
+func (m *MergedConfig) attributeMatchingPattern(name string, patterns []string) (string, bool) {
+	switch id := idOf(patterns); {
+	case id == sliceID{}:
+		return "", false
+	case id == idOf(m.OmitAttributes):
+		return m.matchers().local.match(name)
+	case id == idOf(m.PlatformOmitAttributes):
+		return m.matchers().platform.match(name)
+	}
+	return AttributeMatchingPatternExcept(name, patterns, m.AttributeExceptions)
+}
+
+// PlatformSettings are the organization-level filtering settings delivered by
+// service discovery
+type PlatformSettings struct {
+	OmitResourceTypes []string // Additional resource types to omit
+	OmitAttributes    []string // Additional attribute patterns to omit
+
+	// Enforced means filtering is mandatory: organization patterns take
+	// precedence over local preserve rules, which are reported as rejected
+	Enforced bool
+
+	// Mandated values for boolean settings; nil leaves the local value in place
+	HonorTerraformSensitive *bool
+	OmitDataSources         *bool
+}
+
+// RejectedOverride is a local setting that was ignored because it conflicts
+// with the organization's settings
+type RejectedOverride struct {
+	Setting string `json:"setting"` // .cora.yaml setting, e.g. "preserve_attributes"
+	Value   string `json:"value"`   // The local value that was rejected
+	Reason  string `json:"reason"`
+}
+
 // MergeWithPlatformSettings merges the current config with platform-provided settings.
 // Platform settings for additional patterns are additive.
-func (m *MergedConfig) MergeWithPlatformSettings(additionalTypes, additionalAttributes []string) {
-	if len(additionalTypes) > 0 {
-		m.PlatformOmitResourceTypes = additionalTypes
-		m.OmitResourceTypes = append(m.OmitResourceTypes, additionalTypes...)
-	}
-	if len(additionalAttributes) > 0 {
-		m.PlatformOmitAttributes = additionalAttributes
-		m.OmitAttributes = append(m.OmitAttributes, additionalAttributes...)
+func (m *MergedConfig) MergeWithPlatformSettings(settings PlatformSettings) {
+	if len(settings.OmitResourceTypes) > 0 {
+		m.PlatformOmitResourceTypes = settings.OmitResourceTypes
+		m.OmitResourceTypes = append(m.OmitResourceTypes, settings.OmitResourceTypes...)
+	}
+	if len(settings.OmitAttributes) > 0 {
+		m.PlatformOmitAttributes = settings.OmitAttributes
+		m.OmitAttributes = append(m.OmitAttributes, settings.OmitAttributes...)
+	}
+
+	if settings.HonorTerraformSensitive != nil && *settings.HonorTerraformSensitive != m.HonorTerraformSensitive {
+		m.RejectedOverrides = append(m.RejectedOverrides, RejectedOverride{
+			Setting: "honor_terraform_sensitive",
+			Value:   fmt.Sprint(m.HonorTerraformSensitive),
+			Reason:  fmt.Sprintf("organization requires %v", *settings.HonorTerraformSensitive),
+		})
+		m.HonorTerraformSensitive = *settings.HonorTerraformSensitive
+	}
+	if settings.OmitDataSources != nil && *settings.OmitDataSources != m.OmitDataSources {
+		m.RejectedOverrides = append(m.RejectedOverrides, RejectedOverride{
+			Setting: "omit_data_sources",
+			Value:   fmt.Sprint(m.OmitDataSources),
+			Reason:  fmt.Sprintf("organization requires %v", *settings.OmitDataSources),
+		})
+		m.OmitDataSources = *settings.OmitDataSources
+	}
+
+	if !settings.Enforced {
+		return
+	}
+	m.PlatformEnforced = true
+
+	// Enforced filtering has to be verifiable, so the leak scan stays on
+	if m.LeakScan == LeakScanOff {
+		m.RejectedOverrides = append(m.RejectedOverrides, RejectedOverride{
+			Setting: "leak_scan",
+			Value:   string(m.LeakScan),
+			Reason:  "organization enforces filtering",
+		})
+		m.LeakScan = LeakScanAbort
+	}
+
+	// Local preserve entries that would keep an organization-omitted attribute
+	for _, preserved := range m.PreserveAttributes {
+		if pattern, found := m.attributeMatchingPattern(preserved, m.PlatformOmitAttributes); found {
+			m.RejectedOverrides = append(m.RejectedOverrides, RejectedOverride{
+				Setting: "preserve_attributes",
+				Value:   preserved,
+				Reason:  fmt.Sprintf("organization enforces pattern '%s'", pattern),
+			})
+		}
+	}
+	for i := range m.AttributeRules {
+		rule := &m.AttributeRules[i]
+		if rule.Action != AttributeRulePreserve || len(rule.steps) == 0 {
+			continue
+		}
+		if pattern, found := m.attributeMatchingPattern(rule.steps[len(rule.steps)-1], m.PlatformOmitAttributes); found {
+			m.RejectedOverrides = append(m.RejectedOverrides, RejectedOverride{
+				Setting: "attribute_rules",
+				Value:   rule.String(),
+				Reason:  fmt.Sprintf("organization enforces pattern '%s'", pattern),
+			})
+		}
 	}
 }
@@ -0,0 +1,425 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// filterConfiguration filters the configuration section of a plan in place.
+//
+// The configuration section mirrors the HCL source: provider blocks, module
+// calls and resource blocks each carry an "expressions" object whose values are
+// either {"constant_value": ...} / {"references": [...]} expressions or nested
+// blocks of expressions. Literal constants often hold the same secrets that are
+// stripped from resource_changes, so the same attribute and resource type rules apply.
+func filterConfiguration(configuration *object, config *MergedConfig, result *FilterResult) {
+	if providers := getObject(configuration, "provider_config"); providers != nil {
+		for _, key := range providers.orderedKeys() {
+			if provider := getObject(providers, key); provider != nil {
+				filterBlockExpressions(provider, "configuration.provider_config."+key, nil, config, result)
+			}
+		}
+	}
+
+	if rootModule := getObject(configuration, "root_module"); rootModule != nil {
+		filterConfigModule(rootModule, "configuration.", config, result)
+	}
+
+	if config.Allowlist != nil {
+		stripConfigurationValues(configuration)
+	}
+}
+
+// filterConfigModule filters the resources and module calls of a configuration module.
+// pathPrefix is the module address prefix used for omission paths (e.g. "configuration.module.app.").
+func filterConfigModule(module *object, pathPrefix string, config *MergedConfig, result *FilterResult) {
+	// Default values of sensitive variables are as secret as the values passed in
+	if config.HonorTerraformSensitive {
+		variables := getObject(module, "variables")
+		declared := parseSensitiveDeclarations(module)
+		for _, name := range orderedKeysOf(variables) {
+			variable := getObject(variables, name)
+			if !declared.variables[name] || !variable.has("default") {
+				continue
+			}
+			omission := OmittedField{
+				Path:   pathPrefix + "var." + name + ".default",
+				Reason: ReasonSensitiveVariable,
+				Type:   "attribute",
+			}
+			if replacement, keep := applyRedaction(RuleTerraformSensitive, variable.values["default"], &omission, config); keep {
+				variable.set("default", replacement)
+			} else {
+				variable.remove("default")
+			}
+			result.Omissions = append(result.Omissions, omission)
+			result.Summary.OmittedAttributes++
+		}
+	}
+
+	if resources := getArray(module, "resources"); resources != nil {
+		filteredResources := make([]interface{}, 0, len(resources))
+		for _, item := range resources {
+			resource, ok := item.(*object)
+			if !ok {
+				filteredResources = append(filteredResources, item)
+				continue
+			}
+
+			resourcePath := pathPrefix + getString(resource, "address")
+			scope := newRuleScope(config, getString(resource, "type"), strings.TrimPrefix(resourcePath, "configuration."))
+			if omitResource(resourcePath, "", getString(resource, "mode"), getString(resource, "type"), config, result) {
+				captureExpressions(result, resource, scope, config)
+				continue
+			}
+
+			filterBlockExpressions(resource, resourcePath, scope, config, result)
+			filteredResources = append(filteredResources, resource)
+		}
+		module.set("resources", filteredResources)
+	}
+
+	filterConfigOutputs(module, pathPrefix, config, result)
+
+	if moduleCalls := getObject(module, "module_calls"); moduleCalls != nil {
+		for _, name := range append([]string{}, moduleCalls.orderedKeys()...) {
+			call := getObject(moduleCalls, name)
+			if call == nil {
+				continue
+			}
+
+			callPath := pathPrefix + "module." + name
+			childModule := getObject(call, "module")
+
+			// Drop module calls matching omit_modules, including their inputs
+			moduleAddress := strings.TrimPrefix(callPath, "configuration.")
+			if pattern, found := ModuleMatchingPattern(moduleAddress, config.OmitModules); found {
+				omitConfigModule(childModule, callPath+".", moduleAddress, pattern, config, result)
+				moduleCalls.remove(name)
+				continue
+			}
+
+			// Inputs bound to variables the child module declares sensitive
+			if config.HonorTerraformSensitive {
+				if expressions := getObject(call, "expressions"); expressions != nil {
+					declared := parseSensitiveDeclarations(childModule)
+					for _, input := range append([]string{}, expressions.orderedKeys()...) {
+						if !declared.variables[input] {
+							continue
+						}
+						omission := OmittedField{
+							Path:   callPath + "." + input,
+							Reason: ReasonSensitiveVariable,
+							Type:   "attribute",
+						}
+						if !redactExpression(expressions.values[input], RuleTerraformSensitive, &omission, config) {
+							expressions.remove(input)
+						}
+						result.Omissions = append(result.Omissions, omission)
+						result.Summary.OmittedAttributes++
+					}
+				}
+			}
+
+			filterBlockExpressions(call, callPath, nil, config, result)
+
+			if childModule != nil {
+				filterConfigModule(childModule, callPath+".", config, result)
+			}
+		}
+	}
+}
+
+// filterConfigOutputs removes the references to dropped resources and module
+// calls from the output expressions of a configuration module, in place. An
+// expression left with neither references nor a constant is removed.
+func filterConfigOutputs(module *object, pathPrefix string, config *MergedConfig, result *FilterResult) {
+	moduleAddress := strings.TrimSuffix(strings.TrimPrefix(pathPrefix, "configuration."), ".")
+	outputs := getObject(module, "outputs")
+	for _, name := range orderedKeysOf(outputs) {
+		output := getObject(outputs, name)
+		expression := getObject(output, "expression")
+		references := getArray(expression, "references")
+		if len(references) == 0 {
+			continue
+		}
+
+		kept := make([]interface{}, 0, len(references))
+		var dropped []string
+		for _, item := range references {
+			if ref, ok := item.(string); ok {
+				if target, omitted := omittedReference(ref, moduleAddress, config); omitted {
+					if len(dropped) == 0 || dropped[len(dropped)-1] != target {
+						dropped = append(dropped, target)
+					}
+					continue
+				}
+			}
+			kept = append(kept, item)
+		}
+		if len(dropped) == 0 {
+			continue
+		}
+
+		if len(kept) == 0 && !expression.has("constant_value") {
+			output.remove("expression")
+		} else {
+			expression.set("references", kept)
+		}
+		result.Omissions = append(result.Omissions, OmittedField{
+			Path:   pathPrefix + "output." + name + ".expression",
+			Reason: fmt.Sprintf("references omitted %s", strings.Join(dropped, ", ")),
+			Type:   "attribute",
+		})
+		result.Summary.OmittedAttributes++
+	}
+}
+
+// omittedReference reports whether a configuration reference, made in the
+// module at moduleAddress, points into a resource or module call the
+// resource-level rules drop, and returns that resource or module call.
+func omittedReference(ref, moduleAddress string, config *MergedConfig) (string, bool) {
+	parts := strings.Split(stripIndexKeys(ref), ".")
+	if len(parts) < 2 {
+		return "", false
+	}
+
+	mode, resourceType, n := "managed", parts[0], 2
+	switch parts[0] {
+	case "var", "local", "each", "count", "path", "terraform", "self":
+		return "", false
+	case "module":
+		address := "module." + parts[1]
+		if moduleAddress != "" {
+			address = moduleAddress + "." + address
+		}
+		_, found := ModuleMatchingPattern(address, config.OmitModules)
+		return "module." + parts[1], found
+	case "data":
+		if len(parts) < 3 {
+			return "", false
+		}
+		mode, resourceType, n = "data", parts[1], 3
+	}
+
+	target := strings.Join(parts[:n], ".")
+	if mode == "data" && config.OmitDataSources {
+		return target, true
+	}
+	if _, found := ResourceTypeMatchingPattern(resourceType, config.PlatformOmitResourceTypes); found {
+		return target, true
+	}
+	if _, found := ResourceTypeMatchingPattern(resourceType, config.OmitResourceTypes); found {
+		return target, true
+	}
+	if config.Allowlist != nil {
+		if _, found := config.Allowlist.allowsType(resourceType); !found {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// omitConfigModule records every resource in a configuration module and its
+// children as omitted, for a module call dropped by omit_modules
+func omitConfigModule(module *object, pathPrefix, moduleAddress, pattern string, config *MergedConfig, result *FilterResult) {
+	for _, item := range getArray(module, "resources") {
+		if resource, ok := item.(*object); ok {
+			resourcePath := pathPrefix + getString(resource, "address")
+			recordModuleOmission(resourcePath, moduleAddress, pattern, result)
+			captureExpressions(result, resource, newRuleScope(config, getString(resource, "type"), strings.TrimPrefix(resourcePath, "configuration.")), config)
+		}
+	}
+	moduleCalls := getObject(module, "module_calls")
+	for _, name := range orderedKeysOf(moduleCalls) {
+		childModule := getObject(getObject(moduleCalls, name), "module")
+		omitConfigModule(childModule, pathPrefix+"module."+name+".", moduleAddress, pattern, config, result)
+	}
+}
+
+// filterBlockExpressions filters the "expressions" object of a configuration block in place.
+// scope is the rule scope of a resource block, or nil for provider and module blocks.
+func filterBlockExpressions(block *object, basePath string, scope *ruleScope, config *MergedConfig, result *FilterResult) {
+	expressions := getObject(block, "expressions")
+	if expressions == nil {
+		return
+	}
+
+	filtered, omissions := filterExpressions(expressions, basePath, scope, config)
+	block.set("expressions", filtered)
+	result.Omissions = append(result.Omissions, omissions...)
+	result.Summary.OmittedAttributes += len(omissions)
+}
+
+// filterExpressions filters an expressions object, recursing into nested blocks
+// and into object-valued constants (e.g. tags or environment variable maps).
+func filterExpressions(expressions *object, basePath string, scope *ruleScope, config *MergedConfig) (*object, []OmittedField) {
+	filtered := newObject()
+	var omissions []OmittedField
+
+	for _, key := range expressions.orderedKeys() {
+		value := expressions.values[key]
+		attrPath := basePath + "." + key
+		attrScope := scope.child(key)
+
+		omission, preserved := checkAttribute(key, attrPath, attrScope, config)
+		if preserved {
+			if config.PlatformEnforced {
+				omissions = append(omissions, enforcePlatformExpressions(value, attrPath, config)...)
+			}
+			filtered.set(key, value)
+			continue
+		}
+		if omission != nil {
+			if redactExpression(value, RulePatterns, omission, config) {
+				filtered.set(key, value)
+			}
+			omissions = append(omissions, *omission)
+			continue
+		}
+
+		switch v := value.(type) {
+		case *object:
+			if isExpression(v) {
+				if d, found := detectSecretValue(getString(v, "constant_value"), config.Detectors); found {
+					detected := detectorOmission(attrPath, d)
+					if redactExpression(v, RuleDetectors, &detected, config) {
+						filtered.set(key, v)
+					}
+					omissions = append(omissions, detected)
+					continue
+				}
+				omissions = append(omissions, filterConstantValue(v, attrPath, attrScope, config)...)
+				filtered.set(key, v)
+			} else {
+				// Single nested block
+				nestedFiltered, nestedOmissions := filterExpressions(v, attrPath, attrScope, config)
+				filtered.set(key, nestedFiltered)
+				omissions = append(omissions, nestedOmissions...)
+			}
+		case []interface{}:
+			// Repeated nested blocks
+			blocks := make([]interface{}, 0, len(v))
+			for i, item := range v {
+				block, ok := item.(*object)
+				if !ok {
+					blocks = append(blocks, item)
+					continue
+				}
+				nestedFiltered, nestedOmissions := filterExpressions(block, fmt.Sprintf("%s[%d]", attrPath, i), attrScope.index(i), config)
+				blocks = append(blocks, nestedFiltered)
+				omissions = append(omissions, nestedOmissions...)
+			}
+			filtered.set(key, blocks)
+		default:
+			filtered.set(key, value)
+		}
+	}
+
+	return filtered, omissions
+}
+
+// enforcePlatformExpressions is enforcePlatformPatterns for a preserved
+// expression or nested block, in place: the organization's patterns apply to
+// the attributes of nested blocks and inside object and list constants.
+func enforcePlatformExpressions(value interface{}, attrPath string, config *MergedConfig) []OmittedField {
+	var omissions []OmittedField
+	switch v := value.(type) {
+	case *object:
+		if isExpression(v) {
+			if constant, ok := v.get("constant_value"); ok {
+				filtered, enforced := enforcePlatformPatterns(constant, attrPath, config)
+				v.set("constant_value", filtered)
+				omissions = append(omissions, enforced...)
+			}
+			return omissions
+		}
+		for _, key := range append([]string{}, v.orderedKeys()...) {
+			keyPath := attrPath + "." + key
+			if omission := platformAttributeOmission(key, keyPath, config); omission != nil {
+				if !redactExpression(v.values[key], RulePatterns, omission, config) {
+					v.remove(key)
+				}
+				omissions = append(omissions, *omission)
+				continue
+			}
+			omissions = append(omissions, enforcePlatformExpressions(v.values[key], keyPath, config)...)
+		}
+	case []interface{}:
+		for i, item := range v {
+			omissions = append(omissions, enforcePlatformExpressions(item, fmt.Sprintf("%s[%d]", attrPath, i), config)...)
+		}
+	}
+	return omissions
+}
+
+// filterConstantValue filters an object or list constant_value in place
+func filterConstantValue(expression *object, attrPath string, scope *ruleScope, config *MergedConfig) []OmittedField {
+	switch constant := expression.values["constant_value"].(type) {
+	case *object:
+		filtered, omissions := filterAttributes(constant, attrPath, config, nil, nil, scope)
+		expression.set("constant_value", filtered)
+		return omissions
+	case []interface{}:
+		filtered, omissions := filterArray(constant, attrPath, config, nil, nil, scope)
+		expression.set("constant_value", filtered)
+		return omissions
+	}
+	return nil
+}
+
+// redactExpression replaces the constant_value of an omitted expression in place
+// when the rule uses redact or hash mode. References are kept, since they only
+// name other objects. It returns false if the expression should be removed instead.
+func redactExpression(value interface{}, rule string, omission *OmittedField, config *MergedConfig) bool {
+	expression, ok := value.(*object)
+	if !ok || !isExpression(expression) || config.omissionMode(rule, omission) == RedactionOmit {
+		if ok {
+			omission.capture(expression.values["constant_value"], config)
+		}
+		return false
+	}
+	constant, hasConstant := expression.get("constant_value")
+	replacement, _ := applyRedaction(rule, constant, omission, config)
+	if hasConstant {
+		expression.set("constant_value", replacement)
+	}
+	return true
+}
+
+// sensitiveDeclarations holds the names of variables and outputs that a
+// configuration module declares with `sensitive = true`
+type sensitiveDeclarations struct {
+	variables map[string]bool
+	outputs   map[string]bool
+}
+
+// parseSensitiveDeclarations reads the variable and output blocks of a configuration module
+func parseSensitiveDeclarations(module *object) sensitiveDeclarations {
+	declared := sensitiveDeclarations{
+		variables: make(map[string]bool),
+		outputs:   make(map[string]bool),
+	}
+
+	if variables := getObject(module, "variables"); variables != nil {
+		for _, name := range variables.orderedKeys() {
+			if getBool(getObject(variables, name), "sensitive") {
+				declared.variables[name] = true
+			}
+		}
+	}
+	if outputs := getObject(module, "outputs"); outputs != nil {
+		for _, name := range outputs.orderedKeys() {
+			if getBool(getObject(outputs, name), "sensitive") {
+				declared.outputs[name] = true
+			}
+		}
+	}
+
+	return declared
+}
+
+// isExpression reports whether an object is a single expression rather than a nested block
+func isExpression(v *object) bool {
+	return v.has("constant_value") || v.has("references")
+}
@@ -0,0 +1,166 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Detector identifies secret material from a string value, independent of
+// the name of the attribute that holds it.
+type Detector interface {
+	// Name is the identifier used in .cora.yaml and in omission reports
+	Name() string
+	// Detect reports whether the value looks like secret material
+	Detect(value string) bool
+}
+
+// regexDetector matches values against a known secret format
+type regexDetector struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+func (d *regexDetector) Name() string { return d.name }
+
+func (d *regexDetector) Detect(value string) bool {
+	return d.pattern.MatchString(value)
+}
+
+// entropyDetector flags long, whitespace-free strings whose character
+// distribution looks random (high Shannon entropy), such as generated keys.
+type entropyDetector struct {
+	threshold float64 // Minimum entropy in bits per character
+	minLength int     // Shorter strings are never flagged
+}
+
+func (d *entropyDetector) Name() string { return EntropyDetectorName }
+
+func (d *entropyDetector) Detect(value string) bool {
+	if len(value) < d.minLength || strings.ContainsAny(value, " \t\r\n") {
+		return false
+	}
+	return shannonEntropy(value) >= d.threshold
+}
+
+// EntropyDetectorName is the name of the Shannon-entropy heuristic detector
+const EntropyDetectorName = "entropy"
+
+// DefaultEntropyThreshold is the default minimum entropy (bits per character)
+// for the entropy detector. Random base64 runs at roughly 5-6 bits per character,
+// while identifiers and hex digests stay at or below 4.
+const DefaultEntropyThreshold = 4.5
+
+// defaultEntropyMinLength is the minimum string length checked by the entropy detector
+const defaultEntropyMinLength = 20
+
+// regexDetectors are the built-in pattern detectors, keyed by name
+var regexDetectors = map[string]*regexp.Regexp{
+	// AWS access key IDs (long-term and temporary)
+	"aws_access_key": regexp.MustCompile(`\b(AKIA|ASIA|ABIA|ACCA|A3T[A-Z0-9])[A-Z0-9]{16}\b`),
+
+	// Google API keys and service account key files
+	"gcp_key": regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b|"type"\s*:\s*"service_account"`),
+
+	// Azure storage account keys and Entra ID client secrets
+	"azure_key": regexp.MustCompile(`AccountKey=[A-Za-z0-9+/]{86}==|\b[A-Za-z0-9_~.\-]{3}8Q~[A-Za-z0-9_~.\-]{31,34}\b`),
+
+	// GitHub personal access, OAuth, app and refresh tokens
+	"github_token": regexp.MustCompile(`\b(ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,}\b|\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+
+	// PEM-encoded private keys
+	"private_key": regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|ENCRYPTED|PGP) )?PRIVATE KEY( BLOCK)?-----`),
+
+	// JSON Web Tokens
+	"jwt": regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{5,}\.eyJ[A-Za-z0-9_\-]{5,}\.[A-Za-z0-9_\-]{10,}`),
+}
+
+// DefaultDetectors lists which detectors are enabled when .cora.yaml does not
+// say otherwise. The entropy heuristic is off by default because it is noisier.
+var DefaultDetectors = map[string]bool{
+	"aws_access_key":    true,
+	"gcp_key":           true,
+	"azure_key":         true,
+	"github_token":      true,
+	"private_key":       true,
+	"jwt":               true,
+	EntropyDetectorName: false,
+}
+
+// DetectorNames returns the names of all built-in detectors, sorted
+func DetectorNames() []string {
+	names := make([]string, 0, len(DefaultDetectors))
+	for name := range DefaultDetectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// buildDetectors creates the enabled detectors in name order, so that the
+// detector reported for a value is deterministic.
+func buildDetectors(enabled map[string]bool, entropyThreshold float64) ([]Detector, error) {
+	for name := range enabled {
+		if _, ok := DefaultDetectors[name]; !ok {
+			return nil, fmt.Errorf("unknown detector '%s' (available: %s)", name, strings.Join(DetectorNames(), ", "))
+		}
+	}
+
+	var detectors []Detector
+	for _, name := range DetectorNames() {
+		if !enabled[name] {
+			continue
+		}
+		if name == EntropyDetectorName {
+			detectors = append(detectors, &entropyDetector{
+				threshold: entropyThreshold,
+				minLength: defaultEntropyMinLength,
+			})
+			continue
+		}
+		detectors = append(detectors, &regexDetector{name: name, pattern: regexDetectors[name]})
+	}
+	return detectors, nil
+}
+
+// detectSecretValue runs the enabled detectors over a string value and
+// returns the first one that matches.
+func detectSecretValue(value string, detectors []Detector) (Detector, bool) {
+	for _, d := range detectors {
+		if d.Detect(value) {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// detectorOmission builds the omission record for a value flagged by a detector
+func detectorOmission(path string, d Detector) OmittedField {
+	return OmittedField{
+		Path:     path,
+		Reason:   fmt.Sprintf("value matches %s detector", d.Name()),
+		Type:     "attribute",
+		Detector: d.Name(),
+	}
+}
+
+// shannonEntropy returns the Shannon entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,295 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// object is a JSON object that remembers the order of its keys, so that a
+// filtered document serializes back in the same order Terraform produced it.
+//
+// Documents are decoded into a tree of *object, []interface{}, string,
+// json.Number, bool and nil. Numbers are kept as json.Number so large integers
+// survive the round trip without float64 rounding.
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// newObject creates an empty ordered object
+func newObject() *object {
+	return &object{values: make(map[string]interface{})}
+}
+
+// get returns the value stored under key
+func (o *object) get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// has reports whether key is present
+func (o *object) has(key string) bool {
+	_, ok := o.values[key]
+	return ok
+}
+
+// set stores a value, appending the key if it is new and keeping its position otherwise
+func (o *object) set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// remove deletes a key, preserving the order of the remaining keys
+func (o *object) remove(key string) {
+	if _, exists := o.values[key]; !exists {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// orderedKeys returns the keys in document order
+func (o *object) orderedKeys() []string {
+	return o.keys
+}
+
+// len returns the number of keys in the object
+func (o *object) len() int {
+	return len(o.keys)
+}
+
+// MarshalJSON encodes the object with its keys in document order
+func (o *object) MarshalJSON() ([]byte, error) {
+	return encodeJSON(o)
+}
+
+// getObject returns the nested object stored under key, or nil
+func getObject(o *object, key string) *object {
+	if o == nil {
+		return nil
+	}
+	v, _ := o.values[key].(*object)
+	return v
+}
+
+// getArray returns the array stored under key, or nil
+func getArray(o *object, key string) []interface{} {
+	if o == nil {
+		return nil
+	}
+	v, _ := o.values[key].([]interface{})
+	return v
+}
+
+// getString returns the string stored under key, or ""
+func getString(o *object, key string) string {
+	if o == nil {
+		return ""
+	}
+	v, _ := o.values[key].(string)
+	return v
+}
+
+// getBool returns the boolean stored under key, or false
+func getBool(o *object, key string) bool {
+	if o == nil {
+		return false
+	}
+	v, _ := o.values[key].(bool)
+	return v
+}
+
+// orderedKeysOf returns the keys of o in document order, or nil if o is nil
+func orderedKeysOf(o *object) []string {
+	if o == nil {
+		return nil
+	}
+	return o.keys
+}
+
+// decodeObject parses a JSON document whose top level must be an object
+func decodeObject(data []byte) (*object, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	value, err := decodeValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+
+	obj, ok := value.(*object)
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON object at the top level")
+	}
+	return obj, nil
+}
+
+// decodeValue reads the next complete JSON value from the decoder
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return decodeFrom(dec, tok)
+}
+
+// decodeFrom reads the rest of a JSON value whose first token has already been read
+func decodeFrom(dec *json.Decoder, tok json.Token) (interface{}, error) {
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		// string, json.Number, bool or nil
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := newObject()
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyTok.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid object key %v", keyTok)
+			}
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.set(key, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+
+	case '[':
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected delimiter %v", delim)
+	}
+}
+
+// skipValue reads past the next complete JSON value without keeping it
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			if delim == '{' || delim == '[' {
+				depth++
+			} else {
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// jsonWriter is the subset of bytes.Buffer and bufio.Writer the encoder needs
+type jsonWriter interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+// encodeJSON serializes a decoded document tree
+func encodeJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeValue writes a single value of a decoded document tree to buf
+func encodeValue(buf jsonWriter, v interface{}) error {
+	switch val := v.(type) {
+	case *object:
+		buf.WriteByte('{')
+		for i, key := range val.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeString(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := encodeValue(buf, val.values[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range val {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeValue(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case string:
+		return encodeString(buf, val)
+	case json.Number:
+		buf.WriteString(val.String())
+	case bool:
+		if val {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case nil:
+		buf.WriteString("null")
+	default:
+		// Values inserted by the filter itself (e.g. plain Go types)
+		encoded, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		buf.Write(encoded)
+	}
+	return nil
+}
+
+// encodeString writes s as a JSON string using the same escaping as encoding/json
+func encodeString(buf jsonWriter, s string) error {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	buf.Write(encoded)
+	return nil
+}
@@ -0,0 +1,515 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Many attributes hold whole documents encoded as strings: Helm values, ECS
+// container definitions, Kubernetes manifests, cloud-init user data and IAM
+// policies. The filter decodes these, applies the name-based rules and
+// detectors inside them, and encodes them again, so a password in Helm values
+// is removed like any other. Omissions inside a document are addressed with a
+// JSON pointer after a "#", e.g. helm_release.app.values[0]#/db/password.
+
+// Encodings of embedded documents
+const (
+	embeddedJSON = "json"
+	embeddedYAML = "yaml"
+)
+
+// maxEmbeddedDepth limits how deeply documents inside documents are decoded
+const maxEmbeddedDepth = 3
+
+// minEmbeddedBase64 is the shortest base64 string decoded as a document
+const minEmbeddedBase64 = 16
+
+// filterEmbedded filters a string holding a JSON or YAML document, optionally
+// base64 encoded. It returns the string to keep in its place and the omissions
+// inside it, or false if value is not a document. The original string is kept
+// unless something inside it was omitted.
+func filterEmbedded(value, path string, config *MergedConfig, depth int) (string, []OmittedField, bool) {
+	if !config.EmbeddedDocuments || depth >= maxEmbeddedDepth {
+		return "", nil, false
+	}
+
+	text, isBase64 := value, false
+	if decoded, ok := decodeEmbeddedBase64(value); ok {
+		text, isBase64 = decoded, true
+	}
+
+	docs, encoding, ok := parseEmbedded(text)
+	if !ok {
+		return "", nil, false
+	}
+
+	var omissions []OmittedField
+	for i, doc := range docs {
+		docPath := path + "#"
+		if len(docs) > 1 {
+			// Each document of a multi-document YAML stream gets its own index
+			docPath = fmt.Sprintf("%s#%d", path, i)
+		}
+		filtered, _, docOmissions := filterDocumentValue(doc, docPath, config, depth)
+		docs[i] = filtered
+		omissions = append(omissions, docOmissions...)
+	}
+	if len(omissions) == 0 {
+		return value, nil, true
+	}
+
+	encoded, err := encodeEmbedded(docs, encoding, text)
+	if err != nil {
+		// Keeping a document we could not re-encode would keep the secrets too
+		return RedactedPlaceholder, []OmittedField{{
+			Path:   path,
+			Reason: fmt.Sprintf("embedded %s document could not be re-encoded after filtering", encoding),
+			Type:   "attribute",
+			values: []string{value},
+		}}, true
+	}
+	if isBase64 {
+		encoded = base64.StdEncoding.EncodeToString([]byte(encoded))
+	}
+	return encoded, omissions, true
+}
+
+// decodeEmbeddedBase64 decodes a standard base64 string whose content is text
+func decodeEmbeddedBase64(value string) (string, bool) {
+	if len(value) < minEmbeddedBase64 || len(value)%4 != 0 {
+		return "", false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' || c == '=') {
+			return "", false
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || !utf8.Valid(decoded) {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// parseEmbedded parses text as a JSON document or a stream of YAML documents.
+// Only objects and arrays count as documents: a YAML stream that is a single
+// scalar is just text, and so is YAML whose aliases expand past the limits of
+// yamlToValue.
+func parseEmbedded(text string) ([]interface{}, string, bool) {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return nil, "", false
+	}
+
+	if first := trimmed[0]; first == '{' || first == '[' {
+		dec := json.NewDecoder(strings.NewReader(trimmed))
+		dec.UseNumber()
+		doc, err := decodeValue(dec)
+		if err == nil {
+			if _, err := dec.Token(); err == io.EOF {
+				return []interface{}{doc}, embeddedJSON, true
+			}
+		}
+		// Flow-style YAML such as {a: 1} is tried below
+	}
+
+	// Block-style YAML spans several lines; a single line of text is far more
+	// likely to be a plain value that happens to contain a colon
+	if !strings.Contains(trimmed, "\n") && trimmed[0] != '{' && trimmed[0] != '[' {
+		return nil, "", false
+	}
+	dec := yaml.NewDecoder(strings.NewReader(text))
+	var docs []interface{}
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, "", false
+		}
+		if len(node.Content) == 0 {
+			continue
+		}
+		if kind := node.Content[0].Kind; kind != yaml.MappingNode && kind != yaml.SequenceNode {
+			return nil, "", false
+		}
+		doc, err := yamlToValue(node.Content[0])
+		if err != nil {
+			return nil, "", false
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		return nil, "", false
+	}
+	return docs, embeddedYAML, true
+}
+
+// encodeEmbedded encodes filtered documents in their original encoding. JSON
+// keeps the original's layout: compact, or indented if it spanned lines.
+func encodeEmbedded(docs []interface{}, encoding, original string) (string, error) {
+	if encoding == embeddedJSON {
+		encoded, err := encodeJSON(docs[0])
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(strings.TrimSpace(original), "\n") {
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, encoded, "", "  "); err != nil {
+				return "", err
+			}
+			encoded = indented.Bytes()
+		}
+		if strings.HasSuffix(original, "\n") {
+			encoded = append(encoded, '\n')
+		}
+		return string(encoded), nil
+	}
+
+	// Edit the original nodes, so comments, quoting and key order survive
+	// wherever nothing was removed
+	nodes, err := decodeYAMLDocuments(original)
+	if err == nil && len(nodes) == len(docs) {
+		for i, node := range nodes {
+			if err = patchYAML(node.Content[0], docs[i]); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			encoded, err := encodeYAML(nodes, original)
+			// An alias whose anchor was removed no longer parses; fall back
+			// to encoding the filtered documents from scratch
+			if _, _, ok := parseEmbedded(encoded); err == nil && ok {
+				return encoded, nil
+			}
+		}
+	}
+
+	nodes = nodes[:0]
+	for _, doc := range docs {
+		node, err := valueToYAML(doc)
+		if err != nil {
+			return "", err
+		}
+		nodes = append(nodes, node)
+	}
+	return encodeYAML(nodes, original)
+}
+
+// encodeYAML encodes a stream of YAML documents
+func encodeYAML(nodes []*yaml.Node, original string) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, node := range nodes {
+		if err := enc.Encode(node); err != nil {
+			return "", err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	encoded := buf.String()
+	// cloud-init reads the first line to tell the format apart, so keep it
+	if strings.HasPrefix(original, "#cloud-config") && !strings.HasPrefix(encoded, "#cloud-config") {
+		encoded = "#cloud-config\n" + encoded
+	}
+	return encoded, nil
+}
+
+// decodeYAMLDocuments decodes the non-empty documents of a YAML stream, the
+// ones parseEmbedded returns
+func decodeYAMLDocuments(text string) ([]*yaml.Node, error) {
+	dec := yaml.NewDecoder(strings.NewReader(text))
+	var nodes []*yaml.Node
+	for {
+		node := &yaml.Node{}
+		if err := dec.Decode(node); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nodes, nil
+			}
+			return nil, err
+		}
+		if len(node.Content) > 0 {
+			nodes = append(nodes, node)
+		}
+	}
+}
+
+// patchYAML edits a YAML node in place to match its filtered value. Members
+// that were removed are dropped and values that were replaced are encoded
+// anew; everything else is left as it was.
+func patchYAML(node *yaml.Node, value interface{}) error {
+	original, err := yamlToValue(node)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(original, value) {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case *object:
+		if node.Kind == yaml.MappingNode {
+			content := make([]*yaml.Node, 0, len(node.Content))
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				if !v.has(key) {
+					continue
+				}
+				if err := patchYAML(node.Content[i+1], v.values[key]); err != nil {
+					return err
+				}
+				content = append(content, node.Content[i], node.Content[i+1])
+			}
+			node.Content = content
+			return nil
+		}
+	case []interface{}:
+		// Items removed from a sequence cannot be matched up with the
+		// original ones, so only sequences of the same length are patched
+		if node.Kind == yaml.SequenceNode && len(node.Content) == len(v) {
+			for i, item := range v {
+				if err := patchYAML(node.Content[i], item); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	replacement, err := valueToYAML(value)
+	if err != nil {
+		return err
+	}
+	replacement.HeadComment, replacement.LineComment, replacement.FootComment = node.HeadComment, node.LineComment, node.FootComment
+	*node = *replacement
+	return nil
+}
+
+// filterDocumentValue filters a value inside an embedded document in place.
+// It returns the value to keep and false if the value should be removed.
+func filterDocumentValue(value interface{}, path string, config *MergedConfig, depth int) (interface{}, bool, []OmittedField) {
+	switch v := value.(type) {
+	case *object:
+		return v, true, filterDocumentObject(v, path, config, depth)
+	case []interface{}:
+		var omissions []OmittedField
+		kept := make([]interface{}, 0, len(v))
+		for i, item := range v {
+			filtered, keep, itemOmissions := filterDocumentValue(item, fmt.Sprintf("%s/%d", path, i), config, depth)
+			omissions = append(omissions, itemOmissions...)
+			if keep {
+				kept = append(kept, filtered)
+			}
+		}
+		return kept, true, omissions
+	case string:
+		if filtered, omissions, ok := filterEmbedded(v, path, config, depth+1); ok {
+			return filtered, true, omissions
+		}
+		if d, found := detectSecretValue(v, config.Detectors); found {
+			omission := detectorOmission(path, d)
+			replacement, keep := applyRedaction(RuleDetectors, value, &omission, config)
+			return replacement, keep, []OmittedField{omission}
+		}
+	}
+	return value, true, nil
+}
+
+// filterDocumentObject applies the name-based rules to the members of an
+// object inside an embedded document. Scoped attribute rules address
+// resource attributes, so they do not apply here.
+//
+// Documents often list settings as name/value pairs, such as the environment
+// of an ECS container definition ({"name": "DB_PASSWORD", "value": "..."}).
+// The name of such a pair is checked as if it were the key of the value.
+func filterDocumentObject(obj *object, path string, config *MergedConfig, depth int) []OmittedField {
+	var omissions []OmittedField
+
+	if name, ok := obj.values["name"].(string); ok && obj.has("value") {
+		valuePath := path + "/value"
+		if omission, preserved := checkAttribute(name, valuePath, nil, config); omission != nil && !preserved {
+			omission.Reason = fmt.Sprintf("name '%s' %s", name, omission.Reason)
+			if replacement, keep := applyRedaction(RulePatterns, obj.values["value"], omission, config); keep {
+				obj.set("value", replacement)
+			} else {
+				obj.remove("value")
+			}
+			omissions = append(omissions, *omission)
+		}
+	}
+
+	for _, key := range append([]string{}, obj.orderedKeys()...) {
+		value := obj.values[key]
+		keyPath := path + "/" + escapePointer(key)
+
+		omission, preserved := checkAttribute(key, keyPath, nil, config)
+		if preserved {
+			if config.PlatformEnforced {
+				omissions = append(omissions, enforceDocumentPatterns(value, keyPath, config)...)
+			}
+			continue
+		}
+		if omission != nil {
+			if replacement, keep := applyRedaction(RulePatterns, value, omission, config); keep {
+				obj.set(key, replacement)
+			} else {
+				obj.remove(key)
+			}
+			omissions = append(omissions, *omission)
+			continue
+		}
+
+		filtered, keep, valueOmissions := filterDocumentValue(value, keyPath, config, depth)
+		if keep {
+			obj.set(key, filtered)
+		} else {
+			obj.remove(key)
+		}
+		omissions = append(omissions, valueOmissions...)
+	}
+	return omissions
+}
+
+// enforceDocumentPatterns is enforcePlatformPatterns for a preserved value
+// inside an embedded document, in place and with JSON pointer paths
+func enforceDocumentPatterns(value interface{}, path string, config *MergedConfig) []OmittedField {
+	var omissions []OmittedField
+	switch v := value.(type) {
+	case *object:
+		for _, key := range append([]string{}, v.orderedKeys()...) {
+			keyPath := path + "/" + escapePointer(key)
+			if omission := platformAttributeOmission(key, keyPath, config); omission != nil {
+				if replacement, keep := applyRedaction(RulePatterns, v.values[key], omission, config); keep {
+					v.set(key, replacement)
+				} else {
+					v.remove(key)
+				}
+				omissions = append(omissions, *omission)
+				continue
+			}
+			omissions = append(omissions, enforceDocumentPatterns(v.values[key], keyPath, config)...)
+		}
+	case []interface{}:
+		for i, item := range v {
+			omissions = append(omissions, enforceDocumentPatterns(item, fmt.Sprintf("%s/%d", path, i), config)...)
+		}
+	}
+	return omissions
+}
+
+// escapePointer escapes a key for use in a JSON pointer (RFC 6901)
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// Limits on expanding YAML aliases, which can make a small document expand
+// into an enormous one ("billion laughs")
+const (
+	maxYAMLAliasDepth = 8
+	maxYAMLNodes      = 100000
+)
+
+// errYAMLTooLarge is returned for YAML whose aliases expand past the limits
+var errYAMLTooLarge = errors.New("yaml aliases expand past the size limit")
+
+// yamlToValue converts a YAML node into the document tree used for JSON, so
+// the same filtering applies to both. Aliases are expanded, up to
+// maxYAMLAliasDepth aliases deep and maxYAMLNodes nodes in all.
+func yamlToValue(node *yaml.Node) (interface{}, error) {
+	budget := maxYAMLNodes
+	return yamlNodeToValue(node, 0, &budget)
+}
+
+func yamlNodeToValue(node *yaml.Node, aliases int, budget *int) (interface{}, error) {
+	if *budget--; *budget < 0 {
+		return nil, errYAMLTooLarge
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlNodeToValue(node.Content[0], aliases, budget)
+	case yaml.AliasNode:
+		if aliases >= maxYAMLAliasDepth {
+			return nil, errYAMLTooLarge
+		}
+		return yamlNodeToValue(node.Alias, aliases+1, budget)
+	case yaml.MappingNode:
+		obj := newObject()
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := yamlNodeToValue(node.Content[i+1], aliases, budget)
+			if err != nil {
+				return nil, err
+			}
+			obj.set(node.Content[i].Value, value)
+		}
+		return obj, nil
+	case yaml.SequenceNode:
+		items := make([]interface{}, 0, len(node.Content))
+		for _, child := range node.Content {
+			item, err := yamlNodeToValue(child, aliases, budget)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+
+	var scalar interface{}
+	if err := node.Decode(&scalar); err != nil {
+		return nil, err
+	}
+	return scalar, nil
+}
+
+// valueToYAML converts a document tree back into a YAML node, keeping the
+// order of object keys
+func valueToYAML(value interface{}) (*yaml.Node, error) {
+	switch v := value.(type) {
+	case *object:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range v.orderedKeys() {
+			keyNode := &yaml.Node{}
+			if err := keyNode.Encode(key); err != nil {
+				return nil, err
+			}
+			valueNode, err := valueToYAML(v.values[key])
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, keyNode, valueNode)
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			itemNode, err := valueToYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, itemNode)
+		}
+		return node, nil
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
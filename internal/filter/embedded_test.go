@@ -0,0 +1,179 @@
+package filter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFilterEmbeddedDocuments(t *testing.T) {
+	containerDefinitions := `[{"name":"app","image":"app:1","environment":[{"name":"DB_PASSWORD","value":"hunter2-ecs"},{"name":"LOG_LEVEL","value":"info"}]}]`
+	helmValues := "image:\n  tag: \"1.2\"\ndb:\n  host: db.internal\n  password: hunter2-helm\n"
+	userData := base64.StdEncoding.EncodeToString([]byte("#cloud-config\nwrite_files:\n  - path: /etc/app.conf\n    content: ok\napi_key: hunter2-userdata\n"))
+	policy := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}]}`
+
+	attrs := map[string]interface{}{
+		"id":                    "app",
+		"container_definitions": containerDefinitions,
+		"values":                []interface{}{helmValues},
+		"user_data":             userData,
+		"policy":                policy,
+		"description":           "Note: this line has a colon",
+	}
+	state := map[string]interface{}{
+		"version": 4,
+		"resources": []interface{}{map[string]interface{}{
+			"mode":      "managed",
+			"type":      "example_app",
+			"name":      "main",
+			"instances": []interface{}{map[string]interface{}{"attributes": attrs}},
+		}},
+	}
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Filter(stateJSON, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+
+	omitted := make(map[string]string)
+	for _, o := range result.Omissions {
+		omitted[o.Path] = o.Reason
+	}
+	for _, path := range []string{
+		"example_app.main.container_definitions#/0/environment/0/value",
+		"example_app.main.values[0]#/db/password",
+		"example_app.main.user_data#/api_key",
+	} {
+		if _, ok := omitted[path]; !ok {
+			t.Errorf("Expected %s to be omitted, got %v", path, omitted)
+		}
+	}
+	if reason := omitted["example_app.main.container_definitions#/0/environment/0/value"]; !strings.HasPrefix(reason, "name 'DB_PASSWORD' ") {
+		t.Errorf("Expected the reason to name the pair, got %q", reason)
+	}
+
+	filtered, err := decodeObject(result.FilteredJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance := getArray(getArray(filtered, "resources")[0].(*object), "instances")[0].(*object)
+	kept := getObject(instance, "attributes")
+
+	if got := getString(kept, "container_definitions"); strings.Contains(got, "hunter2") || !strings.Contains(got, `"LOG_LEVEL"`) {
+		t.Errorf("Unexpected container_definitions: %s", got)
+	}
+	if got := getArray(kept, "values")[0].(string); strings.Contains(got, "hunter2") || !strings.Contains(got, "host: db.internal") {
+		t.Errorf("Unexpected Helm values: %s", got)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(getString(kept, "user_data"))
+	if err != nil {
+		t.Fatalf("Expected user_data to stay base64 encoded: %v", err)
+	}
+	if got := string(decoded); strings.Contains(got, "hunter2") || !strings.HasPrefix(got, "#cloud-config\n") || !strings.Contains(got, "/etc/app.conf") {
+		t.Errorf("Unexpected user data: %s", got)
+	}
+
+	// Documents with nothing to remove, and plain text, are left byte for byte
+	if got := getString(kept, "policy"); got != policy {
+		t.Errorf("Expected the policy to be unchanged, got %s", got)
+	}
+	if got := getString(kept, "description"); got != attrs["description"] {
+		t.Errorf("Expected the description to be unchanged, got %s", got)
+	}
+}
+
+func TestParseEmbedded(t *testing.T) {
+	tests := []struct {
+		text         string
+		wantEncoding string
+		wantDocs     int
+	}{
+		{`{"a": 1}`, embeddedJSON, 1},
+		{`[1, 2]`, embeddedJSON, 1},
+		{"a: 1\nb: 2\n", embeddedYAML, 1},
+		{"kind: Secret\n---\nkind: ConfigMap\n", embeddedYAML, 2},
+		{"{a: 1}", embeddedYAML, 1},
+		{"key: value", "", 0},
+		{"#!/bin/bash\necho hello\n", "", 0},
+		{"just some text", "", 0},
+		{"{not json", "", 0},
+	}
+
+	for _, tt := range tests {
+		docs, encoding, ok := parseEmbedded(tt.text)
+		if tt.wantDocs == 0 {
+			if ok {
+				t.Errorf("parseEmbedded(%q) parsed as %s", tt.text, encoding)
+			}
+			continue
+		}
+		if !ok || encoding != tt.wantEncoding || len(docs) != tt.wantDocs {
+			t.Errorf("parseEmbedded(%q) = %d docs, %q, %v", tt.text, len(docs), encoding, ok)
+		}
+	}
+}
+
+func TestFilterEmbeddedDisabled(t *testing.T) {
+	config := DefaultConfig()
+	config.EmbeddedDocuments = false
+
+	if _, _, ok := filterEmbedded(`{"password": "hunter2"}`, "x.y.z", config, 0); ok {
+		t.Errorf("Expected embedded documents to be left alone when disabled")
+	}
+}
+
+func TestFilterEmbeddedYAMLKeepsLayout(t *testing.T) {
+	values := `# Helm values for the app
+image:
+  repository: app # pinned below
+  tag: "1.20"
+replicas: 0x10
+db:
+  host: db.internal
+  password: hunter2-helm
+`
+	filtered, omissions, ok := filterEmbedded(values, "helm_release.app.values[0]", DefaultConfig(), 0)
+	if !ok || len(omissions) != 1 {
+		t.Fatalf("Expected one omission, got %v", omissions)
+	}
+	want := strings.Replace(values, "  password: hunter2-helm\n", "", 1)
+	if filtered != want {
+		t.Errorf("Expected only the password line to go, got:\n%s", filtered)
+	}
+
+	// An alias of a removed value is encoded from scratch instead
+	aliased := "db:\n  password: &pw hunter2-helm\ncopy: *pw\n"
+	filtered, _, ok = filterEmbedded(aliased, "helm_release.app.values[0]", DefaultConfig(), 0)
+	if _, _, parsed := parseEmbedded(filtered); !ok || !parsed || strings.Contains(filtered, "*pw") {
+		t.Errorf("Expected valid YAML without the dangling alias, got:\n%s", filtered)
+	}
+}
+
+func TestParseEmbeddedLimitsAliasExpansion(t *testing.T) {
+	laughs := "a: &a [lol, lol, lol, lol, lol, lol, lol, lol, lol]\n"
+	for _, name := range []string{"b", "c", "d", "e", "f", "g", "h", "i"} {
+		prev := string(rune(name[0] - 1))
+		laughs += fmt.Sprintf("%s: &%s [*%s, *%s, *%s, *%s, *%s, *%s, *%s, *%s, *%s]\n", name, name, prev, prev, prev, prev, prev, prev, prev, prev, prev)
+	}
+	if _, _, ok := parseEmbedded(laughs); ok {
+		t.Errorf("Expected YAML expanding to a billion nodes to be left as text")
+	}
+
+	deep := "a0: &a0 x\n"
+	for i := 1; i <= maxYAMLAliasDepth+1; i++ {
+		deep += fmt.Sprintf("a%d: &a%d {v: *a%d}\n", i, i, i-1)
+	}
+	if _, _, ok := parseEmbedded(deep); ok {
+		t.Errorf("Expected aliases nested past the depth limit to be left as text")
+	}
+
+	if _, _, ok := parseEmbedded("base: &base {a: 1}\ncopy: *base\n"); !ok {
+		t.Errorf("Expected a plain alias to be expanded")
+	}
+}
@@ -0,0 +1,528 @@
+package filter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Results of an explain step
+const (
+	ExplainMatch   = "match"
+	ExplainNoMatch = "no match"
+	ExplainSkipped = "skipped"
+)
+
+// Explanation traces how the filter decided whether to keep a resource or
+// attribute, for `cora filter --explain`
+type Explanation struct {
+	Target  string        `json:"target"`
+	Steps   []ExplainStep `json:"steps"`
+	Verdict string        `json:"verdict"`          // "omitted", "redacted", "hashed", "preserved" or "kept"
+	Reason  string        `json:"reason,omitempty"` // Reason recorded for the omission, if any
+	Note    string        `json:"note,omitempty"`
+}
+
+// ExplainStep is one check the filter made, in the order it makes them
+type ExplainStep struct {
+	Subject string `json:"subject"`          // Resource address or attribute path checked
+	Check   string `json:"check"`            // Setting or rule checked, e.g. "omit_attributes"
+	Result  string `json:"result"`           // ExplainMatch, ExplainNoMatch or ExplainSkipped
+	Detail  string `json:"detail,omitempty"` // Matching pattern or why the check was skipped
+	Source  string `json:"source,omitempty"` // Where the matching rule came from, e.g. ".cora.yaml:12"
+}
+
+// Explain traces the decisions the filter makes for target, a resource
+// address optionally followed by an attribute path (e.g.
+// module.db.aws_db_instance.main.password). The name-based rules are replayed
+// in the order the filter checks them; Terraform markers, provider schemas and
+// value detectors depend on the document, so they are read from result, the
+// outcome of filtering it.
+func Explain(target string, result *FilterResult, config *MergedConfig) *Explanation {
+	e := &Explanation{Target: target, Verdict: "kept"}
+
+	addr, ok := parseExplainTarget(target)
+	if !ok {
+		e.Note = "not a resource address; only the filter result is shown"
+		e.applyResult(result, target)
+		return e
+	}
+
+	if e.explainResource(addr, config) {
+		e.confirm(result, addr.resource)
+		return e
+	}
+
+	// Each attribute along the path is checked in turn; a decision on a parent
+	// covers everything below it, except that the enforced organization
+	// patterns still apply below a preserved attribute
+	scope := newRuleScope(config, addr.resourceType, addr.resource)
+	path := addr.resource
+	enforcedOnly := false
+	for i, step := range addr.steps {
+		if strings.HasPrefix(step, "[") {
+			path += step
+			scope = scope.child(step)
+			if !enforcedOnly && e.explainRule(path, scope, config) {
+				if enforcedOnly = e.preservedUnderEnforcement(config); !enforcedOnly {
+					break
+				}
+			}
+			continue
+		}
+		path += "." + step
+		scope = scope.child(step)
+		if enforcedOnly {
+			if e.explainEnforced(step, path, config) {
+				break
+			}
+			continue
+		}
+		if i == 0 && e.explainAllowlist(addr.resourceType, step, path, config) {
+			break
+		}
+		if e.explainAttribute(step, path, scope, config) {
+			if enforcedOnly = e.preservedUnderEnforcement(config); !enforcedOnly {
+				break
+			}
+			continue
+		}
+		if e.applyResult(result, path) {
+			break
+		}
+	}
+	switch e.Verdict {
+	case "kept":
+		// Nothing in the result either: no marker or detector fired
+		if len(addr.steps) > 0 {
+			if config.HonorTerraformSensitive {
+				e.add(path, "honor_terraform_sensitive", ExplainNoMatch, "", "")
+			} else {
+				e.add(path, "honor_terraform_sensitive", ExplainSkipped, "disabled", config.ruleSource("honor_terraform_sensitive", "", false))
+			}
+			if config.ProviderSchema != nil {
+				e.add(path, "provider_schema", ExplainNoMatch, "", "")
+			} else {
+				e.add(path, "provider_schema", ExplainSkipped, "no schema given", "")
+			}
+			e.add(path, "detectors", ExplainNoMatch, "", "")
+		}
+	case "preserved":
+	default:
+		e.confirm(result, path)
+	}
+	return e
+}
+
+// explainAddress is a parsed explain target
+type explainAddress struct {
+	module       string   // Module address, or "" for the root module
+	mode         string   // "managed" or "data"
+	resourceType string   // e.g. aws_db_instance
+	resource     string   // Full resource address, e.g. module.db.aws_db_instance.main[0]
+	steps        []string // Attribute path steps, e.g. "settings", "[0]", "value"
+}
+
+// parseExplainTarget splits a target into its resource address and attribute path
+func parseExplainTarget(target string) (explainAddress, bool) {
+	steps := parseAttributePath(target)
+	var addr explainAddress
+	var resource []string
+
+	// Module path: module.<name>[<key>] ...
+	for len(steps) >= 2 && steps[0] == "module" {
+		n := 2
+		if len(steps) > 2 && strings.HasPrefix(steps[2], "[") {
+			n = 3
+		}
+		resource = append(resource, "module."+strings.Join(steps[1:n], ""))
+		steps = steps[n:]
+	}
+	addr.module = strings.Join(resource, ".")
+
+	addr.mode = "managed"
+	if len(steps) > 0 && steps[0] == "data" {
+		addr.mode = "data"
+		resource = append(resource, "data")
+		steps = steps[1:]
+	}
+
+	if len(steps) < 2 || strings.HasPrefix(steps[0], "[") || strings.HasPrefix(steps[1], "[") {
+		return addr, false
+	}
+	addr.resourceType = steps[0]
+	name := steps[1]
+	steps = steps[2:]
+	if len(steps) > 0 && strings.HasPrefix(steps[0], "[") {
+		name += steps[0]
+		steps = steps[1:]
+	}
+	resource = append(resource, addr.resourceType, name)
+	addr.resource = strings.Join(resource, ".")
+	addr.steps = steps
+	return addr, true
+}
+
+// add appends a step
+func (e *Explanation) add(subject, check, result, detail, source string) {
+	e.Steps = append(e.Steps, ExplainStep{Subject: subject, Check: check, Result: result, Detail: detail, Source: source})
+}
+
+// decide records the verdict reached by a matching step
+func (e *Explanation) decide(verdict, reason string) bool {
+	e.Verdict, e.Reason = verdict, reason
+	return true
+}
+
+// explainResource replays omitResource. It returns true if the resource is dropped.
+func (e *Explanation) explainResource(addr explainAddress, config *MergedConfig) bool {
+	subject := addr.resource
+
+	if addr.module == "" {
+		e.add(subject, "omit_modules", ExplainSkipped, "not in a module", "")
+	} else if pattern, found := ModuleMatchingPattern(addr.module, config.OmitModules); found {
+		e.add(subject, "omit_modules", ExplainMatch, pattern, config.ruleSource("omit_modules", pattern, false))
+		return e.decide("omitted", fmt.Sprintf("module '%s' matches omit pattern '%s'", addr.module, pattern))
+	} else {
+		e.add(subject, "omit_modules", ExplainNoMatch, "", "")
+	}
+
+	if addr.mode != "data" {
+		e.add(subject, "omit_data_sources", ExplainSkipped, "not a data source", "")
+	} else if config.OmitDataSources {
+		e.add(subject, "omit_data_sources", ExplainMatch, "true", config.ruleSource("omit_data_sources", "", false))
+		return e.decide("omitted", ReasonDataSource)
+	} else {
+		e.add(subject, "omit_data_sources", ExplainNoMatch, "false", config.ruleSource("omit_data_sources", "", false))
+	}
+
+	if pattern, found := ResourceTypeMatchingPattern(addr.resourceType, config.PlatformOmitResourceTypes); found {
+		e.add(subject, "organization omit_resource_types", ExplainMatch, pattern, config.ruleSource("omit_resource_types", pattern, true))
+		return e.decide("omitted", resourceTypeReason(addr.resourceType, pattern))
+	}
+	e.add(subject, "organization omit_resource_types", ExplainNoMatch, "", "")
+
+	if pattern, found := ResourceTypeMatchingPattern(addr.resourceType, config.OmitResourceTypes); found {
+		e.add(subject, "omit_resource_types", ExplainMatch, pattern, config.ruleSource("omit_resource_types", pattern, false))
+		return e.decide("omitted", resourceTypeReason(addr.resourceType, pattern))
+	}
+	e.add(subject, "omit_resource_types", ExplainNoMatch, "", "")
+
+	if config.Allowlist != nil {
+		source := config.ruleSource("allowlist", "", false)
+		if entry, found := config.Allowlist.allowsType(addr.resourceType); found {
+			e.add(subject, "allowlist resource_types", ExplainMatch, entry, source)
+		} else {
+			e.add(subject, "allowlist resource_types", ExplainNoMatch, "", source)
+			return e.decide("omitted", ReasonNotAllowlisted)
+		}
+	}
+	return false
+}
+
+// explainAllowlist checks a top-level attribute against the allowlist. It
+// returns true if the allowlist drops the attribute.
+func (e *Explanation) explainAllowlist(resourceType, key, path string, config *MergedConfig) bool {
+	if config.Allowlist == nil {
+		return false
+	}
+	source := config.ruleSource("allowlist", "", false)
+	if entry, found := config.Allowlist.allowsAttribute(resourceType, key); found {
+		e.add(path, "allowlist attributes", ExplainMatch, entry, source)
+		return false
+	}
+	e.add(path, "allowlist attributes", ExplainNoMatch, "", source)
+	return e.decide("omitted", ReasonNotAllowlisted)
+}
+
+// explainAttribute replays checkAttribute for one attribute name, in the same
+// order. It returns true once a rule decides the attribute.
+func (e *Explanation) explainAttribute(key, path string, scope *ruleScope, config *MergedConfig) bool {
+	if config.PlatformEnforced && e.explainEnforced(key, path, config) {
+		return true
+	}
+
+	if e.explainRule(path, scope, config) {
+		return true
+	}
+
+	for _, pattern := range config.PreserveAttributes {
+		if strings.EqualFold(key, pattern) {
+			e.add(path, "preserve_attributes", ExplainMatch, pattern, config.ruleSource("preserve_attributes", pattern, false))
+			return e.decide("preserved", "")
+		}
+	}
+	e.add(path, "preserve_attributes", ExplainNoMatch, "", "")
+
+	if pattern, found := config.attributeMatchingPattern(key, config.PlatformOmitAttributes); found {
+		e.add(path, "organization omit_attributes", ExplainMatch, pattern, config.ruleSource("omit_attributes", pattern, true))
+		return e.decide("omitted", fmt.Sprintf("matches pattern '%s'", pattern))
+	}
+	e.add(path, "organization omit_attributes", ExplainNoMatch, "", "")
+
+	if pattern, found := config.attributeMatchingPattern(key, config.OmitAttributes); found {
+		e.add(path, "omit_attributes", ExplainMatch, pattern, config.ruleSource("omit_attributes", pattern, false))
+		return e.decide("omitted", fmt.Sprintf("matches pattern '%s'", pattern))
+	}
+	e.add(path, "omit_attributes", ExplainNoMatch, "", "")
+	return false
+}
+
+// explainEnforced checks an attribute name against the organization's
+// patterns when it enforces filtering. It returns true if one matches.
+func (e *Explanation) explainEnforced(key, path string, config *MergedConfig) bool {
+	if pattern, found := config.attributeMatchingPattern(key, config.PlatformOmitAttributes); found {
+		e.add(path, "organization omit_attributes (enforced)", ExplainMatch, pattern, config.ruleSource("omit_attributes", pattern, true))
+		return e.decide("omitted", fmt.Sprintf("matches pattern '%s'", pattern))
+	}
+	e.add(path, "organization omit_attributes (enforced)", ExplainNoMatch, "", "")
+	return false
+}
+
+// preservedUnderEnforcement reports whether the attribute just decided was
+// preserved while the organization enforces filtering, in which case its
+// patterns are still checked below it
+func (e *Explanation) preservedUnderEnforcement(config *MergedConfig) bool {
+	return e.Verdict == "preserved" && config.PlatformEnforced
+}
+
+// explainRule checks the scoped attribute rules. It returns true if one matches.
+func (e *Explanation) explainRule(path string, scope *ruleScope, config *MergedConfig) bool {
+	if scope == nil {
+		return false
+	}
+	rule := matchAttributeRule(scope, config)
+	if rule == nil {
+		e.add(path, "attribute_rules", ExplainNoMatch, "", "")
+		return false
+	}
+
+	index := 0
+	for i := range config.AttributeRules {
+		if &config.AttributeRules[i] == rule {
+			index = i
+		}
+	}
+	source := config.ruleSource("attribute_rules", strconv.Itoa(index), false)
+	if rule.pack != "" {
+		source = "rule pack " + rule.pack
+	}
+	e.add(path, "attribute_rules", ExplainMatch, fmt.Sprintf("%s %s", rule.Action, rule), source)
+	if rule.Action == AttributeRulePreserve {
+		return e.decide("preserved", "")
+	}
+	return e.decide("omitted", rule.omission(path).Reason)
+}
+
+// applyResult looks up an omission the filter recorded at path for a reason
+// the name-based rules do not cover: Terraform markers, provider schemas,
+// value detectors and the plan's named values. It returns true if one was found.
+func (e *Explanation) applyResult(result *FilterResult, path string) bool {
+	o := findOmission(result, path)
+	if o == nil {
+		return false
+	}
+
+	check := "filter result"
+	switch {
+	case o.Detector != "":
+		check = "detectors"
+	case o.Reason == ReasonProviderSchema:
+		check = "provider_schema"
+	case strings.Contains(o.Reason, "sensitive"):
+		check = "honor_terraform_sensitive"
+	}
+	e.add(path, check, ExplainMatch, o.Reason, "")
+	verdict := "omitted"
+	if o.Action != "" {
+		verdict = o.Action
+	}
+	return e.decide(verdict, o.Reason)
+}
+
+// confirm checks a verdict reached by the rules against the filter result.
+// The rules decide what would happen to path; if the filter recorded nothing
+// there, the input does not contain it.
+func (e *Explanation) confirm(result *FilterResult, path string) {
+	o := findOmission(result, path)
+	if o == nil {
+		e.Note = "not found in the input; the verdict is what would happen if it were present"
+		return
+	}
+	if o.Action != "" {
+		e.Verdict = o.Action
+	}
+}
+
+// findOmission returns the omission recorded at path or one of its parents.
+// Instance keys are ignored when path has none, and the before/after level of
+// plan resource changes is skipped, so aws_instance.web.password also finds
+// aws_instance.web[0].after.password.
+func findOmission(result *FilterResult, path string) *OmittedField {
+	stripKeys := !strings.Contains(path, "[")
+	for i := range result.Omissions {
+		o := &result.Omissions[i]
+		candidate := o.Path
+		candidate = strings.Replace(candidate, ".before.", ".", 1)
+		candidate = strings.Replace(candidate, ".after.", ".", 1)
+		if stripKeys {
+			candidate = stripIndexKeys(candidate)
+		}
+		if candidate == path || strings.HasPrefix(path, candidate+".") || strings.HasPrefix(path, candidate+"[") {
+			return o
+		}
+	}
+	return nil
+}
+
+// stripIndexKeys removes the [...] keys from a path
+func stripIndexKeys(path string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range path {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// PrintExplanation writes an explanation as text
+func PrintExplanation(w io.Writer, e *Explanation) {
+	fmt.Fprintf(w, "🔍 %s\n", e.Target)
+	fmt.Fprintln(w)
+
+	subject := ""
+	for i, s := range e.Steps {
+		if s.Subject != subject {
+			fmt.Fprintf(w, "   %s\n", s.Subject)
+			subject = s.Subject
+		}
+		emoji := "·"
+		switch s.Result {
+		case ExplainMatch:
+			emoji = "✔"
+		case ExplainSkipped:
+			emoji = "–"
+		}
+		line := fmt.Sprintf("     %d. %s %s: %s", i+1, emoji, s.Check, s.Result)
+		if s.Detail != "" {
+			line += fmt.Sprintf(" (%s)", s.Detail)
+		}
+		if s.Source != "" {
+			line += " ← " + s.Source
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintln(w)
+
+	verdict := map[string]string{
+		"omitted":   "⛔ omitted",
+		"redacted":  "🩹 redacted",
+		"hashed":    "🔑 hashed",
+		"preserved": "✅ preserved",
+		"kept":      "✅ kept",
+	}[e.Verdict]
+	if e.Reason != "" {
+		verdict += ": " + e.Reason
+	}
+	fmt.Fprintf(w, "   Verdict: %s\n", verdict)
+	if e.Note != "" {
+		fmt.Fprintf(w, "   Note: %s\n", e.Note)
+	}
+}
+
+// ruleSources records where .cora.yaml entries were set, for --explain
+type ruleSources struct {
+	file  string
+	lines map[string]int // Keyed by setting + "\x00" + value
+}
+
+// loadRuleSources reads the line of each filtering entry in a .cora.yaml
+// file. Failures only cost the line numbers, so they are not reported.
+func loadRuleSources(path string) *ruleSources {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return nil
+	}
+
+	display := path
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, path); err == nil {
+			display = rel
+		}
+	}
+	sources := &ruleSources{file: display, lines: make(map[string]int)}
+
+	filtering := mappingValue(doc.Content[0], "filtering")
+	if filtering == nil || filtering.Kind != yaml.MappingNode {
+		return sources
+	}
+	for i := 0; i+1 < len(filtering.Content); i += 2 {
+		setting, value := filtering.Content[i].Value, filtering.Content[i+1]
+		if value.Kind != yaml.SequenceNode {
+			sources.lines[setting+"\x00"] = value.Line
+			continue
+		}
+		for j, item := range value.Content {
+			key := item.Value
+			switch {
+			case setting == "attribute_rules":
+				key = strconv.Itoa(j)
+			case item.Kind == yaml.MappingNode:
+				if pattern := mappingValue(item, "pattern"); pattern != nil {
+					key = pattern.Value
+				}
+			}
+			sources.lines[setting+"\x00"+key] = item.Line
+		}
+	}
+	return sources
+}
+
+// mappingValue returns the value for key in a YAML mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// ruleSource describes where a setting's value came from: organization
+// settings, a line of .cora.yaml, a rule pack or the built-in defaults. value
+// is the pattern for list settings, the index for attribute_rules and ""
+// otherwise.
+func (m *MergedConfig) ruleSource(setting, value string, platform bool) string {
+	if platform {
+		return "organization settings"
+	}
+	value = strings.TrimPrefix(value, wordMatchPrefix)
+	if m.sources != nil {
+		if line, ok := m.sources.lines[setting+"\x00"+value]; ok {
+			return fmt.Sprintf("%s:%d", m.sources.file, line)
+		}
+	}
+	if pack, ok := m.packTypes[value]; ok && setting == "omit_resource_types" {
+		return "rule pack " + pack
+	}
+	return "built-in default"
+}
@@ -0,0 +1,124 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const explainStateJSON = `{
+  "version": 4,
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_db_instance",
+      "name": "main",
+      "instances": [
+        {
+          "attributes": {
+            "id": "db-1",
+            "password": "hunter2",
+            "secret_arn": "arn:aws:secretsmanager:us-east-1:123456789012:secret:db",
+            "settings": [{"name": "a", "value": "b"}]
+          },
+          "sensitive_attributes": [
+            [
+              {"type": "get_attr", "value": "settings"},
+              {"type": "index", "value": {"value": 0, "type": "number"}},
+              {"type": "get_attr", "value": "value"}
+            ]
+          ]
+        }
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "random_password",
+      "name": "db",
+      "instances": [{"attributes": {"result": "x"}}]
+    }
+  ]
+}`
+
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, ".cora.yaml")
+	configYAML := "version: 1\nfiltering:\n  preserve_attributes:\n    - secret_arn\n"
+	if err := os.WriteFile(configPath, []byte(configYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.PreserveAttributes = []string{"secret_arn"}
+	config.sources = loadRuleSources(configPath)
+
+	result, err := Filter([]byte(explainStateJSON), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+
+	tests := []struct {
+		target      string
+		wantVerdict string
+		wantCheck   string // Check of the last step
+		wantSource  string
+		wantNote    bool
+	}{
+		{"aws_db_instance.main.password", "omitted", "omit_attributes", "built-in default", false},
+		{"aws_db_instance.main.secret_arn", "preserved", "preserve_attributes", filepath.Base(configPath) + ":4", false},
+		{"aws_db_instance.main.settings[0].value", "omitted", "honor_terraform_sensitive", "", false},
+		{"aws_db_instance.main.id", "kept", "detectors", "", false},
+		{"random_password.db.result", "omitted", "omit_resource_types", "built-in default", false},
+		{"aws_db_instance.replica.password", "omitted", "omit_attributes", "built-in default", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			e := Explain(tt.target, result, config)
+			if e.Verdict != tt.wantVerdict {
+				t.Errorf("Expected verdict %q, got %q (%s)", tt.wantVerdict, e.Verdict, e.Reason)
+			}
+			last := e.Steps[len(e.Steps)-1]
+			if last.Check != tt.wantCheck {
+				t.Errorf("Expected last check %q, got %+v", tt.wantCheck, last)
+			}
+			if tt.wantSource != "" && filepath.Base(last.Source) != tt.wantSource {
+				t.Errorf("Expected source %q, got %q", tt.wantSource, last.Source)
+			}
+			if (e.Note != "") != tt.wantNote {
+				t.Errorf("Unexpected note %q", e.Note)
+			}
+		})
+	}
+}
+
+func TestParseExplainTarget(t *testing.T) {
+	tests := []struct {
+		target       string
+		wantModule   string
+		wantMode     string
+		wantType     string
+		wantResource string
+		wantSteps    int
+	}{
+		{"aws_instance.web", "", "managed", "aws_instance", "aws_instance.web", 0},
+		{"aws_instance.web[0].tags.Name", "", "managed", "aws_instance", "aws_instance.web[0]", 2},
+		{"module.app[\"a\"].module.db.data.aws_ami.ubuntu.id", "module.app[\"a\"].module.db", "data", "aws_ami", "module.app[\"a\"].module.db.data.aws_ami.ubuntu", 1},
+	}
+
+	for _, tt := range tests {
+		addr, ok := parseExplainTarget(tt.target)
+		if !ok {
+			t.Errorf("parseExplainTarget(%q) failed", tt.target)
+			continue
+		}
+		if addr.module != tt.wantModule || addr.mode != tt.wantMode || addr.resourceType != tt.wantType ||
+			addr.resource != tt.wantResource || len(addr.steps) != tt.wantSteps {
+			t.Errorf("parseExplainTarget(%q) = %+v", tt.target, addr)
+		}
+	}
+
+	if _, ok := parseExplainTarget("output_changes"); ok {
+		t.Errorf("Expected a bare name not to parse as a resource address")
+	}
+}
@@ -1,6 +1,7 @@
 package filter
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -12,13 +13,23 @@ type OmittedField struct {
 	Reason       string `json:"reason"`                  // Why it was omitted
 	Type         string `json:"type"`                    // "resource" or "attribute"
 	FromPlatform bool   `json:"from_platform,omitempty"` // True if this came from platform/org settings
+	Detector     string `json:"detector,omitempty"`      // Name of the value detector that flagged it, if any
+	Action       string `json:"action,omitempty"`        // "redacted" or "hashed" if the value was replaced instead of removed
+
+	values    []string        // Removed strings, for the leak scan; never reported
+	sensitive *sensitivePaths // What Terraform marked sensitive in the removed value, for capture
+	schema    *schemaNode     // What the provider schema marks sensitive in it, for capture
+	mode      RedactionMode   // Mode of the pattern or attribute rule that flagged it; empty uses its category's
 }
 
 // FilterResult contains the filtered state and metadata about omissions
 type FilterResult struct {
-	FilteredJSON []byte         `json:"-"`         // The filtered state JSON
-	Omissions    []OmittedField `json:"omissions"` // List of omitted fields
-	Summary      FilterSummary  `json:"summary"`   // Summary statistics
+	FilteredJSON []byte         `json:"-"`                    // The filtered state JSON
+	Omissions    []OmittedField `json:"omissions"`            // List of omitted fields
+	Summary      FilterSummary  `json:"summary"`              // Summary statistics
+	Leaks        []Leak         `json:"leaks,omitempty"`      // Copies of removed values found by ScanLeaks
+	Kept         []KeptResource `json:"kept,omitempty"`       // Resources kept in allowlist mode, with their attributes
+	Pseudonyms   map[string]int `json:"pseudonyms,omitempty"` // Distinct values replaced by Pseudonymize, by kind
 }
 
 // FilterSummary contains aggregate statistics about the filtering
@@ -29,230 +40,591 @@ type FilterSummary struct {
 	OmittedAttributes int `json:"omitted_attributes"`
 }
 
-// TerraformState represents the structure of a Terraform state file
-type TerraformState struct {
-	Version          int                    `json:"version"`
-	TerraformVersion string                 `json:"terraform_version"`
-	Serial           int                    `json:"serial"`
-	Lineage          string                 `json:"lineage"`
-	Outputs          map[string]interface{} `json:"outputs"`
-	Resources        []Resource             `json:"resources"`
+// merge adds the omissions and counts of a partial result, such as the
+// result of filtering a single resource
+func (r *FilterResult) merge(other *FilterResult) {
+	r.Omissions = append(r.Omissions, other.Omissions...)
+	r.Kept = append(r.Kept, other.Kept...)
+	r.Summary.TotalResources += other.Summary.TotalResources
+	r.Summary.OmittedResources += other.Summary.OmittedResources
+	r.Summary.TotalAttributes += other.Summary.TotalAttributes
+	r.Summary.OmittedAttributes += other.Summary.OmittedAttributes
+}
+
+// countOmittedResources merges repeated resource omissions and counts each
+// dropped resource once. A plan lists a resource in planned_values,
+// resource_changes, prior_state and configuration, and each section drops it;
+// a configuration block has no instance keys and counts as the same resource
+// as its instances.
+func (r *FilterResult) countOmittedResources() {
+	instances := make(map[string]bool)
+	for _, o := range r.Omissions {
+		if o.Type == "resource" && !strings.HasPrefix(o.Path, "configuration.") {
+			instances[stripIndexKeys(o.Path)] = true
+		}
+	}
+
+	seen := make(map[string]int)
+	kept := r.Omissions[:0]
+	count := 0
+	for _, o := range r.Omissions {
+		if o.Type != "resource" {
+			kept = append(kept, o)
+			continue
+		}
+		key := o.Path + "\x00" + o.Reason
+		if i, ok := seen[key]; ok {
+			kept[i].values = append(kept[i].values, o.values...)
+			continue
+		}
+		seen[key] = len(kept)
+		kept = append(kept, o)
+		if address, ok := strings.CutPrefix(o.Path, "configuration."); !ok || !instances[address] {
+			count++
+		}
+	}
+	r.Omissions = kept
+	r.Summary.OmittedResources = count
 }
 
-// Resource represents a Terraform resource in state
-type Resource struct {
-	Module    string     `json:"module,omitempty"`
-	Mode      string     `json:"mode"`
-	Type      string     `json:"type"`
-	Name      string     `json:"name"`
-	Provider  string     `json:"provider"`
-	Instances []Instance `json:"instances"`
+const (
+	// ReasonDataSource is the omission reason for data source lookups
+	ReasonDataSource = "data source lookup omitted"
+	// ReasonPrivateData is the omission reason for opaque provider private data
+	ReasonPrivateData = "opaque provider private data omitted"
+	// ReasonTerraformSensitive is the omission reason for values Terraform marked sensitive
+	ReasonTerraformSensitive = "marked as sensitive by Terraform"
+	// ReasonSensitiveVariable is the omission reason for variables declared sensitive
+	ReasonSensitiveVariable = "variable declared sensitive in configuration"
+)
+
+// DocumentFormat identifies which Terraform JSON layout a document uses
+type DocumentFormat string
+
+const (
+	// FormatUnknown is returned when the document matches no known layout
+	FormatUnknown DocumentFormat = ""
+	// FormatRawState is the raw state file layout (terraform state pull, *.tfstate)
+	FormatRawState DocumentFormat = "raw-state"
+	// FormatShowState is the `terraform show -json` state layout (values.root_module)
+	FormatShowState DocumentFormat = "show-state"
+	// FormatPlan is the `terraform show -json <planfile>` plan layout
+	FormatPlan DocumentFormat = "plan"
+)
+
+// DetectFormat inspects the top-level keys of a Terraform JSON document and
+// reports which layout it uses. It returns an error if the input is not a JSON object.
+func DetectFormat(data []byte) (DocumentFormat, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return FormatUnknown, err
+	}
+	return detectFormat(func(key string) bool {
+		_, ok := doc[key]
+		return ok
+	}), nil
 }
 
-// Instance represents a resource instance
-type Instance struct {
-	IndexKey            interface{}            `json:"index_key,omitempty"`
-	Status              string                 `json:"status,omitempty"`
-	SchemaVersion       int                    `json:"schema_version"`
-	Attributes          map[string]interface{} `json:"attributes"`
-	SensitiveAttributes []interface{}          `json:"sensitive_attributes"`
-	Private             string                 `json:"private,omitempty"`
-	Dependencies        []string               `json:"dependencies,omitempty"`
-	CreateBeforeDestroy bool                   `json:"create_before_destroy,omitempty"`
+// detectFormat classifies a document from its top-level keys
+func detectFormat(has func(key string) bool) DocumentFormat {
+	if has("resource_changes") || has("planned_values") {
+		return FormatPlan
+	}
+	if has("version") && has("resources") {
+		return FormatRawState
+	}
+	// An empty state renders as just {"format_version": "1.0"}, so values is optional
+	if has("format_version") {
+		return FormatShowState
+	}
+	return FormatUnknown
 }
 
-// Filter applies sensitive data filtering to a Terraform state JSON
+// Filter applies sensitive data filtering to a Terraform state JSON.
+// Both the raw state layout and the `terraform show -json` layout are supported.
+// Fields the filter does not touch are passed through unchanged, in their original order.
 func Filter(stateJSON []byte, config *MergedConfig) (*FilterResult, error) {
-	var state TerraformState
-	if err := json.Unmarshal(stateJSON, &state); err != nil {
+	doc, err := NewDocument(bytes.NewReader(stateJSON))
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse state JSON: %w", err)
 	}
 
-	result := &FilterResult{
-		Omissions: []OmittedField{},
-		Summary: FilterSummary{
-			TotalResources: len(state.Resources),
-		},
+	var filtered bytes.Buffer
+	result, err := FilterStream(doc, &filtered, config)
+	if err != nil {
+		return nil, err
 	}
+	result.FilteredJSON = filtered.Bytes()
 
-	// Filter resources
-	filteredResources := []Resource{}
-	for _, resource := range state.Resources {
-		resourcePath := formatResourcePath(resource)
+	return result, nil
+}
 
-		// Check if data sources should be omitted
-		if config.OmitDataSources && resource.Mode == "data" {
-			result.Omissions = append(result.Omissions, OmittedField{
-				Path:   resourcePath,
-				Reason: "data source lookup omitted",
-				Type:   "resource",
-			})
-			result.Summary.OmittedResources++
-			continue
+// filterRawResource filters a resource in the raw state file layout in place.
+// It returns false if the whole resource should be dropped.
+func filterRawResource(resource *object, config *MergedConfig, result *FilterResult) bool {
+	resourcePath := formatResourcePath(resource)
+	providerSensitive := config.ProviderSchema.lookup(getString(resource, "mode"), getString(resource, "type"))
+	if omitResource(resourcePath, getString(resource, "module"), getString(resource, "mode"), getString(resource, "type"), config, result) {
+		for _, item := range getArray(resource, "instances") {
+			if instance, ok := item.(*object); ok {
+				sensitiveAttrs := parseSensitiveAttributes(getArray(instance, "sensitive_attributes"))
+				captureAttributes(result, getObject(instance, "attributes"), sensitiveAttrs, providerSensitive, config)
+			}
 		}
+		return false
+	}
 
-		// Check if entire resource type should be omitted (check platform first)
-		if ResourceTypeMatches(resource.Type, config.PlatformOmitResourceTypes) {
-			result.Omissions = append(result.Omissions, OmittedField{
-				Path:         resourcePath,
-				Reason:       fmt.Sprintf("resource type '%s' is in omit list", resource.Type),
-				Type:         "resource",
-				FromPlatform: true,
-			})
-			result.Summary.OmittedResources++
-			continue
-		}
-		if ResourceTypeMatches(resource.Type, config.OmitResourceTypes) {
-			result.Omissions = append(result.Omissions, OmittedField{
-				Path:   resourcePath,
-				Reason: fmt.Sprintf("resource type '%s' is in omit list", resource.Type),
-				Type:   "resource",
-			})
-			result.Summary.OmittedResources++
+	// Filter instances
+	instances := getArray(resource, "instances")
+	for i, item := range instances {
+		instance, ok := item.(*object)
+		if !ok {
 			continue
 		}
 
-		// Filter instances
-		filteredInstances := []Instance{}
-		for i, instance := range resource.Instances {
-			instancePath := resourcePath
-			if instance.IndexKey != nil {
-				instancePath = fmt.Sprintf("%s[%v]", resourcePath, instance.IndexKey)
-			} else if len(resource.Instances) > 1 {
-				instancePath = fmt.Sprintf("%s[%d]", resourcePath, i)
-			}
+		instancePath := resourcePath
+		if indexKey, ok := instance.get("index_key"); ok && indexKey != nil {
+			instancePath = fmt.Sprintf("%s[%v]", resourcePath, indexKey)
+		} else if len(instances) > 1 {
+			instancePath = fmt.Sprintf("%s[%d]", resourcePath, i)
+		}
 
-			// Get sensitive attributes from Terraform's markers
-			sensitiveAttrs := parseSensitiveAttributes(instance.SensitiveAttributes)
+		// Get sensitive attributes from Terraform's markers
+		sensitiveAttrs := parseSensitiveAttributes(getArray(instance, "sensitive_attributes"))
+		scope := newRuleScope(config, getString(resource, "type"), instancePath)
 
-			// Filter attributes
-			filteredAttrs, attrOmissions := filterAttributes(
-				instance.Attributes,
-				instancePath,
-				config,
-				sensitiveAttrs,
-			)
+		// Filter attributes
+		if attrs := getObject(instance, "attributes"); attrs != nil {
+			result.Summary.TotalAttributes += countAttributes(attrs)
+			if config.Allowlist != nil {
+				allowlistAttributes(attrs, instancePath, resourcePath, getString(resource, "type"), sensitiveAttrs, providerSensitive, config, result)
+			}
+			filteredAttrs, attrOmissions := filterAttributes(attrs, instancePath, config, sensitiveAttrs, providerSensitive, scope)
 			result.Omissions = append(result.Omissions, attrOmissions...)
 			result.Summary.OmittedAttributes += len(attrOmissions)
-			result.Summary.TotalAttributes += countAttributes(instance.Attributes)
+			instance.set("attributes", filteredAttrs)
+		}
 
-			instance.Attributes = filteredAttrs
-			// Also clear sensitive_attributes since we've processed them
-			instance.SensitiveAttributes = []interface{}{}
-			filteredInstances = append(filteredInstances, instance)
+		// Also clear sensitive_attributes since we've processed them
+		if instance.has("sensitive_attributes") {
+			instance.set("sensitive_attributes", []interface{}{})
 		}
 
-		resource.Instances = filteredInstances
-		filteredResources = append(filteredResources, resource)
+		// Drop opaque provider data
+		if config.OmitPrivateData {
+			for _, field := range OpaqueInstanceFields {
+				if !instance.has(field) {
+					continue
+				}
+				instance.remove(field)
+				result.Omissions = append(result.Omissions, OmittedField{
+					Path:   instancePath + "." + field,
+					Reason: ReasonPrivateData,
+					Type:   "attribute",
+				})
+				result.Summary.OmittedAttributes++
+			}
+		}
+
+		// Resource identities and legacy flat attributes hold attribute values too
+		if config.Allowlist != nil {
+			for _, field := range []string{"identity", "attributes_flat"} {
+				if !instance.has(field) {
+					continue
+				}
+				instance.remove(field)
+				result.Omissions = append(result.Omissions, OmittedField{
+					Path:   instancePath + "." + field,
+					Reason: ReasonNotAllowlisted,
+					Type:   "attribute",
+				})
+				result.Summary.OmittedAttributes++
+			}
+		}
 	}
 
-	state.Resources = filteredResources
+	return true
+}
 
-	// Filter outputs (they can also contain sensitive values)
-	if state.Outputs != nil {
-		state.Outputs = filterOutputs(state.Outputs, config, result)
+// omitResource checks the resource-level rules (omitted modules, data sources,
+// omitted resource types and, in allowlist mode, the allowlist) and records an
+// omission if the resource should be dropped. moduleAddress is the address of the module the resource belongs to,
+// or "" for the root module.
+func omitResource(path, moduleAddress, mode, resourceType string, config *MergedConfig, result *FilterResult) bool {
+	// Check if the whole module is omitted
+	if pattern, found := ModuleMatchingPattern(moduleAddress, config.OmitModules); found {
+		recordModuleOmission(path, moduleAddress, pattern, result)
+		return true
 	}
 
-	// Re-serialize
-	filteredJSON, err := json.Marshal(state)
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize filtered state: %w", err)
+	// Check if data sources should be omitted
+	if config.OmitDataSources && mode == "data" {
+		result.Omissions = append(result.Omissions, OmittedField{
+			Path:   path,
+			Reason: ReasonDataSource,
+			Type:   "resource",
+		})
+		result.Summary.OmittedResources++
+		return true
 	}
-	result.FilteredJSON = filteredJSON
 
-	return result, nil
+	// Check if entire resource type should be omitted (check platform first)
+	if pattern, found := ResourceTypeMatchingPattern(resourceType, config.PlatformOmitResourceTypes); found {
+		result.Omissions = append(result.Omissions, OmittedField{
+			Path:         path,
+			Reason:       resourceTypeReason(resourceType, pattern),
+			Type:         "resource",
+			FromPlatform: true,
+		})
+		result.Summary.OmittedResources++
+		return true
+	}
+	if pattern, found := ResourceTypeMatchingPattern(resourceType, config.OmitResourceTypes); found {
+		result.Omissions = append(result.Omissions, OmittedField{
+			Path:   path,
+			Reason: resourceTypeReason(resourceType, pattern),
+			Type:   "resource",
+		})
+		result.Summary.OmittedResources++
+		return true
+	}
+
+	// In allowlist mode, everything not listed is dropped
+	if config.Allowlist != nil {
+		if _, found := config.Allowlist.allowsType(resourceType); !found {
+			result.Omissions = append(result.Omissions, OmittedField{
+				Path:   path,
+				Reason: ReasonNotAllowlisted,
+				Type:   "resource",
+			})
+			result.Summary.OmittedResources++
+			return true
+		}
+	}
+
+	return false
+}
+
+// resourceTypeReason describes why a resource type was omitted
+func resourceTypeReason(resourceType, pattern string) string {
+	if pattern == resourceType {
+		return fmt.Sprintf("resource type '%s' is in omit list", resourceType)
+	}
+	return fmt.Sprintf("resource type '%s' matches omit pattern '%s'", resourceType, pattern)
+}
+
+// recordModuleOmission records a resource dropped because its module matches omit_modules
+func recordModuleOmission(path, moduleAddress, pattern string, result *FilterResult) {
+	result.Omissions = append(result.Omissions, OmittedField{
+		Path:   path,
+		Reason: fmt.Sprintf("module '%s' matches omit pattern '%s'", moduleAddress, pattern),
+		Type:   "resource",
+	})
+	result.Summary.OmittedResources++
+}
+
+// omitPlannedModule records every resource in a show-json module and its
+// children as omitted, for a module dropped by omit_modules
+func omitPlannedModule(module *object, moduleAddress, pattern string, config *MergedConfig, result *FilterResult) {
+	for _, item := range getArray(module, "resources") {
+		if resource, ok := item.(*object); ok {
+			recordModuleOmission(getString(resource, "address"), moduleAddress, pattern, result)
+			capturePlannedResource(resource, config, result)
+		}
+	}
+	for _, child := range getArray(module, "child_modules") {
+		if childModule, ok := child.(*object); ok {
+			omitPlannedModule(childModule, moduleAddress, pattern, config, result)
+		}
+	}
 }
 
-// filterAttributes recursively filters sensitive attributes from a map
+// filterAttributes recursively filters sensitive attributes from an object.
+// scope locates the object within its resource for scoped attribute rules.
 func filterAttributes(
-	attrs map[string]interface{},
+	attrs *object,
 	basePath string,
 	config *MergedConfig,
-	terraformSensitive map[string]bool,
-) (map[string]interface{}, []OmittedField) {
+	terraformSensitive *sensitivePaths,
+	providerSensitive *schemaNode,
+	scope *ruleScope,
+) (*object, []OmittedField) {
 	if attrs == nil {
 		return nil, nil
 	}
 
-	filtered := make(map[string]interface{})
+	filtered := newObject()
 	var omissions []OmittedField
 
-	for key, value := range attrs {
+	for _, key := range attrs.orderedKeys() {
+		value := attrs.values[key]
 		attrPath := basePath + "." + key
-
-		// Check if preserved
-		if isPreserved(key, config.PreserveAttributes) {
-			filtered[key] = value
+		attrScope := scope.child(key)
+
+		// Check scoped and name-based rules (preserve lists, platform and local patterns)
+		omission, preserved := checkAttribute(key, attrPath, attrScope, config)
+		if preserved {
+			if config.PlatformEnforced {
+				var enforced []OmittedField
+				value, enforced = enforcePlatformPatterns(value, attrPath, config)
+				omissions = append(omissions, enforced...)
+			}
+			filtered.set(key, value)
 			continue
 		}
-
-		// Check if should be omitted by platform pattern (check first)
-		if matchedPattern, found := AttributeMatchingPattern(key, config.PlatformOmitAttributes); found {
-			omissions = append(omissions, OmittedField{
-				Path:         attrPath,
-				Reason:       fmt.Sprintf("matches pattern '%s'", matchedPattern),
-				Type:         "attribute",
-				FromPlatform: true,
-			})
+		attrSensitive, attrSchema := terraformSensitive.child(key), providerSensitive.child(key)
+		if omission != nil {
+			omission.sensitive, omission.schema = attrSensitive, attrSchema
+			if replacement, keep := applyRedaction(RulePatterns, value, omission, config); keep {
+				filtered.set(key, replacement)
+			}
+			omissions = append(omissions, *omission)
 			continue
 		}
 
-		// Check if should be omitted by pattern
-		if matchedPattern, found := AttributeMatchingPattern(key, config.OmitAttributes); found {
-			omissions = append(omissions, OmittedField{
+		// Check if Terraform marked this exact path sensitive
+		if config.HonorTerraformSensitive && attrSensitive.isSensitive() {
+			omission := OmittedField{
 				Path:   attrPath,
-				Reason: fmt.Sprintf("matches pattern '%s'", matchedPattern),
+				Reason: ReasonTerraformSensitive,
 				Type:   "attribute",
-			})
+			}
+			if replacement, keep := applyRedaction(RuleTerraformSensitive, value, &omission, config); keep {
+				filtered.set(key, replacement)
+			}
+			omissions = append(omissions, omission)
 			continue
 		}
 
-		// Check if Terraform marked it sensitive
-		if config.HonorTerraformSensitive && terraformSensitive[key] {
-			omissions = append(omissions, OmittedField{
+		// Check if the provider declares this attribute sensitive
+		if attrSchema.isSensitive() {
+			omission := OmittedField{
 				Path:   attrPath,
-				Reason: "marked as sensitive by Terraform",
+				Reason: ReasonProviderSchema,
 				Type:   "attribute",
-			})
+			}
+			if replacement, keep := applyRedaction(RuleProviderSchema, value, &omission, config); keep {
+				filtered.set(key, replacement)
+			}
+			omissions = append(omissions, omission)
 			continue
 		}
 
 		// Handle nested objects
 		switch v := value.(type) {
-		case map[string]interface{}:
-			nestedFiltered, nestedOmissions := filterAttributes(v, attrPath, config, terraformSensitive)
-			filtered[key] = nestedFiltered
+		case *object:
+			nestedFiltered, nestedOmissions := filterAttributes(v, attrPath, config, attrSensitive, attrSchema, attrScope)
+			filtered.set(key, nestedFiltered)
 			omissions = append(omissions, nestedOmissions...)
 		case []interface{}:
-			filteredArray, arrayOmissions := filterArray(v, attrPath, config, terraformSensitive)
-			filtered[key] = filteredArray
+			filteredArray, arrayOmissions := filterArray(v, attrPath, config, attrSensitive, attrSchema, attrScope)
+			filtered.set(key, filteredArray)
 			omissions = append(omissions, arrayOmissions...)
+		case string:
+			// Filter documents held in the string, such as Helm values
+			if doc, docOmissions, ok := filterEmbedded(v, attrPath, config, 0); ok {
+				filtered.set(key, doc)
+				omissions = append(omissions, docOmissions...)
+				continue
+			}
+			// Check the value itself for known secret formats
+			if d, found := detectSecretValue(v, config.Detectors); found {
+				omission := detectorOmission(attrPath, d)
+				if replacement, keep := applyRedaction(RuleDetectors, value, &omission, config); keep {
+					filtered.set(key, replacement)
+				}
+				omissions = append(omissions, omission)
+				continue
+			}
+			filtered.set(key, value)
 		default:
-			filtered[key] = value
+			filtered.set(key, value)
 		}
 	}
 
 	return filtered, omissions
 }
 
+// checkAttribute applies the scoped and name-based attribute rules. It returns
+// the omission to record if the attribute should be dropped, and whether the
+// attribute is explicitly preserved (in which case no further rules apply).
+//
+// Scoped rules are the most specific, so they are checked before the global
+// lists. When the organization enforces filtering, its patterns are checked
+// before anything local so that no preserve rule can bypass them.
+// explainAttribute replays these checks for --explain and must follow the
+// same order.
+func checkAttribute(key, attrPath string, scope *ruleScope, config *MergedConfig) (*OmittedField, bool) {
+	if config.PlatformEnforced {
+		if omission := platformAttributeOmission(key, attrPath, config); omission != nil {
+			return omission, false
+		}
+	}
+
+	if rule := matchAttributeRule(scope, config); rule != nil {
+		if rule.Action == AttributeRulePreserve {
+			return nil, true
+		}
+		omission := rule.omission(attrPath)
+		return &omission, false
+	}
+
+	// Check if preserved
+	if isPreserved(key, config.PreserveAttributes) {
+		return nil, true
+	}
+
+	// Check if should be omitted by platform pattern (check first)
+	if omission := platformAttributeOmission(key, attrPath, config); omission != nil {
+		return omission, false
+	}
+
+	// Check if should be omitted by pattern
+	if matchedPattern, found := config.attributeMatchingPattern(key, config.OmitAttributes); found {
+		return &OmittedField{
+			Path:   attrPath,
+			Reason: fmt.Sprintf("matches pattern '%s'", matchedPattern),
+			Type:   "attribute",
+			mode:   config.PatternModes[matchedPattern],
+		}, false
+	}
+
+	return nil, false
+}
+
+// platformAttributeOmission checks an attribute name against the organization's patterns
+func platformAttributeOmission(key, attrPath string, config *MergedConfig) *OmittedField {
+	if matchedPattern, found := config.attributeMatchingPattern(key, config.PlatformOmitAttributes); found {
+		return &OmittedField{
+			Path:         attrPath,
+			Reason:       fmt.Sprintf("matches pattern '%s'", matchedPattern),
+			Type:         "attribute",
+			FromPlatform: true,
+		}
+	}
+	return nil
+}
+
+// enforcePlatformPatterns applies the organization's attribute patterns below
+// a preserved attribute, for when the organization enforces filtering: a local
+// preserve on a block keeps the block, but not what the organization omits
+// inside it. It returns a filtered copy of value.
+func enforcePlatformPatterns(value interface{}, basePath string, config *MergedConfig) (interface{}, []OmittedField) {
+	var omissions []OmittedField
+	switch v := value.(type) {
+	case *object:
+		filtered := newObject()
+		for _, key := range v.orderedKeys() {
+			attrPath := basePath + "." + key
+			if omission := platformAttributeOmission(key, attrPath, config); omission != nil {
+				if replacement, keep := applyRedaction(RulePatterns, v.values[key], omission, config); keep {
+					filtered.set(key, replacement)
+				}
+				omissions = append(omissions, *omission)
+				continue
+			}
+			nested, nestedOmissions := enforcePlatformPatterns(v.values[key], attrPath, config)
+			filtered.set(key, nested)
+			omissions = append(omissions, nestedOmissions...)
+		}
+		return filtered, omissions
+	case []interface{}:
+		filtered := make([]interface{}, 0, len(v))
+		for i, item := range v {
+			nested, nestedOmissions := enforcePlatformPatterns(item, fmt.Sprintf("%s[%d]", basePath, i), config)
+			filtered = append(filtered, nested)
+			omissions = append(omissions, nestedOmissions...)
+		}
+		return filtered, omissions
+	}
+	return value, nil
+}
+
 // filterArray filters sensitive values from an array
 func filterArray(
 	arr []interface{},
 	basePath string,
 	config *MergedConfig,
-	terraformSensitive map[string]bool,
+	terraformSensitive *sensitivePaths,
+	providerSensitive *schemaNode,
+	scope *ruleScope,
 ) ([]interface{}, []OmittedField) {
 	filtered := make([]interface{}, 0, len(arr))
 	var omissions []OmittedField
 
 	for i, item := range arr {
 		itemPath := fmt.Sprintf("%s[%d]", basePath, i)
+		itemScope := scope.index(i)
+
+		// Check scoped rules that name list elements (e.g. ingress[*])
+		if rule := matchAttributeRule(itemScope, config); rule != nil {
+			if rule.Action == AttributeRulePreserve {
+				filtered = append(filtered, item)
+				continue
+			}
+			omission := rule.omission(itemPath)
+			if replacement, keep := applyRedaction(RulePatterns, item, &omission, config); keep {
+				filtered = append(filtered, replacement)
+			}
+			omissions = append(omissions, omission)
+			continue
+		}
+
+		// Check if Terraform marked this element sensitive
+		itemSensitive := terraformSensitive.index(i)
+		if config.HonorTerraformSensitive && itemSensitive.isSensitive() {
+			omission := OmittedField{
+				Path:   itemPath,
+				Reason: ReasonTerraformSensitive,
+				Type:   "attribute",
+			}
+			// A replaced element keeps the indexes of the elements after it stable
+			if replacement, keep := applyRedaction(RuleTerraformSensitive, item, &omission, config); keep {
+				filtered = append(filtered, replacement)
+			}
+			omissions = append(omissions, omission)
+			continue
+		}
+
+		// Check if the provider declares the elements sensitive
+		itemSchema := providerSensitive.index(i)
+		if itemSchema.isSensitive() {
+			omission := OmittedField{
+				Path:   itemPath,
+				Reason: ReasonProviderSchema,
+				Type:   "attribute",
+			}
+			if replacement, keep := applyRedaction(RuleProviderSchema, item, &omission, config); keep {
+				filtered = append(filtered, replacement)
+			}
+			omissions = append(omissions, omission)
+			continue
+		}
 
 		switch v := item.(type) {
-		case map[string]interface{}:
-			nestedFiltered, nestedOmissions := filterAttributes(v, itemPath, config, terraformSensitive)
+		case *object:
+			nestedFiltered, nestedOmissions := filterAttributes(v, itemPath, config, itemSensitive, itemSchema, itemScope)
+			filtered = append(filtered, nestedFiltered)
+			omissions = append(omissions, nestedOmissions...)
+		case []interface{}:
+			nestedFiltered, nestedOmissions := filterArray(v, itemPath, config, itemSensitive, itemSchema, itemScope)
 			filtered = append(filtered, nestedFiltered)
 			omissions = append(omissions, nestedOmissions...)
+		case string:
+			if doc, docOmissions, ok := filterEmbedded(v, itemPath, config, 0); ok {
+				filtered = append(filtered, doc)
+				omissions = append(omissions, docOmissions...)
+				continue
+			}
+			if d, found := detectSecretValue(v, config.Detectors); found {
+				omission := detectorOmission(itemPath, d)
+				if replacement, keep := applyRedaction(RuleDetectors, item, &omission, config); keep {
+					filtered = append(filtered, replacement)
+				}
+				omissions = append(omissions, omission)
+				continue
+			}
+			filtered = append(filtered, item)
 		default:
 			filtered = append(filtered, item)
 		}
@@ -261,67 +633,116 @@ func filterArray(
 	return filtered, omissions
 }
 
-// filterOutputs filters sensitive values from outputs
+// filterOutputs removes sensitive entries from an outputs object in place.
+// Outputs are omitted when their name matches a pattern, when the configuration
+// declares them sensitive, or when Terraform marked them sensitive.
 func filterOutputs(
-	outputs map[string]interface{},
+	outputs *object,
+	basePath string,
 	config *MergedConfig,
 	result *FilterResult,
-) map[string]interface{} {
-	filtered := make(map[string]interface{})
+	sensitiveOutputs map[string]bool,
+) {
+	for _, name := range append([]string{}, outputs.orderedKeys()...) {
+		outputPath := basePath + "." + name
+		output := getObject(outputs, name)
 
-	for name, output := range outputs {
-		outputPath := "outputs." + name
+		omission, rule := checkNamedValue(name, outputPath, config, sensitiveOutputs[name], "output declared sensitive in configuration")
 
-		// Check if output name matches sensitive patterns
-		if matchedPattern, found := AttributeMatchingPattern(name, config.OmitAttributes); found {
-			result.Omissions = append(result.Omissions, OmittedField{
+		// Check if output is marked sensitive
+		if omission == nil && getBool(output, "sensitive") {
+			omission, rule = &OmittedField{
 				Path:   outputPath,
-				Reason: fmt.Sprintf("matches pattern '%s'", matchedPattern),
+				Reason: "output marked as sensitive",
 				Type:   "attribute",
-			})
-			result.Summary.OmittedAttributes++
-			continue
+			}, RuleTerraformSensitive
 		}
 
-		// Check if output is marked sensitive
-		if outputMap, ok := output.(map[string]interface{}); ok {
-			if sensitive, ok := outputMap["sensitive"].(bool); ok && sensitive {
-				result.Omissions = append(result.Omissions, OmittedField{
-					Path:   outputPath,
-					Reason: "output marked as sensitive",
-					Type:   "attribute",
-				})
-				result.Summary.OmittedAttributes++
-				continue
+		// Check the output value itself for known secret formats
+		if omission == nil {
+			if d, found := detectSecretValue(getString(output, "value"), config.Detectors); found {
+				detected := detectorOmission(outputPath, d)
+				omission, rule = &detected, RuleDetectors
 			}
 		}
 
-		filtered[name] = output
+		if omission != nil {
+			omitNamedValue(outputs, name, []string{"value"}, rule, *omission, config, result)
+		}
 	}
 
-	return filtered
+	if config.Allowlist != nil {
+		omitNamedValues(outputs, basePath, result)
+	}
 }
 
-// parseSensitiveAttributes converts Terraform's sensitive_attributes format to a simple map
-func parseSensitiveAttributes(sensitive []interface{}) map[string]bool {
-	result := make(map[string]bool)
+// checkNamedValue applies the name and declaration rules shared by outputs,
+// output changes and variables. It returns the omission to record and the
+// rule category that matched, or nil if none did.
+func checkNamedValue(name, path string, config *MergedConfig, declaredSensitive bool, declaredReason string) (*OmittedField, string) {
+	// Check platform patterns first
+	if matchedPattern, found := config.attributeMatchingPattern(name, config.PlatformOmitAttributes); found {
+		return &OmittedField{
+			Path:         path,
+			Reason:       fmt.Sprintf("matches pattern '%s'", matchedPattern),
+			Type:         "attribute",
+			FromPlatform: true,
+		}, RulePatterns
+	}
 
-	for _, item := range sensitive {
-		// Terraform uses a path format like [{"type":"get_attr","value":"password"}]
-		if pathItems, ok := item.([]interface{}); ok {
-			for _, pathItem := range pathItems {
-				if pathMap, ok := pathItem.(map[string]interface{}); ok {
-					if pathMap["type"] == "get_attr" {
-						if value, ok := pathMap["value"].(string); ok {
-							result[value] = true
-						}
-					}
-				}
+	// Check if the name matches sensitive patterns
+	if matchedPattern, found := config.attributeMatchingPattern(name, config.OmitAttributes); found {
+		return &OmittedField{
+			Path:   path,
+			Reason: fmt.Sprintf("matches pattern '%s'", matchedPattern),
+			Type:   "attribute",
+			mode:   config.PatternModes[matchedPattern],
+		}, RulePatterns
+	}
+
+	// Check if the block is declared sensitive in the configuration
+	if config.HonorTerraformSensitive && declaredSensitive {
+		return &OmittedField{
+			Path:   path,
+			Reason: declaredReason,
+			Type:   "attribute",
+		}, RuleTerraformSensitive
+	}
+
+	return nil, ""
+}
+
+// omitNamedValue records the omission of an output, output change or variable.
+// In redact or hash mode the entry is kept and the values under valueKeys are
+// replaced, so the entry still shows up; otherwise the entry is removed.
+func omitNamedValue(
+	parent *object,
+	name string,
+	valueKeys []string,
+	rule string,
+	omission OmittedField,
+	config *MergedConfig,
+	result *FilterResult,
+) {
+	entry := getObject(parent, name)
+	if entry != nil && config.omissionMode(rule, &omission) != RedactionOmit {
+		for _, key := range valueKeys {
+			// Null values (e.g. before on create) have nothing to hide
+			if value, _ := entry.get(key); value != nil {
+				replacement, _ := applyRedaction(rule, value, &omission, config)
+				entry.set(key, replacement)
 			}
 		}
+	} else {
+		for _, key := range valueKeys {
+			value, _ := entry.get(key)
+			omission.capture(value, config)
+		}
+		parent.remove(name)
 	}
 
-	return result
+	result.Omissions = append(result.Omissions, omission)
+	result.Summary.OmittedAttributes++
 }
 
 // isPreserved checks if an attribute name matches a preserve pattern
@@ -334,25 +755,28 @@ func isPreserved(attrName string, preservePatterns []string) bool {
 	return false
 }
 
-// formatResourcePath creates a human-readable path for a resource
-func formatResourcePath(r Resource) string {
-	if r.Module != "" {
-		return fmt.Sprintf("%s.%s.%s", r.Module, r.Type, r.Name)
+// formatResourcePath creates a human-readable path for a raw state resource
+func formatResourcePath(r *object) string {
+	if module := getString(r, "module"); module != "" {
+		return fmt.Sprintf("%s.%s.%s", module, getString(r, "type"), getString(r, "name"))
 	}
-	return fmt.Sprintf("%s.%s", r.Type, r.Name)
+	return fmt.Sprintf("%s.%s", getString(r, "type"), getString(r, "name"))
 }
 
 // countAttributes counts the total number of attributes (recursively)
-func countAttributes(attrs map[string]interface{}) int {
+func countAttributes(attrs *object) int {
+	if attrs == nil {
+		return 0
+	}
 	count := 0
-	for _, v := range attrs {
+	for _, key := range attrs.orderedKeys() {
 		count++
-		switch nested := v.(type) {
-		case map[string]interface{}:
+		switch nested := attrs.values[key].(type) {
+		case *object:
 			count += countAttributes(nested)
 		case []interface{}:
 			for _, item := range nested {
-				if m, ok := item.(map[string]interface{}); ok {
+				if m, ok := item.(*object); ok {
 					count += countAttributes(m)
 				}
 			}
@@ -361,304 +785,206 @@ func countAttributes(attrs map[string]interface{}) int {
 	return count
 }
 
-// TerraformPlan represents the structure of a Terraform plan JSON file
-type TerraformPlan struct {
-	FormatVersion      string                 `json:"format_version"`
-	TerraformVersion   string                 `json:"terraform_version"`
-	Variables          map[string]interface{} `json:"variables,omitempty"`
-	PlannedValues      *PlannedValues         `json:"planned_values,omitempty"`
-	ResourceChanges    []ResourceChange       `json:"resource_changes"`
-	PriorState         *TerraformState        `json:"prior_state,omitempty"`
-	Configuration      map[string]interface{} `json:"configuration,omitempty"`
-	RelevantAttributes []interface{}          `json:"relevant_attributes,omitempty"`
-	Checks             []interface{}          `json:"checks,omitempty"`
-	Timestamp          string                 `json:"timestamp,omitempty"`
-}
-
-// PlannedValues represents the planned_values section of a plan
-type PlannedValues struct {
-	Outputs    map[string]interface{} `json:"outputs,omitempty"`
-	RootModule *PlannedModule         `json:"root_module,omitempty"`
-}
-
-// PlannedModule represents a module in planned_values
-type PlannedModule struct {
-	Resources    []PlannedResource `json:"resources,omitempty"`
-	ChildModules []PlannedModule   `json:"child_modules,omitempty"`
-	Address      string            `json:"address,omitempty"`
-}
-
-// PlannedResource represents a resource in planned_values
-type PlannedResource struct {
-	Address         string                 `json:"address"`
-	Mode            string                 `json:"mode"`
-	Type            string                 `json:"type"`
-	Name            string                 `json:"name"`
-	ProviderName    string                 `json:"provider_name"`
-	SchemaVersion   int                    `json:"schema_version"`
-	Values          map[string]interface{} `json:"values"`
-	SensitiveValues interface{}            `json:"sensitive_values"`
-}
-
-// ResourceChange represents a resource_change entry in a plan
-type ResourceChange struct {
-	Address       string  `json:"address"`
-	ModuleAddress string  `json:"module_address,omitempty"`
-	Mode          string  `json:"mode"`
-	Type          string  `json:"type"`
-	Name          string  `json:"name"`
-	ProviderName  string  `json:"provider_name"`
-	Change        *Change `json:"change"`
-}
-
-// Change represents the change details for a resource
-type Change struct {
-	Actions         []string               `json:"actions"`
-	Before          map[string]interface{} `json:"before"`
-	After           map[string]interface{} `json:"after"`
-	AfterUnknown    map[string]interface{} `json:"after_unknown,omitempty"`
-	BeforeSensitive interface{}            `json:"before_sensitive,omitempty"`
-	AfterSensitive  interface{}            `json:"after_sensitive,omitempty"`
-}
-
-// FilterPlan applies sensitive data filtering to a Terraform plan JSON
-func FilterPlan(planJSON []byte, config *MergedConfig) (*FilterResult, error) {
-	var plan TerraformPlan
-	if err := json.Unmarshal(planJSON, &plan); err != nil {
-		return nil, fmt.Errorf("failed to parse plan JSON: %w", err)
-	}
-
-	result := &FilterResult{
-		Omissions: []OmittedField{},
-		Summary: FilterSummary{
-			TotalResources: len(plan.ResourceChanges),
-		},
-	}
-
-	// Filter resource_changes
-	filteredChanges := []ResourceChange{}
-	for _, rc := range plan.ResourceChanges {
-		// Check if data sources should be omitted
-		if config.OmitDataSources && rc.Mode == "data" {
-			result.Omissions = append(result.Omissions, OmittedField{
-				Path:   rc.Address,
-				Reason: "data source lookup omitted",
-				Type:   "resource",
-			})
-			result.Summary.OmittedResources++
-			continue
+// countModuleResources counts resources in a module and all of its children
+func countModuleResources(module *object) int {
+	count := len(getArray(module, "resources"))
+	for _, child := range getArray(module, "child_modules") {
+		if childModule, ok := child.(*object); ok {
+			count += countModuleResources(childModule)
 		}
+	}
+	return count
+}
 
-		// Check if entire resource type should be omitted (check platform first)
-		if ResourceTypeMatches(rc.Type, config.PlatformOmitResourceTypes) {
-			result.Omissions = append(result.Omissions, OmittedField{
-				Path:         rc.Address,
-				Reason:       fmt.Sprintf("resource type '%s' is in omit list", rc.Type),
-				Type:         "resource",
-				FromPlatform: true,
-			})
-			result.Summary.OmittedResources++
-			continue
-		}
-		if ResourceTypeMatches(rc.Type, config.OmitResourceTypes) {
-			result.Omissions = append(result.Omissions, OmittedField{
-				Path:   rc.Address,
-				Reason: fmt.Sprintf("resource type '%s' is in omit list", rc.Type),
-				Type:   "resource",
-			})
-			result.Summary.OmittedResources++
-			continue
+// countModuleAttributes counts resource attributes in a module and all of its children
+func countModuleAttributes(module *object) int {
+	count := 0
+	for _, item := range getArray(module, "resources") {
+		if resource, ok := item.(*object); ok {
+			count += countAttributes(getObject(resource, "values"))
 		}
-
-		// Filter change.before and change.after
-		if rc.Change != nil {
-			sensitiveAttrs := parseSensitiveFromPlan(rc.Change.BeforeSensitive, rc.Change.AfterSensitive)
-
-			if rc.Change.Before != nil {
-				filtered, omissions := filterAttributes(rc.Change.Before, rc.Address+".before", config, sensitiveAttrs)
-				rc.Change.Before = filtered
-				result.Omissions = append(result.Omissions, omissions...)
-				result.Summary.OmittedAttributes += len(omissions)
-				result.Summary.TotalAttributes += countAttributes(rc.Change.Before)
-			}
-
-			if rc.Change.After != nil {
-				filtered, omissions := filterAttributes(rc.Change.After, rc.Address+".after", config, sensitiveAttrs)
-				rc.Change.After = filtered
-				result.Omissions = append(result.Omissions, omissions...)
-				result.Summary.OmittedAttributes += len(omissions)
-				result.Summary.TotalAttributes += countAttributes(rc.Change.After)
-			}
-
-			// Clear sensitive markers since we've processed them
-			rc.Change.BeforeSensitive = nil
-			rc.Change.AfterSensitive = nil
+	}
+	for _, child := range getArray(module, "child_modules") {
+		if childModule, ok := child.(*object); ok {
+			count += countModuleAttributes(childModule)
 		}
+	}
+	return count
+}
 
-		filteredChanges = append(filteredChanges, rc)
+// FilterPlan applies sensitive data filtering to a Terraform plan JSON.
+// The plan is filtered generically: every section the filter does not
+// understand (and every field it does not touch) is passed through unchanged.
+func FilterPlan(planJSON []byte, config *MergedConfig) (*FilterResult, error) {
+	doc, err := NewDocument(bytes.NewReader(planJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse plan JSON: %w", err)
 	}
-	plan.ResourceChanges = filteredChanges
 
-	// Filter planned_values if present
-	if plan.PlannedValues != nil {
-		filterPlannedValues(plan.PlannedValues, config, result)
+	var filtered bytes.Buffer
+	result, err := FilterPlanStream(doc, &filtered, config)
+	if err != nil {
+		return nil, err
 	}
+	result.FilteredJSON = filtered.Bytes()
+
+	return result, nil
+}
 
-	// Filter prior_state if present
-	if plan.PriorState != nil {
-		stateJSON, _ := json.Marshal(plan.PriorState)
-		stateResult, err := Filter(stateJSON, config)
-		if err == nil {
-			var filteredState TerraformState
-			if json.Unmarshal(stateResult.FilteredJSON, &filteredState) == nil {
-				plan.PriorState = &filteredState
-				result.Omissions = append(result.Omissions, stateResult.Omissions...)
-				result.Summary.OmittedResources += stateResult.Summary.OmittedResources
-				result.Summary.OmittedAttributes += stateResult.Summary.OmittedAttributes
+// filterResourceChange filters a single resource change in place.
+// It returns false if the whole resource should be dropped.
+func filterResourceChange(rc *object, config *MergedConfig, result *FilterResult) bool {
+	address := getString(rc, "address")
+	providerSensitive := config.ProviderSchema.lookup(getString(rc, "mode"), getString(rc, "type"))
+	if omitResource(address, getString(rc, "module_address"), getString(rc, "mode"), getString(rc, "type"), config, result) {
+		if change := getObject(rc, "change"); change != nil {
+			for _, key := range []string{"before", "after"} {
+				marker, _ := change.get(key + "_sensitive")
+				captureAttributes(result, getObject(change, key), parseSensitiveFromPlan(marker), providerSensitive, config)
 			}
 		}
+		return false
 	}
 
-	// Filter variables that may be sensitive
-	if plan.Variables != nil {
-		plan.Variables = filterVariables(plan.Variables, config, result)
+	// Filter change.before and change.after
+	change := getObject(rc, "change")
+	if change == nil {
+		return true
 	}
 
-	// Re-serialize
-	filteredJSON, err := json.Marshal(plan)
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize filtered plan: %w", err)
+	scope := newRuleScope(config, getString(rc, "type"), address)
+	for _, key := range []string{"before", "after"} {
+		values := getObject(change, key)
+		if values == nil {
+			continue
+		}
+		// before is checked against before_sensitive and after against after_sensitive
+		marker, _ := change.get(key + "_sensitive")
+		sensitiveAttrs := parseSensitiveFromPlan(marker)
+		result.Summary.TotalAttributes += countAttributes(values)
+		if config.Allowlist != nil {
+			allowlistAttributes(values, address+"."+key, address, getString(rc, "type"), sensitiveAttrs, providerSensitive, config, result)
+		}
+		filtered, omissions := filterAttributes(values, address+"."+key, config, sensitiveAttrs, providerSensitive, scope)
+		change.set(key, filtered)
+		result.Omissions = append(result.Omissions, omissions...)
+		result.Summary.OmittedAttributes += len(omissions)
 	}
-	result.FilteredJSON = filteredJSON
-
-	return result, nil
-}
-
-// parseSensitiveFromPlan extracts sensitive attribute names from plan sensitive markers
-func parseSensitiveFromPlan(beforeSensitive, afterSensitive interface{}) map[string]bool {
-	result := make(map[string]bool)
 
-	extractSensitive := func(v interface{}) {
-		switch s := v.(type) {
-		case map[string]interface{}:
-			for key, val := range s {
-				if b, ok := val.(bool); ok && b {
-					result[key] = true
+	// after_unknown mirrors the attributes, so it names the ones the allowlist removed
+	if config.Allowlist != nil {
+		if unknown := getObject(change, "after_unknown"); unknown != nil {
+			for _, key := range append([]string{}, unknown.orderedKeys()...) {
+				if _, found := config.Allowlist.allowsAttribute(getString(rc, "type"), key); !found {
+					unknown.remove(key)
 				}
 			}
-		case bool:
-			// If the entire value is marked sensitive, we'll handle it elsewhere
 		}
 	}
 
-	extractSensitive(beforeSensitive)
-	extractSensitive(afterSensitive)
+	// Clear sensitive markers since we've processed them
+	change.remove("before_sensitive")
+	change.remove("after_sensitive")
 
-	return result
+	return true
 }
 
-// filterPlannedValues filters sensitive data from planned_values
-func filterPlannedValues(pv *PlannedValues, config *MergedConfig, result *FilterResult) {
-	if pv.RootModule != nil {
-		filterPlannedModule(pv.RootModule, config, result)
-	}
+// filterOutputChanges removes sensitive entries from output_changes in place
+func filterOutputChanges(outputChanges *object, config *MergedConfig, result *FilterResult, sensitiveOutputs map[string]bool) {
+	for _, name := range append([]string{}, outputChanges.orderedKeys()...) {
+		outputPath := "output_changes." + name
+		change := getObject(outputChanges, name)
 
-	if pv.Outputs != nil {
-		for name := range pv.Outputs {
-			// Check platform patterns first
-			if matchedPattern, found := AttributeMatchingPattern(name, config.PlatformOmitAttributes); found {
-				result.Omissions = append(result.Omissions, OmittedField{
-					Path:         "planned_values.outputs." + name,
-					Reason:       fmt.Sprintf("matches pattern '%s'", matchedPattern),
-					Type:         "attribute",
-					FromPlatform: true,
-				})
-				result.Summary.OmittedAttributes++
-				delete(pv.Outputs, name)
-				continue
+		omission, rule := checkNamedValue(name, outputPath, config, sensitiveOutputs[name], "output declared sensitive in configuration")
+
+		// Output changes carry before_sensitive/after_sensitive markers instead of a sensitive flag
+		if omission == nil && (getBool(change, "before_sensitive") || getBool(change, "after_sensitive")) {
+			omission, rule = &OmittedField{
+				Path:   outputPath,
+				Reason: "output marked as sensitive",
+				Type:   "attribute",
+			}, RuleTerraformSensitive
+		}
+
+		// Check the before/after values for known secret formats
+		for _, key := range []string{"before", "after"} {
+			if omission != nil {
+				break
 			}
-			if matchedPattern, found := AttributeMatchingPattern(name, config.OmitAttributes); found {
-				result.Omissions = append(result.Omissions, OmittedField{
-					Path:   "planned_values.outputs." + name,
-					Reason: fmt.Sprintf("matches pattern '%s'", matchedPattern),
-					Type:   "attribute",
-				})
-				result.Summary.OmittedAttributes++
-				delete(pv.Outputs, name)
+			if d, found := detectSecretValue(getString(change, key), config.Detectors); found {
+				detected := detectorOmission(outputPath, d)
+				omission, rule = &detected, RuleDetectors
 			}
 		}
+
+		if omission != nil {
+			omitNamedValue(outputChanges, name, []string{"before", "after"}, rule, *omission, config, result)
+		}
 	}
-}
 
-// filterPlannedModule recursively filters a planned module and its children
-func filterPlannedModule(pm *PlannedModule, config *MergedConfig, result *FilterResult) {
-	filteredResources := []PlannedResource{}
+	if config.Allowlist != nil {
+		omitNamedValues(outputChanges, "output_changes", result)
+	}
+}
 
-	for _, pr := range pm.Resources {
-		// Check if data sources should be omitted
-		if config.OmitDataSources && pr.Mode == "data" {
-			result.Omissions = append(result.Omissions, OmittedField{
-				Path:   pr.Address,
-				Reason: "data source lookup omitted",
-				Type:   "resource",
-			})
-			result.Summary.OmittedResources++
-			continue
-		}
+// filterPlannedResource filters a resource in the show-json layout (state
+// values, planned_values or prior_state) in place. It returns false if the
+// whole resource should be dropped.
+func filterPlannedResource(pr *object, config *MergedConfig, result *FilterResult) bool {
+	address := getString(pr, "address")
+	if omitResource(address, "", getString(pr, "mode"), getString(pr, "type"), config, result) {
+		capturePlannedResource(pr, config, result)
+		return false
+	}
 
-		// Check platform settings first
-		if ResourceTypeMatches(pr.Type, config.PlatformOmitResourceTypes) {
-			result.Omissions = append(result.Omissions, OmittedField{
-				Path:         pr.Address,
-				Reason:       fmt.Sprintf("resource type '%s' is in omit list", pr.Type),
-				Type:         "resource",
-				FromPlatform: true,
-			})
-			result.Summary.OmittedResources++
-			continue
+	sensitiveValues, _ := pr.get("sensitive_values")
+	sensitiveAttrs := parseSensitiveFromPlan(sensitiveValues)
+	providerSensitive := config.ProviderSchema.lookup(getString(pr, "mode"), getString(pr, "type"))
+	scope := newRuleScope(config, getString(pr, "type"), address)
+	if values := getObject(pr, "values"); values != nil {
+		if config.Allowlist != nil {
+			allowlistAttributes(values, address, address, getString(pr, "type"), sensitiveAttrs, providerSensitive, config, result)
 		}
-		if ResourceTypeMatches(pr.Type, config.OmitResourceTypes) {
-			result.Omissions = append(result.Omissions, OmittedField{
-				Path:   pr.Address,
-				Reason: fmt.Sprintf("resource type '%s' is in omit list", pr.Type),
-				Type:   "resource",
-			})
-			result.Summary.OmittedResources++
-			continue
-		}
-
-		sensitiveAttrs := parseSensitiveFromPlan(pr.SensitiveValues, nil)
-		filtered, omissions := filterAttributes(pr.Values, pr.Address, config, sensitiveAttrs)
-		pr.Values = filtered
-		pr.SensitiveValues = nil
+		filtered, omissions := filterAttributes(values, address, config, sensitiveAttrs, providerSensitive, scope)
+		pr.set("values", filtered)
 		result.Omissions = append(result.Omissions, omissions...)
 		result.Summary.OmittedAttributes += len(omissions)
-
-		filteredResources = append(filteredResources, pr)
 	}
-	pm.Resources = filteredResources
+	pr.remove("sensitive_values")
 
-	for i := range pm.ChildModules {
-		filterPlannedModule(&pm.ChildModules[i], config, result)
-	}
+	return true
 }
 
-// filterVariables filters sensitive variables from the plan
-func filterVariables(vars map[string]interface{}, config *MergedConfig, result *FilterResult) map[string]interface{} {
-	filtered := make(map[string]interface{})
+// capturePlannedResource records the sensitive values of a dropped show-json
+// resource on the most recent omission
+func capturePlannedResource(pr *object, config *MergedConfig, result *FilterResult) {
+	sensitiveValues, _ := pr.get("sensitive_values")
+	providerSensitive := config.ProviderSchema.lookup(getString(pr, "mode"), getString(pr, "type"))
+	captureAttributes(result, getObject(pr, "values"), parseSensitiveFromPlan(sensitiveValues), providerSensitive, config)
+}
 
-	for name, value := range vars {
-		if matchedPattern, found := AttributeMatchingPattern(name, config.OmitAttributes); found {
-			result.Omissions = append(result.Omissions, OmittedField{
-				Path:   "variables." + name,
-				Reason: fmt.Sprintf("matches pattern '%s'", matchedPattern),
-				Type:   "attribute",
-			})
-			result.Summary.OmittedAttributes++
-			continue
+// filterVariables removes sensitive variables from the plan in place.
+// sensitiveVars lists root module variables declared `sensitive = true`.
+func filterVariables(vars *object, config *MergedConfig, result *FilterResult, sensitiveVars map[string]bool) {
+	for _, name := range append([]string{}, vars.orderedKeys()...) {
+		varPath := "variables." + name
+
+		omission, rule := checkNamedValue(name, varPath, config, sensitiveVars[name], ReasonSensitiveVariable)
+
+		// Check the variable value itself for known secret formats
+		if omission == nil {
+			if d, found := detectSecretValue(getString(getObject(vars, name), "value"), config.Detectors); found {
+				detected := detectorOmission(varPath, d)
+				omission, rule = &detected, RuleDetectors
+			}
+		}
+
+		if omission != nil {
+			omitNamedValue(vars, name, []string{"value"}, rule, *omission, config, result)
 		}
-		filtered[name] = value
 	}
 
-	return filtered
+	if config.Allowlist != nil {
+		omitNamedValues(vars, "variables", result)
+	}
 }
@@ -0,0 +1,487 @@
+package filter
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ParseOutputFormat validates an --output-format value
+func ParseOutputFormat(value string) (OutputFormat, error) {
+	format := OutputFormat(strings.ToLower(value))
+	switch format {
+	case OutputFormatText, OutputFormatJSON, OutputFormatSARIF, OutputFormatMarkdown, OutputFormatJUnit:
+		return format, nil
+	}
+	return "", fmt.Errorf("invalid output format '%s' (expected text, json, sarif, markdown or junit)", value)
+}
+
+// reportSection is one category of omissions, in the order the reports show them
+type reportSection struct {
+	id        string // Stable identifier, used for SARIF rule IDs and JUnit class names
+	title     string
+	summary   bool // Shown as a count rather than listed
+	omissions []OmittedField
+}
+
+// sections returns the non-empty categories in report order, matching the
+// text report: organization settings first, then local rules
+func (g omissionGroups) sections() []reportSection {
+	all := []reportSection{
+		{id: "organization-resource", title: "Omitted by Organization Settings", omissions: g.platformResources},
+		{id: "organization-attribute", title: "Omitted by Organization Settings", omissions: g.platformAttributes},
+		{id: "data-source", title: "Omitted Data Source Lookups", summary: true, omissions: g.dataSources},
+		{id: "private-data", title: "Omitted Provider Private Data", summary: true, omissions: g.privateData},
+		{id: "not-allowlisted", title: "Not in Allowlist", summary: true, omissions: g.notAllowlisted},
+		{id: "resource", title: "Omitted Resources", omissions: g.resources},
+		{id: "attribute", title: "Omitted Attributes", omissions: g.attributes},
+		{id: "provider-schema", title: "Sensitive in Provider Schema", omissions: g.providerSchema},
+		{id: "detected", title: "Detected Secret Values", omissions: g.detected},
+	}
+	sections := make([]reportSection, 0, len(all))
+	for _, s := range all {
+		if len(s.omissions) > 0 {
+			sections = append(sections, s)
+		}
+	}
+	return sections
+}
+
+// omissionReason returns an omission's reason, saying when the value was
+// replaced rather than removed
+func omissionReason(o OmittedField) string {
+	if o.Action != "" {
+		return fmt.Sprintf("%s (%s)", o.Reason, o.Action)
+	}
+	return o.Reason
+}
+
+// leakAborts reports whether the leaks found under config stop an upload
+func leakAborts(config *MergedConfig) bool {
+	return config.LeakScan != LeakScanRedact
+}
+
+// SARIF 2.1.0 output, for GitHub code scanning
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// sarifArtifactURI returns the file SARIF results are attached to: the
+// .cora.yaml that produced them, or the Terraform JSON input when the
+// defaults were used. Paths under the working directory are made relative to
+// it, as code scanning expects paths relative to the repository checkout.
+// Input piped on stdin with no .cora.yaml has no file of its own, so results
+// are attached to the .cora.yaml that would configure it.
+func sarifArtifactURI(config *MergedConfig) string {
+	path := config.ConfigPath
+	if path == "" {
+		path = config.InputPath
+	}
+	if path == "" {
+		return ".cora.yaml"
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+}
+
+// leakRuleID is the SARIF rule for copies of removed values
+const leakRuleID = "cora/leak"
+
+func printSARIFReport(w io.Writer, result *FilterResult, config *MergedConfig, configSource string) error {
+	// Code scanning drops results without a file, so every result gets one
+	physical := &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: sarifArtifactURI(config)}}
+	location := func(path, kind string) []sarifLocation {
+		return []sarifLocation{{
+			PhysicalLocation: physical,
+			LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: path, Kind: kind}},
+		}}
+	}
+
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "cora",
+			InformationURI: "https://thecora.app/docs",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+
+	for _, section := range groupOmissions(result.Omissions).sections() {
+		ruleID := "cora/" + section.id
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               ruleID,
+			Name:             section.id,
+			ShortDescription: sarifMessage{Text: section.title},
+		})
+		for _, o := range section.omissions {
+			kind := "member"
+			if o.Type == "resource" {
+				kind = "resource"
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:              ruleID,
+				Level:               "note",
+				Message:             sarifMessage{Text: fmt.Sprintf("%s omitted: %s", o.Path, omissionReason(o))},
+				Locations:           location(o.Path, kind),
+				PartialFingerprints: map[string]string{"coraPath/v1": ruleID + ":" + o.Path},
+			})
+		}
+	}
+
+	if len(result.Leaks) > 0 {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:               leakRuleID,
+			Name:             "leak",
+			ShortDescription: sarifMessage{Text: "Copy of a removed value found in the filtered output"},
+		})
+		level := "warning"
+		if leakAborts(config) {
+			level = "error"
+		}
+		for _, l := range result.Leaks {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:              leakRuleID,
+				Level:               level,
+				Message:             sarifMessage{Text: fmt.Sprintf("%s holds a %s copy of %s", l.Path, l.Encoding, l.Source)},
+				Locations:           location(l.Path, "member"),
+				PartialFingerprints: map[string]string{"coraPath/v1": leakRuleID + ":" + l.Path + ":" + l.Source},
+			})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}})
+}
+
+// Markdown output, for $GITHUB_STEP_SUMMARY and pull request comments
+
+// maxMarkdownRows caps the rows of each Markdown table
+const maxMarkdownRows = 50
+
+func printMarkdownReport(w io.Writer, result *FilterResult, config *MergedConfig, configSource string) error {
+	fmt.Fprintln(w, "## 🔒 Sensitive Data Filter Report")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| | Total | Omitted |")
+	fmt.Fprintln(w, "|---|---:|---:|")
+	fmt.Fprintf(w, "| Resources | %d | %d |\n", result.Summary.TotalResources, result.Summary.OmittedResources)
+	fmt.Fprintf(w, "| Attributes | %d | %d |\n", result.Summary.TotalAttributes, result.Summary.OmittedAttributes)
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Config source: `%s`", configSource)
+	hasPlatformSettings := len(config.PlatformOmitResourceTypes) > 0 || len(config.PlatformOmitAttributes) > 0
+	if config.PlatformEnforced {
+		fmt.Fprint(w, " · Organization settings: enforced")
+	} else if hasPlatformSettings {
+		fmt.Fprint(w, " · Organization settings: active")
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w)
+
+	if len(config.RejectedOverrides) > 0 {
+		fmt.Fprintln(w, "### ⚠️ Rejected Local Overrides")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "These .cora.yaml settings conflict with your organization's settings and were ignored.")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Setting | Value | Reason |")
+		fmt.Fprintln(w, "|---|---|---|")
+		for _, r := range config.RejectedOverrides {
+			fmt.Fprintf(w, "| `%s` | `%s` | %s |\n", r.Setting, markdownCell(r.Value), markdownCell(r.Reason))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if config.Allowlist != nil {
+		printMarkdownKept(w, keptByType(result.Kept))
+	}
+
+	if len(result.Omissions) == 0 {
+		fmt.Fprintln(w, "✅ No sensitive data detected")
+		return nil
+	}
+
+	emoji := map[string]string{
+		"organization-resource":  "🏢",
+		"organization-attribute": "🏢",
+		"data-source":            "📂",
+		"private-data":           "🧩",
+		"not-allowlisted":        "📋",
+		"resource":               "🗑️",
+		"attribute":              "🔐",
+		"provider-schema":        "📐",
+		"detected":               "🔎",
+	}
+	for _, section := range groupOmissions(result.Omissions).sections() {
+		if section.summary {
+			fmt.Fprintf(w, "%s %s: %d\n\n", emoji[section.id], section.title, len(section.omissions))
+			continue
+		}
+
+		fmt.Fprintf(w, "### %s %s\n\n", emoji[section.id], section.title)
+		if section.id == "organization-resource" || section.id == "resource" {
+			fmt.Fprintln(w, "| Resource | Reason |")
+			fmt.Fprintln(w, "|---|---|")
+			for i, o := range section.omissions {
+				if i >= maxMarkdownRows {
+					fmt.Fprintf(w, "| … and %d more | |\n", len(section.omissions)-maxMarkdownRows)
+					break
+				}
+				fmt.Fprintf(w, "| `%s` | %s |\n", markdownCell(o.Path), markdownCell(o.Reason))
+			}
+		} else {
+			grouped := groupAttributeOmissions(section.omissions)
+			fmt.Fprintln(w, "| Attribute | Occurrences | Reason |")
+			fmt.Fprintln(w, "|---|---:|---|")
+			for i, path := range sortedGroupPaths(grouped) {
+				if i >= maxMarkdownRows {
+					fmt.Fprintf(w, "| … and %d more attribute groups | | |\n", len(grouped)-maxMarkdownRows)
+					break
+				}
+				info := grouped[path]
+				if info.count == 1 {
+					path = info.originalPath
+				}
+				fmt.Fprintf(w, "| `%s` | %d | %s |\n", markdownCell(path), info.count, markdownCell(info.reason))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(result.Leaks) > 0 {
+		if leakAborts(config) {
+			fmt.Fprintln(w, "### 🚨 Copies of Removed Values (upload would be aborted)")
+		} else {
+			fmt.Fprintln(w, "### 🩹 Redacted Copies of Removed Values")
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Path | Encoding | Copy of |")
+		fmt.Fprintln(w, "|---|---|---|")
+		for i, l := range result.Leaks {
+			if i >= maxMarkdownRows {
+				fmt.Fprintf(w, "| … and %d more | | |\n", len(result.Leaks)-maxMarkdownRows)
+				break
+			}
+			fmt.Fprintf(w, "| `%s` | %s | `%s` |\n", markdownCell(l.Path), l.Encoding, markdownCell(l.Source))
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+// printMarkdownKept writes the resource types kept in allowlist mode as a table
+func printMarkdownKept(w io.Writer, kept []KeptType) {
+	fmt.Fprintln(w, "### ✅ Kept by Allowlist")
+	fmt.Fprintln(w)
+	if len(kept) == 0 {
+		fmt.Fprintln(w, "No resources matched the allowlist.")
+		fmt.Fprintln(w)
+		return
+	}
+	fmt.Fprintln(w, "| Resource type | Resources | Attributes |")
+	fmt.Fprintln(w, "|---|---:|---|")
+	for i, k := range kept {
+		if i >= maxMarkdownRows {
+			fmt.Fprintf(w, "| … and %d more | | |\n", len(kept)-maxMarkdownRows)
+			break
+		}
+		fmt.Fprintf(w, "| `%s` | %d | %s |\n", markdownCell(k.Type), k.Resources, markdownCell(strings.Join(k.Attributes, ", ")))
+	}
+	fmt.Fprintln(w)
+}
+
+// markdownCell escapes text for a Markdown table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// sortedGroupPaths orders grouped omissions by count descending, then by path
+func sortedGroupPaths(grouped map[string]groupedOmission) []string {
+	paths := make([]string, 0, len(grouped))
+	for path := range grouped {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		ci, cj := grouped[paths[i]], grouped[paths[j]]
+		if ci.count != cj.count {
+			return ci.count > cj.count
+		}
+		return paths[i] < paths[j]
+	})
+	return paths
+}
+
+// JUnit XML output, for CI dashboards. Each omission is a passing test case,
+// so drift shows up as tests appearing or disappearing; a leak that would
+// abort the upload is a failure.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+}
+
+func printJUnitReport(w io.Writer, result *FilterResult, config *MergedConfig, configSource string) error {
+	suites := junitTestSuites{Name: "cora-filter"}
+
+	summary := junitTestSuite{
+		Name: "summary",
+		Properties: []junitProperty{
+			{Name: "config_source", Value: configSource},
+			{Name: "total_resources", Value: fmt.Sprint(result.Summary.TotalResources)},
+			{Name: "omitted_resources", Value: fmt.Sprint(result.Summary.OmittedResources)},
+			{Name: "total_attributes", Value: fmt.Sprint(result.Summary.TotalAttributes)},
+			{Name: "omitted_attributes", Value: fmt.Sprint(result.Summary.OmittedAttributes)},
+			{Name: "enforced", Value: fmt.Sprint(config.PlatformEnforced)},
+		},
+	}
+	suites.Suites = append(suites.Suites, summary)
+
+	for _, section := range groupOmissions(result.Omissions).sections() {
+		suite := junitTestSuite{Name: section.id}
+		for _, o := range section.omissions {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				ClassName: "cora.filter." + section.id,
+				Name:      o.Path,
+				SystemOut: omissionReason(o),
+			})
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if len(result.Leaks) > 0 {
+		suite := junitTestSuite{Name: "leak"}
+		for _, l := range result.Leaks {
+			tc := junitTestCase{
+				ClassName: "cora.filter.leak",
+				Name:      l.Path,
+				SystemOut: fmt.Sprintf("%s copy of %s", l.Encoding, l.Source),
+			}
+			if leakAborts(config) {
+				tc.Failure = &junitFailure{
+					Message: fmt.Sprintf("%s holds a %s copy of %s", l.Path, l.Encoding, l.Source),
+					Type:    "leak",
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	for _, s := range suites.Suites {
+		suites.Tests += s.Tests
+		suites.Failures += s.Failures
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
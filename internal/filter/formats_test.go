@@ -0,0 +1,174 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// reportFixture returns a filter result covering several report categories
+func reportFixture() *FilterResult {
+	return &FilterResult{
+		Omissions: []OmittedField{
+			{Path: "random_password.db", Reason: "resource type 'random_password' is in omit list", Type: "resource"},
+			{Path: "data.aws_ami.ubuntu", Reason: ReasonDataSource, Type: "resource"},
+			{Path: "aws_db_instance.main.password", Reason: "matches pattern 'password'", Type: "attribute", Action: "redacted"},
+			{Path: "aws_instance.web.user_data", Reason: "value matches detector 'aws_access_key'", Type: "attribute", Detector: "aws_access_key"},
+			{Path: "aws_iam_user.ci.tags[\"a|b\"]", Reason: "matches organization pattern 'tags'", Type: "attribute", FromPlatform: true},
+		},
+		Summary: FilterSummary{TotalResources: 5, OmittedResources: 2, TotalAttributes: 20, OmittedAttributes: 3},
+		Leaks: []Leak{
+			{Path: "resources[3].instances[0].attributes.connection_string", Source: "aws_db_instance.main.password", Encoding: "plain"},
+		},
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, value := range []string{"text", "json", "SARIF", "markdown", "junit"} {
+		if _, err := ParseOutputFormat(value); err != nil {
+			t.Errorf("ParseOutputFormat(%q): unexpected error %v", value, err)
+		}
+	}
+	if _, err := ParseOutputFormat("html"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+func TestSARIFReport(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteReport(&out, reportFixture(), DefaultConfig(), ".cora.yaml", OutputFormatSARIF); err != nil {
+		t.Fatalf("WriteReport failed: %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("Invalid SARIF JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("Unexpected SARIF envelope: %+v", log)
+	}
+
+	run := log.Runs[0]
+	wantRules := []string{"cora/organization-attribute", "cora/data-source", "cora/resource", "cora/attribute", "cora/detected", leakRuleID}
+	if len(run.Tool.Driver.Rules) != len(wantRules) {
+		t.Fatalf("Expected rules %v, got %+v", wantRules, run.Tool.Driver.Rules)
+	}
+	for i, rule := range run.Tool.Driver.Rules {
+		if rule.ID != wantRules[i] {
+			t.Errorf("Expected rule %d to be %s, got %s", i, wantRules[i], rule.ID)
+		}
+	}
+	if len(run.Results) != 6 {
+		t.Fatalf("Expected 6 results, got %d", len(run.Results))
+	}
+
+	leak := run.Results[len(run.Results)-1]
+	if leak.RuleID != leakRuleID || leak.Level != "error" {
+		t.Errorf("Expected the leak as an error, got %+v", leak)
+	}
+	if leak.Locations[0].PhysicalLocation.ArtifactLocation.URI != ".cora.yaml" {
+		t.Errorf("Expected results attached to .cora.yaml, got %+v", leak.Locations[0])
+	}
+}
+
+func TestSARIFResultsHaveArtifactLocations(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		configPath string
+		inputPath  string
+		want       string
+	}{
+		{name: "config file", configPath: filepath.Join(cwd, "infra", ".cora.yaml"), inputPath: "plan.json", want: "infra/.cora.yaml"},
+		{name: "defaults with an input file", inputPath: filepath.Join("build", "plan.json"), want: "build/plan.json"},
+		{name: "defaults on stdin", want: ".cora.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.ConfigPath, config.InputPath = tt.configPath, tt.inputPath
+			var out bytes.Buffer
+			if err := WriteReport(&out, reportFixture(), config, "defaults", OutputFormatSARIF); err != nil {
+				t.Fatalf("WriteReport failed: %v", err)
+			}
+			var log sarifLog
+			if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+				t.Fatalf("Invalid SARIF JSON: %v", err)
+			}
+			for _, result := range log.Runs[0].Results {
+				if len(result.Locations) == 0 || result.Locations[0].PhysicalLocation == nil {
+					t.Fatalf("Expected every result to have a physical location, got %+v", result)
+				}
+				if uri := result.Locations[0].PhysicalLocation.ArtifactLocation.URI; uri != tt.want {
+					t.Errorf("Expected results attached to %s, got %s", tt.want, uri)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkdownReport(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteReport(&out, reportFixture(), DefaultConfig(), "defaults", OutputFormatMarkdown); err != nil {
+		t.Fatalf("WriteReport failed: %v", err)
+	}
+	report := out.String()
+
+	for _, want := range []string{
+		"## 🔒 Sensitive Data Filter Report",
+		"| Resources | 5 | 2 |",
+		"### 🏢 Omitted by Organization Settings",
+		"📂 Omitted Data Source Lookups: 1",
+		"| `random_password.db` | resource type 'random_password' is in omit list |",
+		"| `aws_db_instance.main.password` | 1 | matches pattern 'password' (redacted) |",
+		"### 🔎 Detected Secret Values",
+		"### 🚨 Copies of Removed Values (upload would be aborted)",
+		`a\|b`,
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("Expected report to contain %q, got:\n%s", want, report)
+		}
+	}
+}
+
+func TestJUnitReport(t *testing.T) {
+	tests := []struct {
+		name         string
+		leakScan     LeakScanMode
+		wantFailures int
+	}{
+		{"abort fails on leaks", LeakScanAbort, 1},
+		{"redact passes", LeakScanRedact, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.LeakScan = tt.leakScan
+
+			var out bytes.Buffer
+			if err := WriteReport(&out, reportFixture(), config, "defaults", OutputFormatJUnit); err != nil {
+				t.Fatalf("WriteReport failed: %v", err)
+			}
+
+			var suites junitTestSuites
+			if err := xml.Unmarshal(out.Bytes(), &suites); err != nil {
+				t.Fatalf("Invalid JUnit XML: %v", err)
+			}
+			if suites.Tests != 6 {
+				t.Errorf("Expected 6 tests, got %d", suites.Tests)
+			}
+			if suites.Failures != tt.wantFailures {
+				t.Errorf("Expected %d failures, got %d", tt.wantFailures, suites.Failures)
+			}
+		})
+	}
+}
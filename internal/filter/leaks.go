@@ -0,0 +1,505 @@
+package filter
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// LeakScanMode controls what happens when a value the filter removed is still
+// found somewhere else in the filtered output
+type LeakScanMode string
+
+const (
+	// LeakScanAbort reports the leaks and stops the upload (the default)
+	LeakScanAbort LeakScanMode = "abort"
+	// LeakScanRedact replaces each leaked occurrence with RedactedPlaceholder
+	LeakScanRedact LeakScanMode = "redact"
+	// LeakScanOff skips the scan
+	LeakScanOff LeakScanMode = "off"
+)
+
+// minLeakLength is the shortest removed value the leak scan looks for.
+// Shorter values (ports, booleans, short names) turn up all over a payload
+// without having been copied from the removed one.
+const minLeakLength = 8
+
+// Leak is a copy of a removed value found elsewhere in the filtered output
+type Leak struct {
+	Path     string `json:"path"`             // JSON path of the string holding the copy (e.g. "resources[2].instances[0].attributes.connection_string")
+	Source   string `json:"source"`           // Path of the omission the value was removed from
+	Encoding string `json:"encoding"`         // "plain", "base64" or "url", the form the copy was found in
+	Action   string `json:"action,omitempty"` // "redacted" if the copy was replaced
+}
+
+// parseLeakScanMode validates the filtering.leak_scan setting
+func parseLeakScanMode(value string) (LeakScanMode, error) {
+	mode := LeakScanMode(strings.ToLower(value))
+	switch mode {
+	case "":
+		return LeakScanAbort, nil
+	case LeakScanAbort, LeakScanRedact, LeakScanOff:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid leak_scan '%s' (expected abort, redact or off)", value)
+}
+
+// capture records the secret strings inside a removed value, so the leak scan
+// can look for copies of them. A value removed because it is known to be
+// secret is recorded whole; one removed only because its name matched a
+// pattern is not known to be secret (an environment variable name, a
+// secret_id), so only the parts of it that Terraform or the provider mark
+// sensitive, and the strings a detector flags, are recorded.
+// Placeholders and digests from an earlier filtering pass are skipped, and so
+// are identifiers: a removed secret_id or *_arn names an object that kept
+// resources refer to as well.
+func (o *OmittedField) capture(value interface{}, config *MergedConfig) {
+	if isIdentifierAttribute(pathKey(o.Path)) {
+		return
+	}
+	if o.isSecret() {
+		o.values = captureStrings(o.values, value)
+		return
+	}
+	o.values = captureSecretValues(o.values, value, o.sensitive, o.schema, config)
+}
+
+// captureStrings appends the strings inside value to values, skipping the
+// values of identifier attributes
+func captureStrings(values []string, value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if len(v) >= minLeakLength && v != RedactedPlaceholder && !strings.HasPrefix(v, hashPrefix) {
+			values = append(values, v)
+		}
+	case *object:
+		for _, key := range v.orderedKeys() {
+			if !isIdentifierAttribute(key) {
+				values = captureStrings(values, v.values[key])
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			values = captureStrings(values, item)
+		}
+	}
+	return values
+}
+
+// isIdentifierAttribute reports whether an attribute name marks an identifier
+// (id, arn, name, *_id, *_arn), whose value is expected to appear elsewhere
+func isIdentifierAttribute(name string) bool {
+	name = strings.ToLower(name)
+	return name == "id" || name == "arn" || name == "name" ||
+		strings.HasSuffix(name, "_id") || strings.HasSuffix(name, "_arn")
+}
+
+// pathKey returns the last attribute name in an omission path, e.g. "secret_id"
+// for "aws_secretsmanager_secret_version.db.secret_id" or "tags" for "x.y.tags[0]"
+func pathKey(path string) string {
+	for strings.HasSuffix(path, "]") {
+		i := strings.LastIndex(path, "[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return path[strings.LastIndex(path, ".")+1:]
+}
+
+// isSecret reports whether an omission removed a value known to be secret:
+// one marked sensitive by Terraform or the provider schema, declared
+// sensitive, or flagged by a detector. A name pattern only says the attribute
+// is related to secrets, as secret_id and kms_key are.
+func (o *OmittedField) isSecret() bool {
+	return o.Detector != "" || o.Reason == ReasonTerraformSensitive ||
+		o.Reason == ReasonProviderSchema || o.Reason == ReasonSensitiveVariable
+}
+
+// captureAttributes records on the most recent omission in result the secret
+// values in attrs. It is used for resources that omitResource dropped whole:
+// their ids and names are routinely referenced by the resources that are kept,
+// so only their secret values are looked for.
+func captureAttributes(result *FilterResult, attrs *object, sensitive *sensitivePaths, schema *schemaNode, config *MergedConfig) {
+	if attrs == nil || len(result.Omissions) == 0 {
+		return
+	}
+	omission := &result.Omissions[len(result.Omissions)-1]
+	omission.values = captureSecretValues(omission.values, attrs, sensitive, schema, config)
+}
+
+// captureSecretValues appends the secret values inside value to values: the
+// values marked sensitive by Terraform or the provider schema, and strings
+// flagged by a detector. Identifier attributes are skipped.
+func captureSecretValues(values []string, value interface{}, sensitive *sensitivePaths, schema *schemaNode, config *MergedConfig) []string {
+	if (config.HonorTerraformSensitive && sensitive.isSensitive()) || schema.isSensitive() {
+		return captureStrings(values, value)
+	}
+	switch v := value.(type) {
+	case string:
+		if _, found := detectSecretValue(v, config.Detectors); found {
+			values = captureStrings(values, v)
+		}
+	case *object:
+		for _, key := range v.orderedKeys() {
+			if !isIdentifierAttribute(key) {
+				values = captureSecretValues(values, v.values[key], sensitive.child(key), schema.child(key), config)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			values = captureSecretValues(values, item, sensitive.index(i), schema.index(i), config)
+		}
+	}
+	return values
+}
+
+// captureSecrets adds the values of the secret omissions to omission
+func captureSecrets(omission *OmittedField, omissions []OmittedField) {
+	for _, o := range omissions {
+		if o.isSecret() {
+			omission.values = append(omission.values, o.values...)
+		}
+	}
+}
+
+// captureExpressions is captureAttributes for the expressions of a dropped
+// configuration block
+func captureExpressions(result *FilterResult, block *object, scope *ruleScope, config *MergedConfig) {
+	expressions := getObject(block, "expressions")
+	if expressions == nil || len(result.Omissions) == 0 {
+		return
+	}
+	omission := &result.Omissions[len(result.Omissions)-1]
+	_, omissions := filterExpressions(expressions, omission.Path, scope, config)
+	captureSecrets(omission, omissions)
+}
+
+// ScanLeaks searches filtered output for copies of the values recorded in
+// result's omissions, as-is or base64 or URL encoded, and records each one in
+// result.Leaks. The output is copied to w, with every copy replaced by
+// RedactedPlaceholder if config.LeakScan is LeakScanRedact.
+//
+// The filter streams its output, so a value removed late in the document may
+// already have been written elsewhere; the scan is a second pass over the
+// finished output for that reason.
+func ScanLeaks(filtered io.Reader, w io.Writer, result *FilterResult, config *MergedConfig) error {
+	index := newLeakIndex(result.Omissions)
+	if index == nil {
+		if _, err := io.Copy(w, filtered); err != nil {
+			return fmt.Errorf("failed to scan for leaks: %w", err)
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(filtered)
+	dec.UseNumber()
+	s := &leakScanner{
+		dec:    dec,
+		w:      bufio.NewWriter(w),
+		index:  index,
+		redact: config.LeakScan == LeakScanRedact,
+	}
+
+	tok, err := dec.Token()
+	if err == nil {
+		err = s.value(tok, "")
+	}
+	if err == nil {
+		err = s.w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to scan for leaks: %w", err)
+	}
+
+	result.Leaks = s.leaks
+	return nil
+}
+
+// leakTarget is one encoded form of a removed value
+type leakTarget struct {
+	form     string
+	source   string
+	encoding string
+}
+
+// leakFilterBits sizes the prefilter bitset (2^24 bits, 2 MiB)
+const leakFilterBits = 24
+
+// leakIndex finds the encoded forms of removed values in strings. Every form is
+// at least minLeakLength bytes long, so candidates are looked up by their first
+// eight bytes, behind a bitset that rules out almost every position cheaply.
+type leakIndex struct {
+	filter  []uint64
+	targets map[uint64][]leakTarget
+}
+
+// newLeakIndex indexes the values recorded on omissions, or returns nil if
+// there are none. When two omissions removed the same value, the first is
+// reported as the source.
+func newLeakIndex(omissions []OmittedField) *leakIndex {
+	var index *leakIndex
+	seen := make(map[string]bool)
+
+	add := func(form, source, encoding string) {
+		if len(form) < minLeakLength || seen[form] {
+			return
+		}
+		seen[form] = true
+		if index == nil {
+			index = &leakIndex{
+				filter:  make([]uint64, 1<<(leakFilterBits-6)),
+				targets: make(map[uint64][]leakTarget),
+			}
+		}
+		window := leakWindow(form, 0)
+		h := leakHash(window)
+		index.filter[h/64] |= 1 << (h % 64)
+		index.targets[window] = append(index.targets[window], leakTarget{form: form, source: source, encoding: encoding})
+	}
+
+	for _, o := range omissions {
+		for _, v := range o.values {
+			add(v, o.Path, "plain")
+
+			// Only whole 3-byte groups encode the same way wherever the value sits
+			// in the encoded data, so the trailing partial group is left off
+			aligned := v[:len(v)/3*3]
+			add(base64.RawStdEncoding.EncodeToString([]byte(aligned)), o.Path, "base64")
+			add(base64.RawURLEncoding.EncodeToString([]byte(aligned)), o.Path, "base64")
+
+			add(url.QueryEscape(v), o.Path, "url")
+			add(url.PathEscape(v), o.Path, "url")
+		}
+	}
+
+	return index
+}
+
+// leakWindow reads the eight bytes of s starting at i as an integer
+func leakWindow(s string, i int) uint64 {
+	var w uint64
+	for j := 7; j >= 0; j-- {
+		w = w<<8 | uint64(s[i+j])
+	}
+	return w
+}
+
+// leakHash maps a window to a bit in the prefilter
+func leakHash(window uint64) uint64 {
+	return (window * 0x9E3779B97F4A7C15) >> (64 - leakFilterBits)
+}
+
+// leakMatch is an occurrence of a target in a string
+type leakMatch struct {
+	start, end int
+	target     *leakTarget
+}
+
+// find returns the non-overlapping occurrences of any target in s, preferring
+// the longest target at each position
+func (x *leakIndex) find(s string) []leakMatch {
+	if len(s) < minLeakLength {
+		return nil
+	}
+
+	var matches []leakMatch
+	window := leakWindow(s, 0)
+	for i := 0; ; {
+		if h := leakHash(window); x.filter[h/64]&(1<<(h%64)) != 0 {
+			var best *leakTarget
+			candidates := x.targets[window]
+			for j := range candidates {
+				t := &candidates[j]
+				if strings.HasPrefix(s[i:], t.form) && (best == nil || len(t.form) > len(best.form)) {
+					best = t
+				}
+			}
+			if best != nil {
+				matches = append(matches, leakMatch{start: i, end: i + len(best.form), target: best})
+				i += len(best.form)
+				if i+8 > len(s) {
+					break
+				}
+				window = leakWindow(s, i)
+				continue
+			}
+		}
+
+		if i+8 >= len(s) {
+			break
+		}
+		window = window>>8 | uint64(s[i+8])<<56
+		i++
+	}
+	return matches
+}
+
+// replaceLeaks returns s with each match replaced by RedactedPlaceholder
+func replaceLeaks(s string, matches []leakMatch) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m.start])
+		b.WriteString(RedactedPlaceholder)
+		last = m.end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// leakScanner copies a JSON document token by token, checking every string
+type leakScanner struct {
+	dec    *json.Decoder
+	w      *bufio.Writer
+	index  *leakIndex
+	redact bool
+	leaks  []Leak
+}
+
+// value copies the value starting with tok, located at path
+func (s *leakScanner) value(tok json.Token, path string) error {
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			return s.object(path)
+		}
+		return s.array(path)
+	case string:
+		return encodeString(s.w, s.check(v, path))
+	default:
+		return encodeValue(s.w, v)
+	}
+}
+
+// object copies the members of an object whose opening brace has been read
+func (s *leakScanner) object(path string) error {
+	s.w.WriteByte('{')
+	for i := 0; s.dec.More(); i++ {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("invalid object key %v", tok)
+		}
+
+		// A key holding a copy is reported by its redacted form, so the
+		// report does not repeat the value it warns about
+		shown := key
+		if matches := s.index.find(key); len(matches) > 0 {
+			shown = replaceLeaks(key, matches)
+		}
+		memberPath := shown
+		if path != "" {
+			memberPath = path + "." + shown
+		}
+
+		if i > 0 {
+			s.w.WriteByte(',')
+		}
+		if err := encodeString(s.w, s.check(key, memberPath)); err != nil {
+			return err
+		}
+		s.w.WriteByte(':')
+
+		tok, err = s.dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := s.value(tok, memberPath); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	s.w.WriteByte('}')
+	return nil
+}
+
+// array copies the elements of an array whose opening bracket has been read
+func (s *leakScanner) array(path string) error {
+	s.w.WriteByte('[')
+	for i := 0; s.dec.More(); i++ {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			s.w.WriteByte(',')
+		}
+		if err := s.value(tok, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	s.w.WriteByte(']')
+	return nil
+}
+
+// check records the copies found in text, located at path, and returns the
+// text to write
+func (s *leakScanner) check(text, path string) string {
+	matches := s.index.find(text)
+	if len(matches) == 0 {
+		return text
+	}
+
+	action := ""
+	if s.redact {
+		action = "redacted"
+	}
+	for _, m := range matches {
+		s.leaks = append(s.leaks, Leak{
+			Path:     path,
+			Source:   m.target.source,
+			Encoding: m.target.encoding,
+			Action:   action,
+		})
+	}
+
+	if s.redact {
+		return replaceLeaks(text, matches)
+	}
+	return text
+}
+
+// LeakError is returned when the leak scan finds copies of removed values and
+// config.LeakScan is LeakScanAbort
+type LeakError struct {
+	Leaks []Leak
+}
+
+func (e *LeakError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "found %d copies of removed sensitive values in the filtered output:", len(e.Leaks))
+	for i, l := range e.Leaks {
+		if i >= maxLeaksShown {
+			fmt.Fprintf(&b, "\n  ... and %d more", len(e.Leaks)-maxLeaksShown)
+			break
+		}
+		fmt.Fprintf(&b, "\n  %s (%s copy of %s)", l.Path, l.Encoding, l.Source)
+	}
+	b.WriteString("\n\nOmit the attributes holding the copies, or set filtering.leak_scan to 'redact' in .cora.yaml")
+	return b.String()
+}
+
+// maxLeaksShown caps the leaks listed in a LeakError
+const maxLeaksShown = 20
+
+// CheckLeaks returns a *LeakError if the leak scan found copies of removed
+// values that config says should abort the upload
+func CheckLeaks(result *FilterResult, config *MergedConfig) error {
+	if config.LeakScan != LeakScanAbort || len(result.Leaks) == 0 {
+		return nil
+	}
+	return &LeakError{Leaks: result.Leaks}
+}
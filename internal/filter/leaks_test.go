@@ -0,0 +1,257 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const leakPassword = "s3cr3t-Passw0rd!"
+
+var leakStateJSON = `{
+  "version": 4,
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_db_instance",
+      "name": "main",
+      "instances": [
+        {
+          "attributes": {
+            "identifier": "main",
+            "password": "` + leakPassword + `",
+            "port": 5432
+          },
+          "sensitive_attributes": [[{"type": "get_attr", "value": "password"}]]
+        }
+      ]
+    },
+    {
+      "mode": "managed",
+      "type": "terraform_data",
+      "name": "app",
+      "instances": [
+        {
+          "attributes": {
+            "id": "app",
+            "input": "postgres://admin:` + url.QueryEscape(leakPassword) + `@db:5432/app",
+            "tags": {"init": "` + base64.StdEncoding.EncodeToString([]byte("PASSWORD="+leakPassword)) + `"}
+          }
+        }
+      ]
+    }
+  ]
+}`
+
+// scanState filters leakStateJSON and runs the leak scan on the result
+func scanState(t *testing.T, config *MergedConfig) (*FilterResult, string) {
+	t.Helper()
+	result, err := Filter([]byte(leakStateJSON), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := ScanLeaks(bytes.NewReader(result.FilteredJSON), &out, result, config); err != nil {
+		t.Fatalf("ScanLeaks failed: %v", err)
+	}
+	return result, out.String()
+}
+
+func TestScanLeaksFindsEncodedCopies(t *testing.T) {
+	config := DefaultConfig()
+	result, out := scanState(t, config)
+
+	if out != string(result.FilteredJSON) {
+		t.Errorf("Expected abort mode to copy the output unchanged")
+	}
+
+	want := map[string]string{
+		"resources[1].instances[0].attributes.input":     "url",
+		"resources[1].instances[0].attributes.tags.init": "base64",
+	}
+	if len(result.Leaks) != len(want) {
+		t.Fatalf("Expected %d leaks, got %+v", len(want), result.Leaks)
+	}
+	for _, l := range result.Leaks {
+		if want[l.Path] != l.Encoding {
+			t.Errorf("Unexpected leak %+v", l)
+		}
+		if l.Source != "aws_db_instance.main.password" {
+			t.Errorf("Expected the password omission as source, got %q", l.Source)
+		}
+	}
+
+	var leakErr *LeakError
+	if err := CheckLeaks(result, config); !errors.As(err, &leakErr) {
+		t.Fatalf("Expected a LeakError, got %v", err)
+	}
+	if strings.Contains(leakErr.Error(), leakPassword) {
+		t.Errorf("Leak error repeats the value it reports")
+	}
+}
+
+func TestScanLeaksRedactsCopies(t *testing.T) {
+	config := DefaultConfig()
+	config.LeakScan = LeakScanRedact
+	result, out := scanState(t, config)
+
+	if len(result.Leaks) != 2 {
+		t.Fatalf("Expected 2 leaks, got %+v", result.Leaks)
+	}
+	for _, l := range result.Leaks {
+		if l.Action != "redacted" {
+			t.Errorf("Expected leak at %s to be redacted", l.Path)
+		}
+	}
+	if strings.Contains(out, url.QueryEscape(leakPassword)) {
+		t.Errorf("URL encoded copy survived redaction: %s", out)
+	}
+	if !strings.Contains(out, "postgres://admin:"+RedactedPlaceholder+"@db:5432/app") {
+		t.Errorf("Expected the copy replaced in place, got %s", out)
+	}
+	if err := CheckLeaks(result, config); err != nil {
+		t.Errorf("Expected no error in redact mode, got %v", err)
+	}
+}
+
+func TestScanLeaksDroppedResource(t *testing.T) {
+	config := DefaultConfig()
+	config.OmitResourceTypes = append(config.OmitResourceTypes, "aws_db_instance")
+	result, _ := scanState(t, config)
+
+	if len(result.Leaks) != 2 {
+		t.Fatalf("Expected the dropped resource's password to be scanned for, got %+v", result.Leaks)
+	}
+	for _, l := range result.Leaks {
+		if l.Source != "aws_db_instance.main" {
+			t.Errorf("Expected the dropped resource as source, got %q", l.Source)
+		}
+	}
+}
+
+func TestScanLeaksIgnoresShortValues(t *testing.T) {
+	stateJSON := `{"version": 4, "resources": [{"mode": "managed", "type": "aws_instance", "name": "web", "instances": [{"attributes": {"password": "abc", "name": "abc"}}]}]}`
+	config := DefaultConfig()
+	result, err := Filter([]byte(stateJSON), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if err := ScanLeaks(bytes.NewReader(result.FilteredJSON), &bytes.Buffer{}, result, config); err != nil {
+		t.Fatalf("ScanLeaks failed: %v", err)
+	}
+	if len(result.Leaks) != 0 {
+		t.Errorf("Expected short values to be ignored, got %+v", result.Leaks)
+	}
+}
+
+func TestParseLeakScanMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    LeakScanMode
+		wantErr bool
+	}{
+		{value: "", want: LeakScanAbort},
+		{value: "Redact", want: LeakScanRedact},
+		{value: "off", want: LeakScanOff},
+		{value: "warn", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseLeakScanMode(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseLeakScanMode(%q): expected an error", tt.value)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseLeakScanMode(%q) = %q, %v; want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestScanLeaksIgnoresIdentifiersOfDroppedResources(t *testing.T) {
+	secretARN := "arn:aws:secretsmanager:us-east-1:123456789012:secret:db-AbCdEf"
+	stateJSON := `{
+  "version": 4,
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_secretsmanager_secret",
+      "name": "db",
+      "instances": [{"attributes": {"id": "` + secretARN + `", "arn": "` + secretARN + `", "name": "db"}}]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_secretsmanager_secret_version",
+      "name": "db",
+      "instances": [
+        {
+          "attributes": {
+            "id": "` + secretARN + `|v1",
+            "secret_id": "` + secretARN + `",
+            "secret_string": "` + leakPassword + `",
+            "version_id": "terraform-20240101"
+          },
+          "sensitive_attributes": [[{"type": "get_attr", "value": "secret_string"}]]
+        }
+      ]
+    }
+  ]
+}`
+
+	config := DefaultConfig()
+	result, err := Filter([]byte(stateJSON), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if !hasOmission(result, "aws_secretsmanager_secret_version.db") {
+		t.Fatal("Expected the secret version to be dropped")
+	}
+	if err := ScanLeaks(bytes.NewReader(result.FilteredJSON), &bytes.Buffer{}, result, config); err != nil {
+		t.Fatalf("ScanLeaks failed: %v", err)
+	}
+	if err := CheckLeaks(result, config); err != nil {
+		t.Errorf("Expected the secret's ARN not to count as a leak, got %v", err)
+	}
+
+	// The secret value itself is still looked for
+	copied := strings.Replace(stateJSON, `"name": "db"}}]`, `"name": "db", "description": "`+leakPassword+`"}}]`, 1)
+	result, err = Filter([]byte(copied), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if err := ScanLeaks(bytes.NewReader(result.FilteredJSON), &bytes.Buffer{}, result, config); err != nil {
+		t.Fatalf("ScanLeaks failed: %v", err)
+	}
+	if len(result.Leaks) != 1 || result.Leaks[0].Source != "aws_secretsmanager_secret_version.db" {
+		t.Errorf("Expected the copied secret string to be found, got %+v", result.Leaks)
+	}
+}
+
+func TestScanLeaksIgnoresValuesRemovedByName(t *testing.T) {
+	// "secret" matches a name pattern, but its value is only the name of an
+	// environment variable, which the description mentions as well
+	stateJSON := `{"version": 4, "resources": [{"mode": "managed", "type": "aws_ecs_task_definition", "name": "app", "instances": [{"attributes": {
+  "secret": "PAYMENTS_API_KEY",
+  "description": "Reads PAYMENTS_API_KEY from the environment"
+}}]}]}`
+	config := DefaultConfig()
+	result, err := Filter([]byte(stateJSON), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if !hasOmission(result, "aws_ecs_task_definition.app.secret") {
+		t.Fatal("Expected the secret attribute to be omitted")
+	}
+	if err := ScanLeaks(bytes.NewReader(result.FilteredJSON), &bytes.Buffer{}, result, config); err != nil {
+		t.Fatalf("ScanLeaks failed: %v", err)
+	}
+	if err := CheckLeaks(result, config); err != nil {
+		t.Errorf("Expected a value removed only by name not to count as a leak, got %v", err)
+
+	}
+}
@@ -0,0 +1,223 @@
+package filter
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxCachedNames bounds the per-matcher result cache. Attribute names repeat
+// heavily across resources, but map keys (tags, environment variables) can be
+// unbounded, so past this size results are computed without being stored.
+const maxCachedNames = 1 << 16
+
+// attributeMatcher is a pattern list compiled for fast repeated matching.
+// Substring patterns are combined into one Aho-Corasick automaton, so each
+// name is scanned once regardless of how many patterns there are, and results
+// are cached per unique name. It gives the same answers as
+// AttributeMatchingPatternExcept and is safe for concurrent use.
+type attributeMatcher struct {
+	patterns   []string
+	exceptions []string
+	automaton  *automaton
+	words      [][]string // Split words of each word-mode pattern, nil for substring patterns
+	hasWords   bool
+
+	cache     sync.Map // name -> matchResult
+	cacheSize atomic.Int64
+}
+
+// matchResult is a cached match outcome
+type matchResult struct {
+	pattern string
+	found   bool
+}
+
+// newAttributeMatcher compiles a pattern list and its word-mode exceptions
+func newAttributeMatcher(patterns, exceptions []string) *attributeMatcher {
+	m := &attributeMatcher{
+		patterns:   patterns,
+		exceptions: exceptions,
+		words:      make([][]string, len(patterns)),
+	}
+
+	substrings := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if strings.HasPrefix(pattern, wordMatchPrefix) {
+			m.words[i] = splitWords(strings.TrimPrefix(pattern, wordMatchPrefix))
+			m.hasWords = true
+			substrings[i] = "" // Not part of the automaton
+			continue
+		}
+		substrings[i] = pattern
+	}
+	m.automaton = newAutomaton(substrings, m.words)
+
+	return m
+}
+
+// match returns the first pattern, in list order, that matches name
+func (m *attributeMatcher) match(name string) (string, bool) {
+	if cached, ok := m.cache.Load(name); ok {
+		r := cached.(matchResult)
+		return r.pattern, r.found
+	}
+
+	best := m.automaton.firstMatch(toLowerCase(name))
+
+	// Word-mode patterns only need checking if they come before the best substring match
+	if m.hasWords {
+		var words []string
+		for i, seq := range m.words {
+			if best >= 0 && i >= best {
+				break
+			}
+			if seq == nil {
+				continue
+			}
+			if words == nil {
+				words = splitWords(name)
+			}
+			if containsWords(words, seq) && !isAttributeException(words, m.exceptions) {
+				best = i
+				break
+			}
+		}
+	}
+
+	result := matchResult{}
+	if best >= 0 {
+		result = matchResult{pattern: m.patterns[best], found: true}
+	}
+	if m.cacheSize.Load() < maxCachedNames {
+		if _, loaded := m.cache.LoadOrStore(name, result); !loaded {
+			m.cacheSize.Add(1)
+		}
+	}
+	return result.pattern, result.found
+}
+
+// automaton is an Aho-Corasick automaton over bytes, compiled to a full
+// transition table. Each state records the lowest index of any pattern that
+// ends there, so a single pass finds the first pattern in list order.
+type automaton struct {
+	next   [][256]int32
+	output []int32 // Lowest pattern index ending at each state, or -1
+}
+
+// newAutomaton builds the automaton for the substring patterns. Entries with
+// a non-nil skip entry (word-mode patterns) are left out.
+func newAutomaton(patterns []string, skip [][]string) *automaton {
+	a := &automaton{}
+	a.addState()
+
+	// Build the trie
+	for i, pattern := range patterns {
+		if skip[i] != nil {
+			continue
+		}
+		state := int32(0)
+		for j := 0; j < len(pattern); j++ {
+			c := pattern[j]
+			if a.next[state][c] == 0 {
+				a.next[state][c] = a.addState()
+			}
+			state = a.next[state][c]
+		}
+		if a.output[state] < 0 || int32(i) < a.output[state] {
+			a.output[state] = int32(i)
+		}
+	}
+
+	// Add failure transitions breadth-first, turning the trie into a DFA
+	fail := make([]int32, len(a.next))
+	var queue []int32
+	for c := 0; c < 256; c++ {
+		if s := a.next[0][c]; s != 0 {
+			queue = append(queue, s)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		// A state also matches everything its failure state matches
+		if f := a.output[fail[state]]; f >= 0 && (a.output[state] < 0 || f < a.output[state]) {
+			a.output[state] = f
+		}
+
+		for c := 0; c < 256; c++ {
+			child := a.next[state][c]
+			if child == 0 {
+				a.next[state][c] = a.next[fail[state]][c]
+				continue
+			}
+			fail[child] = a.next[fail[state]][c]
+			queue = append(queue, child)
+		}
+	}
+
+	return a
+}
+
+// addState appends an empty state and returns its index
+func (a *automaton) addState() int32 {
+	a.next = append(a.next, [256]int32{})
+	a.output = append(a.output, -1)
+	return int32(len(a.next) - 1)
+}
+
+// firstMatch returns the lowest index of any pattern found in s, or -1
+func (a *automaton) firstMatch(s string) int {
+	best := a.output[0] // An empty pattern matches everything
+	state := int32(0)
+	for i := 0; i < len(s); i++ {
+		state = a.next[state][s[i]]
+		if out := a.output[state]; out >= 0 && (best < 0 || out < best) {
+			best = out
+			if best == 0 {
+				break
+			}
+		}
+	}
+	return int(best)
+}
+
+// compiledMatchers holds the matchers for a MergedConfig, along with the
+// pattern slices they were built from so that changes can be detected.
+type compiledMatchers struct {
+	local, platform           *attributeMatcher
+	localID, platformID, exID sliceID
+}
+
+// sliceID identifies a slice by its backing array and length
+type sliceID struct {
+	first *string
+	n     int
+}
+
+func idOf(s []string) sliceID {
+	if len(s) == 0 {
+		return sliceID{}
+	}
+	return sliceID{first: &s[0], n: len(s)}
+}
+
+// matchers returns the compiled matchers for the config's attribute patterns,
+// compiling them on first use and again whenever the pattern lists are replaced.
+func (m *MergedConfig) matchers() *compiledMatchers {
+	localID, platformID, exID := idOf(m.OmitAttributes), idOf(m.PlatformOmitAttributes), idOf(m.AttributeExceptions)
+	if c := m.compiled.Load(); c != nil && c.localID == localID && c.platformID == platformID && c.exID == exID {
+		return c
+	}
+
+	c := &compiledMatchers{
+		local:      newAttributeMatcher(m.OmitAttributes, m.AttributeExceptions),
+		platform:   newAttributeMatcher(m.PlatformOmitAttributes, m.AttributeExceptions),
+		localID:    localID,
+		platformID: platformID,
+		exID:       exID,
+	}
+	m.compiled.Store(c)
+	return c
+}
@@ -0,0 +1,75 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestAttributeMatcherMatchesLinearScan(t *testing.T) {
+	patterns := append(append([]string{}, DefaultOmitAttributes...),
+		"word:key",
+		"word:client_secret",
+		"API_KEY", // Uppercase substring patterns never match lowercased names
+		"ssn",
+	)
+	names := []string{
+		"password", "db_master_password", "tokenizer_config", "auth_token",
+		"refreshToken", "secret_arn", "secretName", "signing_key", "keyboard",
+		"clientSecret", "client_secret_id", "API_KEY", "lesson", "ssn",
+		"tags", "instance_type", "", "PRIVATE_KEY_PEM", "connection_url",
+	}
+
+	matcher := newAttributeMatcher(patterns, DefaultAttributeExceptions)
+	for _, name := range names {
+		wantPattern, wantFound := AttributeMatchingPatternExcept(name, patterns, DefaultAttributeExceptions)
+		// Run twice so the cached result is checked too
+		for i := 0; i < 2; i++ {
+			pattern, found := matcher.match(name)
+			if pattern != wantPattern || found != wantFound {
+				t.Errorf("%s: expected (%q, %v), got (%q, %v)", name, wantPattern, wantFound, pattern, found)
+			}
+		}
+	}
+}
+
+func TestAutomatonFirstMatch(t *testing.T) {
+	patterns := []string{"secret", "he", "she", "hers", "ret"}
+	a := newAutomaton(patterns, make([][]string, len(patterns)))
+
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"ushers", 1},     // she, he and hers all end here; he has the lowest index
+		{"topsecret", 0},  // ret is found first, but secret has the lower index
+		{"turret", 4},     // only ret
+		{"nothing", -1},   // no match
+		{"", -1},          // empty input
+		{"xxsexxhe", 1},   // match at the very end
+		{"hhhhhhhers", 1}, // repeated failure transitions
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := a.firstMatch(tt.input); got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchersRecompileWhenPatternsChange(t *testing.T) {
+	config := DefaultConfig()
+	if _, found := config.attributeMatchingPattern("internal_ref", config.OmitAttributes); found {
+		t.Fatalf("Expected internal_ref not to match the defaults")
+	}
+
+	config.OmitAttributes = append(config.OmitAttributes, "internal_ref")
+	if _, found := config.attributeMatchingPattern("internal_ref", config.OmitAttributes); !found {
+		t.Errorf("Expected the matcher to pick up the new pattern")
+	}
+
+	config.MergeWithPlatformSettings(PlatformSettings{OmitAttributes: []string{"employee"}})
+	if _, found := config.attributeMatchingPattern("employee_email", config.PlatformOmitAttributes); !found {
+		t.Errorf("Expected the platform matcher to pick up platform patterns")
+	}
+}
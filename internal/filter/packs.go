@@ -0,0 +1,239 @@
+package filter
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RulePack is a curated set of filter rules for one provider, selected with
+// filtering.packs in .cora.yaml. Packs are versioned: a pack's version goes up
+// whenever a release changes what it removes, and a pin such as aws@1 is a
+// config error on a CLI with a different version, so the change is noticed.
+type RulePack struct {
+	Name           string
+	Version        int
+	Description    string
+	ResourceTypes  []string        // Resource types to omit entirely
+	AttributeRules []AttributeRule // Scoped attribute rules
+}
+
+// String returns the pack's name and version, e.g. aws@1
+func (p *RulePack) String() string {
+	return fmt.Sprintf("%s@%d", p.Name, p.Version)
+}
+
+// omitRule is shorthand for an omit rule on a resource type
+func omitRule(resourceType, attribute string) AttributeRule {
+	return AttributeRule{Action: AttributeRuleOmit, ResourceType: resourceType, Attribute: attribute}
+}
+
+// RulePacks are the built-in rule packs, by name
+var RulePacks = map[string]*RulePack{
+	"aws": {
+		Name:        "aws",
+		Version:     1,
+		Description: "IAM keys, Lambda and CodeBuild environments, user data",
+		ResourceTypes: []string{
+			"aws_iam_access_key",
+			"aws_iam_user_login_profile",
+			"aws_iam_service_specific_credential",
+			"aws_kms_ciphertext",
+			"aws_lightsail_key_pair",
+		},
+		AttributeRules: []AttributeRule{
+			omitRule("aws_lambda_function", "environment[*].variables.*"),
+			omitRule("aws_codebuild_project", "environment[*].environment_variable[*].value"),
+			omitRule("aws_launch_template", "user_data"),
+			omitRule("aws_instance", "user_data_base64"),
+		},
+	},
+	"azure": {
+		Name:        "azure",
+		Version:     1,
+		Description: "Entra ID passwords, App Service and container settings",
+		ResourceTypes: []string{
+			"azuread_application_password",
+			"azuread_service_principal_password",
+		},
+		AttributeRules: []AttributeRule{
+			omitRule("re:^azurerm_(linux_|windows_)?(function|web)_app(_slot)?$", "app_settings.*"),
+			omitRule("re:^azurerm_(linux_|windows_)?(function|web)_app(_slot)?$", "connection_string[*].value"),
+			omitRule("azurerm_container_group", "container[*].secure_environment_variables.*"),
+		},
+	},
+	"gcp": {
+		Name:        "gcp",
+		Version:     1,
+		Description: "Service account and API keys, GKE certificates, environments",
+		ResourceTypes: []string{
+			"google_service_account_key",
+			"google_service_account_id_token",
+		},
+		AttributeRules: []AttributeRule{
+			omitRule("google_apikeys_key", "key_string"),
+			omitRule("google_container_cluster", "master_auth[*].client_key"),
+			omitRule("google_container_cluster", "master_auth[*].client_certificate"),
+			omitRule("google_cloud_run_v2_service", "template[*].containers[*].env[*].value"),
+			omitRule("google_cloudfunctions2_function", "service_config[*].environment_variables.*"),
+		},
+	},
+	"kubernetes": {
+		Name:        "kubernetes",
+		Version:     1,
+		Description: "Secrets, Helm release values, container environments",
+		ResourceTypes: []string{
+			"kubernetes_secret",
+			"kubernetes_secret_v1",
+		},
+		AttributeRules: []AttributeRule{
+			omitRule("helm_release", "values"),
+			omitRule("helm_release", "set_sensitive"),
+			omitRule("helm_release", "metadata[*].values"),
+			omitRule("re:^kubernetes_(deployment|stateful_set|daemon_set|job|cron_job)(_v1)?$", "spec.template.spec.container[*].env[*].value"),
+		},
+	},
+	"databricks": {
+		Name:        "databricks",
+		Version:     1,
+		Description: "Tokens, secrets, cluster environments and Spark config",
+		ResourceTypes: []string{
+			"databricks_token",
+			"databricks_obo_token",
+			"databricks_secret",
+			"databricks_service_principal_secret",
+		},
+		AttributeRules: []AttributeRule{
+			omitRule("databricks_cluster", "spark_env_vars.*"),
+			omitRule("databricks_cluster", "spark_conf.*"),
+		},
+	},
+	"datadog": {
+		Name:        "datadog",
+		Version:     1,
+		Description: "API and application keys, synthetics variables",
+		ResourceTypes: []string{
+			"datadog_api_key",
+			"datadog_application_key",
+		},
+		AttributeRules: []AttributeRule{
+			omitRule("datadog_synthetics_global_variable", "value"),
+			omitRule("datadog_synthetics_test", "config_variable[*].example"),
+		},
+	},
+	"github": {
+		Name:        "github",
+		Version:     1,
+		Description: "Actions, Dependabot and Codespaces secrets, webhook URLs",
+		ResourceTypes: []string{
+			"github_actions_secret",
+			"github_actions_environment_secret",
+			"github_actions_organization_secret",
+			"github_dependabot_secret",
+			"github_dependabot_organization_secret",
+			"github_codespaces_secret",
+			"github_codespaces_organization_secret",
+		},
+		AttributeRules: []AttributeRule{
+			omitRule("re:^github_(repository|organization)_webhook$", "configuration[*].url"),
+		},
+	},
+	"snowflake": {
+		Name:        "snowflake",
+		Version:     1,
+		Description: "Users, secret objects, stage encryption keys",
+		ResourceTypes: []string{
+			"snowflake_user",
+			"snowflake_service_user",
+			"snowflake_legacy_service_user",
+			"snowflake_secret_with_basic_authentication",
+			"snowflake_secret_with_generic_string",
+			"snowflake_secret_with_client_credentials",
+			"snowflake_secret_with_authorization_code_grant",
+		},
+		AttributeRules: []AttributeRule{
+			omitRule("snowflake_stage", "encryption"),
+		},
+	},
+	"vault": {
+		Name:        "vault",
+		Version:     1,
+		Description: "Tokens, AppRole secret IDs, LDAP bind passwords",
+		ResourceTypes: []string{
+			"vault_token",
+			"vault_approle_auth_backend_role_secret_id",
+			"vault_approle_auth_backend_login",
+		},
+		AttributeRules: []AttributeRule{
+			omitRule("vault_ldap_auth_backend", "bindpass"),
+			omitRule("vault_ldap_secret_backend", "bindpass"),
+		},
+	},
+}
+
+// RulePackNames returns the names of the built-in rule packs, sorted
+func RulePackNames() []string {
+	names := make([]string, 0, len(RulePacks))
+	for name := range RulePacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupRulePack resolves a packs entry, a pack name optionally pinned to a
+// version (aws or aws@1)
+func lookupRulePack(entry string) (*RulePack, error) {
+	name, pin, pinned := strings.Cut(strings.TrimSpace(entry), "@")
+	pack, ok := RulePacks[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown rule pack '%s' (available: %s)", name, strings.Join(RulePackNames(), ", "))
+	}
+	if pinned {
+		version, err := strconv.Atoi(pin)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule pack version '%s' (expected a number, e.g. %s)", entry, pack)
+		}
+		if version != pack.Version {
+			return nil, fmt.Errorf("rule pack %s is pinned to version %d, but this CLI has %s; review the changes and update the pin", pack.Name, version, pack)
+		}
+	}
+	return pack, nil
+}
+
+// applyRulePacks adds the resource types and attribute rules of the selected
+// packs. Pack rules are added after the rules from .cora.yaml, so a local
+// attribute rule can preserve what a pack would omit.
+func (m *MergedConfig) applyRulePacks(entries []string) error {
+	for _, entry := range entries {
+		pack, err := lookupRulePack(entry)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(m.Packs, pack.String()) {
+			continue
+		}
+		rules, err := compileAttributeRules(pack.AttributeRules)
+		if err != nil {
+			return fmt.Errorf("rule pack %s: %w", pack, err)
+		}
+
+		if m.packTypes == nil {
+			m.packTypes = make(map[string]string)
+		}
+		for _, resourceType := range pack.ResourceTypes {
+			if _, seen := m.packTypes[resourceType]; !seen {
+				m.packTypes[resourceType] = pack.String()
+			}
+			m.OmitResourceTypes = append(m.OmitResourceTypes, resourceType)
+		}
+		for i := range rules {
+			rules[i].pack = pack.String()
+		}
+		m.AttributeRules = append(m.AttributeRules, rules...)
+		m.Packs = append(m.Packs, pack.String())
+	}
+	return nil
+}
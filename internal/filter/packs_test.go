@@ -0,0 +1,116 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRulePacksCompile(t *testing.T) {
+	for _, name := range RulePackNames() {
+		pack := RulePacks[name]
+		if pack.Name != name {
+			t.Errorf("Pack %q is registered as %q", pack.Name, name)
+		}
+		if _, err := compileAttributeRules(pack.AttributeRules); err != nil {
+			t.Errorf("Pack %s has an invalid rule: %v", pack, err)
+		}
+		if err := validatePatterns(pack.ResourceTypes); err != nil {
+			t.Errorf("Pack %s has an invalid resource type: %v", pack, err)
+		}
+	}
+}
+
+func TestLookupRulePack(t *testing.T) {
+	tests := []struct {
+		entry   string
+		wantErr string
+	}{
+		{"aws", ""},
+		{"Kubernetes", ""},
+		{"aws@1", ""},
+		{"aws@2", "pinned to version 2"},
+		{"aws@latest", "invalid rule pack version"},
+		{"heroku", "unknown rule pack 'heroku'"},
+	}
+
+	for _, tt := range tests {
+		_, err := lookupRulePack(tt.entry)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("lookupRulePack(%q) failed: %v", tt.entry, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("lookupRulePack(%q) = %v, expected error containing %q", tt.entry, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFilterWithRulePack(t *testing.T) {
+	state := `{
+  "version": 4,
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "kubernetes_secret",
+      "name": "app",
+      "instances": [{"attributes": {"id": "default/app", "data": {"KEY": "c2VjcmV0"}}}]
+    },
+    {
+      "mode": "managed",
+      "type": "helm_release",
+      "name": "app",
+      "instances": [
+        {
+          "attributes": {
+            "name": "app",
+            "chart": "app",
+            "values": ["db:\n  dsn: postgres://app:hunter22@db/app\n"],
+            "metadata": [{"name": "app", "values": "{\"db\":{\"dsn\":\"postgres://app:hunter22@db/app\"}}"}]
+          }
+        }
+      ]
+    }
+  ]
+}`
+
+	config := DefaultConfig()
+	// A local rule keeps the release metadata values the pack would omit
+	rules, err := compileAttributeRules([]AttributeRule{
+		{Action: AttributeRulePreserve, ResourceType: "helm_release", Attribute: "metadata[*].values"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AttributeRules = rules
+	if err := config.applyRulePacks([]string{"kubernetes", "kubernetes@1"}); err != nil {
+		t.Fatalf("applyRulePacks failed: %v", err)
+	}
+	if len(config.Packs) != 1 || config.Packs[0] != "kubernetes@1" {
+		t.Errorf("Expected packs [kubernetes@1], got %v", config.Packs)
+	}
+
+	result, err := Filter([]byte(state), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+
+	omitted := make(map[string]string)
+	for _, o := range result.Omissions {
+		omitted[o.Path] = o.Reason
+	}
+	if _, ok := omitted["kubernetes_secret.app"]; !ok {
+		t.Errorf("Expected kubernetes_secret.app to be omitted, got %v", omitted)
+	}
+	if reason := omitted["helm_release.app.values"]; !strings.Contains(reason, "from rule pack kubernetes@1") {
+		t.Errorf("Expected helm_release.app.values to be omitted by the pack, got %q", reason)
+	}
+	if _, ok := omitted["helm_release.app.metadata[0].values"]; ok {
+		t.Errorf("Expected the local preserve rule to keep metadata values")
+	}
+
+	if source := config.ruleSource("omit_resource_types", "kubernetes_secret", false); source != "rule pack kubernetes@1" {
+		t.Errorf("Expected kubernetes_secret to come from the pack, got %q", source)
+	}
+}
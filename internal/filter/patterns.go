@@ -1,6 +1,13 @@
 // Package filter provides sensitive data filtering for Terraform state files.
 package filter
 
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
 // DefaultOmitResourceTypes are resource types that should be omitted entirely
 // from state uploads because they inherently contain sensitive data.
 var DefaultOmitResourceTypes = []string{
@@ -78,6 +85,22 @@ var DefaultOmitAttributes = []string{
 	"encrypted_value",
 }
 
+// DefaultAttributeExceptions are attribute names that word-mode patterns never
+// omit, because they identify a secret rather than hold it (e.g. secret_arn).
+var DefaultAttributeExceptions = []string{
+	"*_arn",
+	"*_id",
+	"*_name",
+}
+
+// OpaqueInstanceFields are provider-managed state instance fields whose
+// contents are opaque to Cora (e.g. the base64-encoded "private" blob, which can
+// include timeouts, schema metadata and occasionally credentials). They are
+// omitted when omit_private_data is enabled.
+var OpaqueInstanceFields = []string{
+	"private",
+}
+
 // AttributeContainsPattern checks if an attribute name contains any of the given patterns.
 // The match is case-insensitive and checks for substring matches.
 func AttributeContainsPattern(attrName string, patterns []string) bool {
@@ -88,23 +111,291 @@ func AttributeContainsPattern(attrName string, patterns []string) bool {
 // AttributeMatchingPattern checks if an attribute name contains any of the given patterns
 // and returns the matching pattern if found.
 func AttributeMatchingPattern(attrName string, patterns []string) (string, bool) {
+	return AttributeMatchingPatternExcept(attrName, patterns, nil)
+}
+
+// wordMatchPrefix marks an attribute pattern that matches whole words
+const wordMatchPrefix = "word:"
+
+// AttributeMatchingPatternExcept is like AttributeMatchingPattern, with two
+// matching modes per pattern:
+//   - substring (default): the lowercase name contains the pattern
+//   - word ("word:" prefix): the name, split into words on _, - and camelCase,
+//     contains the pattern's words in sequence, so word:token matches auth_token
+//     and refreshToken but not tokenizer_config
+//
+// Word-mode matches are skipped for names matching one of the exceptions
+// (globs matched against the snake_case form of the name, e.g. *_arn).
+func AttributeMatchingPatternExcept(attrName string, patterns, exceptions []string) (string, bool) {
 	lowerAttr := toLowerCase(attrName)
+	var words []string
 	for _, pattern := range patterns {
-		if containsIgnoreCase(lowerAttr, pattern) {
-			return pattern, true
+		if !strings.HasPrefix(pattern, wordMatchPrefix) {
+			if containsIgnoreCase(lowerAttr, pattern) {
+				return pattern, true
+			}
+			continue
+		}
+
+		if words == nil {
+			words = splitWords(attrName)
+		}
+		if !containsWords(words, splitWords(strings.TrimPrefix(pattern, wordMatchPrefix))) {
+			continue
 		}
+		if isAttributeException(words, exceptions) {
+			continue
+		}
+		return pattern, true
 	}
 	return "", false
 }
 
+// splitWords splits an attribute name into lowercase words on separators and
+// camelCase boundaries (e.g. "dbAdminPassword" and "APIKey_v2" give
+// [db admin password] and [api key v2]).
+func splitWords(name string) []string {
+	words := []string{}
+	var current []byte
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '_' || c == '-' || c == '.' || c == ' ' || c == '/' || c == ':':
+			flush()
+		case c >= 'A' && c <= 'Z':
+			// A new word starts after a lowercase letter or digit, and at the
+			// last capital of an acronym followed by lowercase (API|Key)
+			if i > 0 && len(current) > 0 {
+				prev := name[i-1]
+				prevLower := (prev >= 'a' && prev <= 'z') || (prev >= '0' && prev <= '9')
+				acronymEnd := prev >= 'A' && prev <= 'Z' && i+1 < len(name) && name[i+1] >= 'a' && name[i+1] <= 'z'
+				if prevLower || acronymEnd {
+					flush()
+				}
+			}
+			current = append(current, c+'a'-'A')
+		default:
+			current = append(current, c)
+		}
+	}
+	flush()
+	return words
+}
+
+// containsWords reports whether seq appears as a contiguous run within words
+func containsWords(words, seq []string) bool {
+	if len(seq) == 0 || len(seq) > len(words) {
+		return false
+	}
+	for i := 0; i+len(seq) <= len(words); i++ {
+		match := true
+		for j, w := range seq {
+			if words[i+j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// isAttributeException reports whether a split attribute name matches one of
+// the exception globs
+func isAttributeException(words []string, exceptions []string) bool {
+	if len(exceptions) == 0 {
+		return false
+	}
+	snake := strings.Join(words, "_")
+	for _, exception := range exceptions {
+		if matchPattern(snake, exception) {
+			return true
+		}
+	}
+	return false
+}
+
 // ResourceTypeMatches checks if a resource type matches any of the given types.
+// Entries may be exact types, globs (vault_*) or regular expressions (re:^vault_).
 func ResourceTypeMatches(resourceType string, types []string) bool {
+	_, found := ResourceTypeMatchingPattern(resourceType, types)
+	return found
+}
+
+// ResourceTypeMatchingPattern checks if a resource type matches any of the given
+// types and returns the matching entry if found.
+func ResourceTypeMatchingPattern(resourceType string, types []string) (string, bool) {
 	for _, t := range types {
-		if resourceType == t {
-			return true
+		if matchPattern(resourceType, t) {
+			return t, true
 		}
 	}
-	return false
+	return "", false
+}
+
+// regexPrefix marks a pattern as a regular expression rather than a glob
+const regexPrefix = "re:"
+
+// compiledPatterns caches the regular expressions built from glob and re: patterns
+var compiledPatterns sync.Map // map[string]*regexp.Regexp
+
+// matchPattern reports whether value matches a single pattern. A pattern is
+// one of:
+//   - an exact string
+//   - a glob, where * matches any run of characters and ? a single character
+//   - a Go regular expression prefixed with "re:" (unanchored)
+//
+// Invalid regular expressions never match; they are rejected when the config is loaded.
+func matchPattern(value, pattern string) bool {
+	if !strings.HasPrefix(pattern, regexPrefix) && !strings.ContainsAny(pattern, "*?") {
+		return value == pattern
+	}
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(value)
+}
+
+// compilePattern returns the cached regular expression for a glob or re: pattern
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := compiledPatterns.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	var expr string
+	if strings.HasPrefix(pattern, regexPrefix) {
+		expr = strings.TrimPrefix(pattern, regexPrefix)
+	} else {
+		expr = globToRegexp(pattern)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	}
+	compiledPatterns.Store(pattern, re)
+	return re, nil
+}
+
+// globToRegexp translates a glob into an anchored regular expression
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// validatePatterns checks that every glob and re: pattern compiles
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, regexPrefix) && !strings.ContainsAny(pattern, "*?") {
+			continue
+		}
+		if _, err := compilePattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ModuleMatchingPattern checks if a module address, or any module it is nested
+// in, matches one of the given patterns, and returns the matching pattern if found.
+// Each level is also tried without its instance key, so "module.app" matches
+// module.app[0] and module.app["blue"].module.db.
+func ModuleMatchingPattern(moduleAddress string, patterns []string) (string, bool) {
+	if moduleAddress == "" || len(patterns) == 0 {
+		return "", false
+	}
+	for _, prefix := range moduleAddressPrefixes(moduleAddress) {
+		for _, pattern := range patterns {
+			if matchPattern(prefix, pattern) {
+				return pattern, true
+			}
+		}
+	}
+	return "", false
+}
+
+// moduleAddressPrefixes returns the addresses of a module and its ancestors,
+// outermost first, each with and without the instance key of its last step
+// (e.g. module.a[0].module.b gives module.a[0], module.a, module.a[0].module.b).
+func moduleAddressPrefixes(address string) []string {
+	var prefixes []string
+	addPrefix := func(end int) {
+		prefix := address[:end]
+		prefixes = append(prefixes, prefix)
+		if strings.HasSuffix(prefix, "]") {
+			if open := lastKeyBracket(prefix); open > 0 {
+				prefixes = append(prefixes, prefix[:open])
+			}
+		}
+	}
+
+	depth := 0
+	inString := false
+	for i := 0; i < len(address); i++ {
+		c := address[i]
+		switch {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '.' && depth == 0 && strings.HasPrefix(address[i+1:], "module.") && i > 0:
+			addPrefix(i)
+		}
+	}
+	addPrefix(len(address))
+	return prefixes
+}
+
+// lastKeyBracket returns the index of the "[" that opens the trailing
+// instance key of a module address, or -1
+func lastKeyBracket(step string) int {
+	inString := false
+	open := -1
+	for i := 0; i < len(step); i++ {
+		switch c := step[i]; {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '[':
+			open = i
+		}
+	}
+	return open
 }
 
 // toLowerCase converts a string to lowercase (simple ASCII version).
@@ -0,0 +1,288 @@
+package filter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestResourceTypeMatchingPattern(t *testing.T) {
+	tests := []struct {
+		name         string
+		resourceType string
+		patterns     []string
+		wantPattern  string
+		wantFound    bool
+	}{
+		{
+			name:         "exact match",
+			resourceType: "random_password",
+			patterns:     []string{"random_password"},
+			wantPattern:  "random_password",
+			wantFound:    true,
+		},
+		{
+			name:         "exact does not match prefix",
+			resourceType: "random_password_v2",
+			patterns:     []string{"random_password"},
+		},
+		{
+			name:         "glob prefix",
+			resourceType: "vault_kv_secret_v2",
+			patterns:     []string{"aws_*", "vault_*"},
+			wantPattern:  "vault_*",
+			wantFound:    true,
+		},
+		{
+			name:         "glob infix",
+			resourceType: "aws_secretsmanager_secret_version",
+			patterns:     []string{"*_secret*"},
+			wantPattern:  "*_secret*",
+			wantFound:    true,
+		},
+		{
+			name:         "glob is anchored",
+			resourceType: "my_vault_policy",
+			patterns:     []string{"vault_*"},
+		},
+		{
+			name:         "regex",
+			resourceType: "azurerm_key_vault_secret",
+			patterns:     []string{"re:^azurerm_key_vault_(secret|key)$"},
+			wantPattern:  "re:^azurerm_key_vault_(secret|key)$",
+			wantFound:    true,
+		},
+		{
+			name:         "regex no match",
+			resourceType: "azurerm_key_vault",
+			patterns:     []string{"re:^azurerm_key_vault_(secret|key)$"},
+		},
+		{
+			name:         "invalid regex never matches",
+			resourceType: "anything",
+			patterns:     []string{"re:("},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, found := ResourceTypeMatchingPattern(tt.resourceType, tt.patterns)
+			if found != tt.wantFound || pattern != tt.wantPattern {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tt.wantPattern, tt.wantFound, pattern, found)
+			}
+		})
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	if err := validatePatterns([]string{"exact", "glob_*", "re:^ok$"}); err != nil {
+		t.Errorf("Expected valid patterns, got %v", err)
+	}
+	if err := validatePatterns([]string{"re:(unclosed"}); err == nil {
+		t.Errorf("Expected an error for an invalid regular expression")
+	}
+}
+
+func TestModuleMatchingPattern(t *testing.T) {
+	tests := []struct {
+		address  string
+		patterns []string
+		want     bool
+	}{
+		{"module.secrets", []string{"module.secrets"}, true},
+		{"module.secrets.module.inner", []string{"module.secrets"}, true},
+		{"module.secrets_v2", []string{"module.secrets*"}, true},
+		{"module.app[0]", []string{"module.app"}, true},
+		{`module.app["blue"].module.db`, []string{"module.app"}, true},
+		{`module.app["a.module.b"]`, []string{"module.b"}, false},
+		{"module.app.module.secrets", []string{"module.secrets"}, false},
+		{"module.app.module.secrets", []string{"*.module.secrets"}, true},
+		{"module.app.module.secrets", []string{"re:\\.module\\.secrets$"}, true},
+		{"", []string{"*"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if _, found := ModuleMatchingPattern(tt.address, tt.patterns); found != tt.want {
+				t.Errorf("Expected %v for %s with %v, got %v", tt.want, tt.address, tt.patterns, found)
+			}
+		})
+	}
+}
+
+func TestFilterOmitModules(t *testing.T) {
+	config := DefaultConfig()
+	config.OmitModules = []string{"module.secrets*"}
+
+	state := `{
+  "version": 4,
+  "resources": [
+    {"mode": "managed", "type": "aws_s3_bucket", "name": "logs", "instances": [{"attributes": {"bucket": "logs"}}]},
+    {"module": "module.secrets", "mode": "managed", "type": "aws_s3_bucket", "name": "vault", "instances": [{"attributes": {"bucket": "vault"}}]},
+    {"module": "module.secrets.module.inner", "mode": "managed", "type": "aws_iam_user", "name": "svc", "instances": [{"attributes": {"name": "svc"}}]}
+  ]
+}`
+
+	result, err := Filter([]byte(state), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if result.Summary.OmittedResources != 2 {
+		t.Errorf("Expected 2 omitted resources, got %d", result.Summary.OmittedResources)
+	}
+	if !hasOmission(result, "module.secrets.module.inner.aws_iam_user.svc") {
+		t.Errorf("Expected nested module resource to be omitted, got %v", result.Omissions)
+	}
+	if strings.Contains(string(result.FilteredJSON), "vault") {
+		t.Errorf("Expected module resources to be removed, got %s", result.FilteredJSON)
+	}
+
+	plan := `{
+  "format_version": "1.2",
+  "planned_values": {
+    "root_module": {
+      "resources": [],
+      "child_modules": [
+        {"address": "module.app", "resources": [{"address": "module.app.aws_s3_bucket.a", "mode": "managed", "type": "aws_s3_bucket", "values": {}}]},
+        {"address": "module.secrets", "resources": [{"address": "module.secrets.aws_s3_bucket.vault", "mode": "managed", "type": "aws_s3_bucket", "values": {}}],
+         "child_modules": [{"address": "module.secrets.module.inner", "resources": [{"address": "module.secrets.module.inner.aws_iam_user.svc", "mode": "managed", "type": "aws_iam_user", "values": {}}]}]}
+      ]
+    }
+  },
+  "resource_changes": [
+    {"address": "module.app.aws_s3_bucket.a", "module_address": "module.app", "mode": "managed", "type": "aws_s3_bucket", "change": {"after": {}}},
+    {"address": "module.secrets.aws_s3_bucket.vault", "module_address": "module.secrets", "mode": "managed", "type": "aws_s3_bucket", "change": {"after": {}}}
+  ],
+  "configuration": {
+    "root_module": {
+      "module_calls": {
+        "app": {"source": "./app", "module": {"resources": []}},
+        "secrets": {"source": "./secrets", "expressions": {"region": {"constant_value": "eu-west-1"}},
+                    "module": {"resources": [{"address": "aws_s3_bucket.vault", "mode": "managed", "type": "aws_s3_bucket"}]}}
+      }
+    }
+  }
+}`
+
+	planResult, err := FilterPlan([]byte(plan), config)
+	if err != nil {
+		t.Fatalf("FilterPlan failed: %v", err)
+	}
+	output := string(planResult.FilteredJSON)
+	if strings.Contains(output, "module.secrets") || strings.Contains(output, `"secrets"`) {
+		t.Errorf("Expected the secrets module to be removed from the plan, got %s", output)
+	}
+	if !strings.Contains(output, "module.app.aws_s3_bucket.a") {
+		t.Errorf("Expected other modules to be kept, got %s", output)
+	}
+	for _, path := range []string{
+		"module.secrets.aws_s3_bucket.vault",
+		"module.secrets.module.inner.aws_iam_user.svc",
+		"configuration.module.secrets.aws_s3_bucket.vault",
+	} {
+		if !hasOmission(planResult, path) {
+			t.Errorf("Expected omission for %s, got %v", path, planResult.Omissions)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"auth_token", []string{"auth", "token"}},
+		{"dbAdminPassword", []string{"db", "admin", "password"}},
+		{"APIKey_v2", []string{"api", "key", "v2"}},
+		{"client-secret.value", []string{"client", "secret", "value"}},
+		{"oauth2Token", []string{"oauth2", "token"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitWords(tt.name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAttributeMatchingPatternExcept(t *testing.T) {
+	tests := []struct {
+		name      string
+		patterns  []string
+		wantFound bool
+	}{
+		// Substring mode keeps its existing behavior
+		{"tokenizer_config", []string{"token"}, true},
+		{"secret_arn", []string{"secret"}, true},
+
+		// Word mode matches whole words only
+		{"tokenizer_config", []string{"word:token"}, false},
+		{"auth_token", []string{"word:token"}, true},
+		{"refreshToken", []string{"word:token"}, true},
+		{"db_master_password", []string{"word:master_password"}, true},
+		{"master_db_password", []string{"word:master_password"}, false},
+
+		// Exceptions apply to word mode
+		{"secret_arn", []string{"word:secret"}, false},
+		{"secretName", []string{"word:secret"}, false},
+		{"credential_provider_arn", []string{"word:credential"}, false},
+		{"secret_value", []string{"word:secret"}, true},
+
+		// A substring pattern still matches an excepted name
+		{"secret_arn", []string{"word:secret", "secret"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+strings.Join(tt.patterns, ","), func(t *testing.T) {
+			_, found := AttributeMatchingPatternExcept(tt.name, tt.patterns, DefaultAttributeExceptions)
+			if found != tt.wantFound {
+				t.Errorf("Expected %v, got %v", tt.wantFound, found)
+			}
+		})
+	}
+}
+
+func TestAttributePatternYAML(t *testing.T) {
+	input := `
+filtering:
+  omit_attributes:
+    - internal_api_key
+    - pattern: token
+      match: word
+    - pattern: key
+      match: substring
+      mode: hash
+`
+	var cfg FilterConfig
+	if err := yaml.Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	want := []AttributePattern{{Pattern: "internal_api_key"}, {Pattern: "word:token"}, {Pattern: "substring:key", Mode: RedactionHash}}
+	if !reflect.DeepEqual(cfg.Filtering.OmitAttributes, want) {
+		t.Errorf("Expected %v, got %v", want, cfg.Filtering.OmitAttributes)
+	}
+
+	invalid := `
+filtering:
+  omit_attributes:
+    - pattern: token
+      match: fuzzy
+`
+	if err := yaml.Unmarshal([]byte(invalid), &cfg); err == nil {
+		t.Errorf("Expected an error for an unknown match mode")
+	}
+
+	invalid = `
+filtering:
+  omit_attributes:
+    - pattern: token
+      mode: mask
+`
+	if err := yaml.Unmarshal([]byte(invalid), &cfg); err == nil {
+		t.Errorf("Expected an error for an unknown redaction mode")
+	}
+}
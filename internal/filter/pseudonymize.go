@@ -0,0 +1,586 @@
+package filter
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of values that can be pseudonymized, selected with
+// filtering.pseudonymize.kinds in .cora.yaml
+const (
+	PseudonymAccountIDs      = "account_ids"      // AWS account IDs, including inside ARNs
+	PseudonymARNs            = "arns"             // Resource names and IDs inside ARNs
+	PseudonymSubscriptionIDs = "subscription_ids" // Azure subscription and tenant IDs
+	PseudonymIPAddresses     = "ip_addresses"     // IPv4 and IPv6 addresses and CIDRs
+	PseudonymDomains         = "domains"          // Domain names in host settings and URLs
+)
+
+// pseudonymKinds lists the kinds accepted under filtering.pseudonymize.kinds
+var pseudonymKinds = []string{PseudonymAccountIDs, PseudonymARNs, PseudonymSubscriptionIDs, PseudonymIPAddresses, PseudonymDomains}
+
+// DefaultKeepDomains are domain suffixes of cloud providers and public
+// services. They identify a service rather than an organization, so they are
+// kept; the labels in front of them (bucket, database or account names) are
+// still pseudonymized.
+var DefaultKeepDomains = []string{
+	"amazonaws.com",
+	"amazon.com",
+	"cloudfront.net",
+	"azure.com",
+	"azure.net",
+	"windows.net",
+	"azurewebsites.net",
+	"azurecr.io",
+	"googleapis.com",
+	"cloud.google.com",
+	"gcr.io",
+	"pkg.dev",
+	"github.com",
+	"githubusercontent.com",
+	"terraform.io",
+	"docker.io",
+}
+
+// PseudonymizeConfig is the filtering.pseudonymize section of .cora.yaml
+type PseudonymizeConfig struct {
+	// Enabled turns pseudonymization on
+	Enabled bool `yaml:"enabled"`
+
+	// Kinds selects the kinds of values to replace. Defaults to all of them
+	Kinds []string `yaml:"kinds"`
+
+	// Persistent keeps pseudonyms stable across uploads by deriving them from
+	// the local hash key (hash_key_file or CORA_HASH_KEY). Otherwise a new
+	// random key is used for every run
+	Persistent bool `yaml:"persistent"`
+
+	// KeepDomains are additional domain suffixes that are never pseudonymized
+	// (merged with DefaultKeepDomains)
+	KeepDomains []string `yaml:"keep_domains"`
+}
+
+// Pseudonymizer replaces identifying values with stable pseudonyms: the same
+// value always maps to the same pseudonym under the same key, so a diagram
+// built from pseudonymized data still shows which resources share an account,
+// a subnet or a domain. Pseudonyms keep the shape of the value they replace:
+// account IDs stay twelve digits, subscription IDs stay GUIDs, and IP
+// addresses stay addresses, mapped so that addresses in the same subnet stay
+// in the same subnet.
+type Pseudonymizer struct {
+	Kinds       []string
+	Persistent  bool
+	keepDomains []string
+	key         []byte
+
+	tokens   map[string]string // kind + "\x00" + value -> pseudonym
+	ipBits   map[string]byte   // Prefix-preserving flip bit, by address bit prefix
+	replaced map[string]int    // Distinct values replaced, by kind
+}
+
+// newPseudonymizer builds the pseudonymizer for the pseudonymize section.
+// hashKey is the local hash key, needed only for persistent pseudonyms.
+func newPseudonymizer(section PseudonymizeConfig, hashKey func() ([]byte, error)) (*Pseudonymizer, error) {
+	p := &Pseudonymizer{
+		Kinds:       append([]string{}, pseudonymKinds...),
+		Persistent:  section.Persistent,
+		keepDomains: append(append([]string{}, DefaultKeepDomains...), section.KeepDomains...),
+	}
+	if len(section.Kinds) > 0 {
+		p.Kinds = nil
+		for _, kind := range section.Kinds {
+			if !isPseudonymKind(kind) {
+				return nil, fmt.Errorf("unknown kind '%s' (expected %s)", kind, strings.Join(pseudonymKinds, ", "))
+			}
+			p.Kinds = append(p.Kinds, kind)
+		}
+	}
+	for i, domain := range p.keepDomains {
+		p.keepDomains[i] = strings.Trim(strings.ToLower(domain), ".")
+	}
+
+	if section.Persistent {
+		key, err := hashKey()
+		if err != nil {
+			return nil, err
+		}
+		// A key of its own, so pseudonyms never equal hash-mode digests
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("cora pseudonyms"))
+		p.key = mac.Sum(nil)
+	} else {
+		p.key = make([]byte, 32)
+		if _, err := rand.Read(p.key); err != nil {
+			return nil, fmt.Errorf("failed to generate pseudonym key: %w", err)
+		}
+	}
+	p.reset()
+	return p, nil
+}
+
+// isPseudonymKind reports whether name is a known kind
+func isPseudonymKind(name string) bool {
+	for _, kind := range pseudonymKinds {
+		if kind == name {
+			return true
+		}
+	}
+	return false
+}
+
+// kinds returns the kinds pseudonymized, or nil when p is nil
+func (p *Pseudonymizer) kinds() []string {
+	if p == nil {
+		return nil
+	}
+	return p.Kinds
+}
+
+// reset forgets the values replaced so far, keeping the key
+func (p *Pseudonymizer) reset() {
+	p.tokens = make(map[string]string)
+	p.ipBits = make(map[string]byte)
+	p.replaced = make(map[string]int)
+}
+
+// enabled reports whether a kind is pseudonymized
+func (p *Pseudonymizer) enabled(kind string) bool {
+	for _, k := range p.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// digest returns the keyed digest of a value of a kind
+func (p *Pseudonymizer) digest(kind, value string) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// token returns the pseudonym for a value, made by generate on first use
+func (p *Pseudonymizer) token(kind, value string, generate func() string) string {
+	cacheKey := kind + "\x00" + value
+	if token, ok := p.tokens[cacheKey]; ok {
+		return token
+	}
+	token := generate()
+	p.tokens[cacheKey] = token
+	p.replaced[kind]++
+	return token
+}
+
+// accountID returns the pseudonym for an AWS account ID: twelve digits
+func (p *Pseudonymizer) accountID(id string) string {
+	return p.token(PseudonymAccountIDs, id, func() string {
+		n := binary.BigEndian.Uint64(p.digest(PseudonymAccountIDs, id)) % 1_000_000_000_000
+		return fmt.Sprintf("%012d", n)
+	})
+}
+
+// subscriptionID returns the pseudonym for a GUID
+func (p *Pseudonymizer) subscriptionID(id string) string {
+	id = strings.ToLower(id)
+	return p.token(PseudonymSubscriptionIDs, id, func() string {
+		h := hex.EncodeToString(p.digest(PseudonymSubscriptionIDs, id)[:16])
+		return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+	})
+}
+
+// address returns the pseudonym for an IP address. The mapping is prefix
+// preserving: each bit is flipped depending on the bits before it, so two
+// addresses that share their first n bits map to addresses that do too.
+func (p *Pseudonymizer) address(addr netip.Addr) netip.Addr {
+	if addr.IsUnspecified() || addr.IsLoopback() {
+		return addr
+	}
+	token := p.token(PseudonymIPAddresses, addr.String(), func() string {
+		in := addr.AsSlice()
+		out := make([]byte, len(in))
+		for i := 0; i < len(in)*8; i++ {
+			bit := (in[i/8] >> (7 - i%8)) & 1
+			out[i/8] |= (bit ^ p.flipBit(in, i)) << (7 - i%8)
+		}
+		mapped, _ := netip.AddrFromSlice(out)
+		return mapped.String()
+	})
+	mapped, _ := netip.ParseAddr(token)
+	return mapped
+}
+
+// flipBit returns whether bit i of an address is flipped, a keyed function
+// of the bits before it
+func (p *Pseudonymizer) flipBit(addr []byte, i int) byte {
+	prefix := make([]byte, (i+7)/8)
+	copy(prefix, addr)
+	if i%8 != 0 {
+		prefix[len(prefix)-1] &= 0xff << (8 - i%8)
+	}
+	cacheKey := fmt.Sprintf("%d/%d/%x", len(addr), i, prefix)
+	if bit, ok := p.ipBits[cacheKey]; ok {
+		return bit
+	}
+	bit := p.digest("ip", cacheKey)[0] & 1
+	p.ipBits[cacheKey] = bit
+	return bit
+}
+
+// prefix returns the pseudonym for a CIDR block: the pseudonymized network
+// with the same prefix length. Since the address mapping preserves prefixes,
+// pseudonymized addresses stay inside their pseudonymized blocks.
+func (p *Pseudonymizer) prefix(block netip.Prefix) netip.Prefix {
+	if block.Bits() == 0 || block.Addr().IsLoopback() {
+		return block
+	}
+	return netip.PrefixFrom(p.address(block.Addr()), block.Bits()).Masked()
+}
+
+// domain returns the pseudonym for a domain name. Labels are replaced one by
+// one, so names in the same domain stay in the same domain. The top-level
+// domain and any kept suffix are left as they are.
+func (p *Pseudonymizer) domain(name string) string {
+	trailingDot := strings.HasSuffix(name, ".")
+	lower := strings.ToLower(strings.TrimSuffix(name, "."))
+	result := p.token(PseudonymDomains, lower, func() string {
+		labels := strings.Split(lower, ".")
+		keep := 1
+		for _, suffix := range p.keepDomains {
+			if lower == suffix || strings.HasSuffix(lower, "."+suffix) {
+				if n := strings.Count(suffix, ".") + 1; n > keep {
+					keep = n
+				}
+			}
+		}
+
+		for i := 0; i < len(labels)-keep; i++ {
+			label := labels[i]
+			switch {
+			case label == "*":
+			case accountIDPattern.MatchString(label) && p.enabled(PseudonymAccountIDs):
+				// e.g. 123456789012.dkr.ecr.us-east-1.amazonaws.com
+				labels[i] = p.accountID(label)
+			default:
+				// Labels are cached apart from whole names, which are what is counted
+				labels[i] = p.token("domain_labels", label, func() string {
+					return "anon-" + hex.EncodeToString(p.digest(PseudonymDomains, label)[:5])
+				})
+			}
+		}
+		return strings.Join(labels, ".")
+	})
+
+	if trailingDot {
+		result += "."
+	}
+	return result
+}
+
+// arnResource returns the pseudonym for the resource part of an ARN. The
+// resource type in front of it (role/, instance/, secret:) is kept, as are
+// wildcards and version numbers; every other segment is replaced. S3 ARNs
+// have no resource type, so their first segment, the bucket, is replaced too.
+func (p *Pseudonymizer) arnResource(service, resource string) string {
+	segments := arnSegmentPattern.FindAllStringIndex(resource, -1)
+	var b strings.Builder
+	last := 0
+	for i, seg := range segments {
+		b.WriteString(resource[last:seg[0]])
+		last = seg[1]
+		segment := resource[seg[0]:seg[1]]
+		switch {
+		case i == 0 && len(segments) > 1 && service != "s3":
+		case segment == "*" || segment == "root" || numberPattern.MatchString(segment):
+		default:
+			segment = p.token(PseudonymARNs, segment, func() string {
+				return "anon-" + hex.EncodeToString(p.digest(PseudonymARNs, segment)[:5])
+			})
+		}
+		b.WriteString(segment)
+	}
+	b.WriteString(resource[last:])
+	return b.String()
+}
+
+var (
+	accountIDPattern    = regexp.MustCompile(`^\d{12}$`)
+	guidPattern         = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	domainPattern       = regexp.MustCompile(`^(?:\*\.)?(?:[A-Za-z0-9_](?:[A-Za-z0-9_-]*[A-Za-z0-9])?\.)+[A-Za-z]{2,63}\.?$`)
+	arnPattern          = regexp.MustCompile(`\b(arn:aws[a-z-]*:([a-z0-9-]+):[a-z0-9-]*:)(\d{12}|aws)?(:)([^\s"',;()\[\]{}<>]+)`)
+	arnSegmentPattern   = regexp.MustCompile(`[^/:]+`)
+	numberPattern       = regexp.MustCompile(`^\d{1,11}$`)
+	subscriptionPattern = regexp.MustCompile(`(?i)(/subscriptions/)([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})\b`)
+	ipv4Pattern         = regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)(?:/(?:3[0-2]|[12]?\d))?\b`)
+	urlHostPattern      = regexp.MustCompile(`(?i)\b([a-z][a-z0-9+.-]*://(?:[^/\s@]*@)?)([a-z0-9_-]+(?:\.[a-z0-9_-]+)+)`)
+)
+
+// Attribute names whose whole value is checked for each kind. Values found
+// anywhere else need a telltale context: an ARN, an Azure resource ID, a URL.
+var (
+	accountIDKeys    = []string{"account", "owner"}
+	subscriptionKeys = []string{"subscription", "tenant"}
+	domainKeys       = []string{"domain", "host", "fqdn", "dns", "endpoint", "server_name", "url", "uri", "origin"}
+)
+
+// isVersionKey reports whether an attribute holds a version, such as
+// engine_version or kubernetes_version. Dotted versions look like IPv4
+// addresses, and versions identify nothing, so they are left alone.
+func isVersionKey(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasSuffix(key, "version") || strings.HasSuffix(key, "versions")
+}
+
+// replaceIPv4 replaces the IPv4 addresses in text. A match that is part of a
+// longer dotted number, like the version 1.2.3.4.5, is not an address.
+func replaceIPv4(value string, replace func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range ipv4Pattern.FindAllStringIndex(value, -1) {
+		if m[0] > 0 && value[m[0]-1] == '.' || m[1] < len(value) && value[m[1]] == '.' && m[1]+1 < len(value) && isDigit(value[m[1]+1]) {
+			continue
+		}
+		b.WriteString(value[last:m[0]])
+		b.WriteString(replace(value[m[0]:m[1]]))
+		last = m[1]
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// keyContains reports whether an attribute name contains any of the words
+func keyContains(key string, words []string) bool {
+	key = strings.ToLower(key)
+	for _, word := range words {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// pseudonymize returns a string value with its identifying values replaced.
+// key is the name of the attribute holding it, or of the list holding it.
+func (p *Pseudonymizer) pseudonymize(value, key string) string {
+	if isVersionKey(key) {
+		return value
+	}
+
+	// Whole values, recognized by the attribute that holds them
+	switch {
+	case p.enabled(PseudonymAccountIDs) && accountIDPattern.MatchString(value) && keyContains(key, accountIDKeys):
+		return p.accountID(value)
+	case p.enabled(PseudonymSubscriptionIDs) && guidPattern.MatchString(value) && keyContains(key, subscriptionKeys):
+		return p.subscriptionID(value)
+	}
+	if p.enabled(PseudonymIPAddresses) && strings.Contains(value, ":") {
+		// IPv6 is only recognized as a whole value; in text it is too easily
+		// confused with other colon-separated values
+		if addr, err := netip.ParseAddr(value); err == nil && addr.Is6() {
+			return p.address(addr).String()
+		}
+		if block, err := netip.ParsePrefix(value); err == nil && block.Addr().Is6() {
+			return p.prefix(block).String()
+		}
+	}
+	if p.enabled(PseudonymDomains) && keyContains(key, domainKeys) {
+		if host, rest := splitHost(value); domainPattern.MatchString(host) {
+			value = p.domain(host) + rest
+		}
+	}
+
+	// Values inside text
+	if (p.enabled(PseudonymAccountIDs) || p.enabled(PseudonymARNs)) && strings.Contains(value, "arn:") {
+		value = arnPattern.ReplaceAllStringFunc(value, func(m string) string {
+			parts := arnPattern.FindStringSubmatch(m)
+			account, resource := parts[3], parts[5]
+			if p.enabled(PseudonymAccountIDs) && accountIDPattern.MatchString(account) {
+				account = p.accountID(account)
+			}
+			if p.enabled(PseudonymARNs) {
+				resource = p.arnResource(parts[2], resource)
+			}
+			return parts[1] + account + parts[4] + resource
+		})
+	}
+	if p.enabled(PseudonymSubscriptionIDs) && strings.Contains(strings.ToLower(value), "/subscriptions/") {
+		value = subscriptionPattern.ReplaceAllStringFunc(value, func(m string) string {
+			parts := subscriptionPattern.FindStringSubmatch(m)
+			return parts[1] + p.subscriptionID(parts[2])
+		})
+	}
+	if p.enabled(PseudonymIPAddresses) && strings.Count(value, ".") >= 3 {
+		value = replaceIPv4(value, func(m string) string {
+			if block, err := netip.ParsePrefix(m); err == nil {
+				return p.prefix(block).String()
+			}
+			if addr, err := netip.ParseAddr(m); err == nil {
+				return p.address(addr).String()
+			}
+			return m
+		})
+	}
+	if p.enabled(PseudonymDomains) && strings.Contains(value, "://") {
+		value = urlHostPattern.ReplaceAllStringFunc(value, func(m string) string {
+			parts := urlHostPattern.FindStringSubmatch(m)
+			if !domainPattern.MatchString(parts[2]) {
+				return m
+			}
+			return parts[1] + p.domain(parts[2])
+		})
+	}
+	return value
+}
+
+// splitHost splits a host setting such as db.example.com:5432 or
+// registry.example.com/app into the host and the rest
+func splitHost(value string) (string, string) {
+	if i := strings.IndexAny(value, ":/"); i >= 0 {
+		return value[:i], value[i:]
+	}
+	return value, ""
+}
+
+// Pseudonymize copies filtered output from r to w with identifying values
+// replaced by config.Pseudonymizer, and records how many distinct values of
+// each kind it replaced in result.Pseudonyms.
+//
+// It is a pass over the finished output, after the leak scan: the leak scan
+// looks for copies of removed values as they were, and a copy with an
+// address in it would no longer match once the address is replaced.
+func Pseudonymize(r io.Reader, w io.Writer, result *FilterResult, config *MergedConfig) error {
+	p := config.Pseudonymizer
+	p.reset()
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	s := &pseudonymScanner{dec: dec, w: bufio.NewWriter(w), p: p}
+
+	tok, err := dec.Token()
+	if err == nil {
+		err = s.value(tok, "")
+	}
+	if err == nil {
+		err = s.w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to pseudonymize: %w", err)
+	}
+
+	result.Pseudonyms = make(map[string]int)
+	for _, kind := range p.Kinds {
+		result.Pseudonyms[kind] = p.replaced[kind]
+	}
+	return nil
+}
+
+// pseudonymScanner copies a JSON document token by token, replacing string values
+type pseudonymScanner struct {
+	dec *json.Decoder
+	w   *bufio.Writer
+	p   *Pseudonymizer
+}
+
+// value copies the value starting with tok, held by the attribute key
+func (s *pseudonymScanner) value(tok json.Token, key string) error {
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			return s.object()
+		}
+		return s.array(key)
+	case string:
+		return encodeString(s.w, s.p.pseudonymize(v, key))
+	default:
+		return encodeValue(s.w, v)
+	}
+}
+
+// object copies the members of an object whose opening brace has been read
+func (s *pseudonymScanner) object() error {
+	s.w.WriteByte('{')
+	for i := 0; s.dec.More(); i++ {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("invalid object key %v", tok)
+		}
+		if i > 0 {
+			s.w.WriteByte(',')
+		}
+		if err := encodeString(s.w, key); err != nil {
+			return err
+		}
+		s.w.WriteByte(':')
+
+		tok, err = s.dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := s.value(tok, key); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	s.w.WriteByte('}')
+	return nil
+}
+
+// array copies the elements of an array whose opening bracket has been read.
+// Elements are checked as values of the attribute holding the list.
+func (s *pseudonymScanner) array(key string) error {
+	s.w.WriteByte('[')
+	for i := 0; s.dec.More(); i++ {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			s.w.WriteByte(',')
+		}
+		if err := s.value(tok, key); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	s.w.WriteByte(']')
+	return nil
+}
+
+// pseudonymSummary describes the values replaced, e.g. "3 account_ids, 12 ip_addresses"
+func pseudonymSummary(counts map[string]int) string {
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+	}
+	return strings.Join(parts, ", ")
+}
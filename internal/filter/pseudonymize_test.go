@@ -0,0 +1,147 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func pseudonymizeConfig(t *testing.T, section PseudonymizeConfig) *MergedConfig {
+	t.Helper()
+	section.Enabled = true
+	p, err := newPseudonymizer(section, func() ([]byte, error) { return []byte("test-key"), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.Pseudonymizer = p
+	return config
+}
+
+func TestPseudonymize(t *testing.T) {
+	input := `{
+  "resources": [
+    {
+      "type": "aws_instance",
+      "values": {
+        "arn": "arn:aws:ec2:us-east-1:123456789012:instance/i-0f3c9e2a",
+        "iam_instance_profile": "arn:aws:iam::123456789012:instance-profile/web-prod",
+        "policy": "{\"Resource\":\"arn:aws:s3:::corp-backups/*\"}",
+        "engine_version": "1.2.3.4",
+        "description": "build 10.2.3.4.5 on 10.0.300.1",
+        "owner_id": "123456789012",
+        "private_ip": "10.0.1.5",
+        "cidr_block": "10.0.0.0/16",
+        "ipv6_address": "2001:db8::1",
+        "ami": "ami-0abc123",
+        "port": 443,
+        "private_dns": "web.corp.example.com",
+        "repository_url": "123456789012.dkr.ecr.us-east-1.amazonaws.com/app",
+        "user_data": "curl https://api.corp.example.com/ready from 10.0.1.5",
+        "allowed_account_ids": ["123456789012"],
+        "localhost": "127.0.0.1"
+      }
+    },
+    {
+      "type": "azurerm_resource_group",
+      "values": {
+        "id": "/subscriptions/0B1F6471-1BF0-4DDA-AEC3-CB9272F09590/resourceGroups/app",
+        "tenant_id": "72f988bf-86f1-41af-91ab-2d7cd011db47"
+      }
+    }
+  ]
+}`
+
+	config := pseudonymizeConfig(t, PseudonymizeConfig{})
+	result := &FilterResult{}
+	var out bytes.Buffer
+	if err := Pseudonymize(strings.NewReader(input), &out, result, config); err != nil {
+		t.Fatalf("Pseudonymize failed: %v", err)
+	}
+
+	var doc struct {
+		Resources []struct {
+			Values map[string]interface{} `json:"values"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("Pseudonymized output is not valid JSON: %v", err)
+	}
+
+	output := out.String()
+	for _, real := range []string{"123456789012", "10.0.1.5", "10.0.0.0", "2001:db8::1", "corp.example", "0b1f6471", "0B1F6471", "72f988bf", "i-0f3c9e2a", "web-prod", "corp-backups"} {
+		if strings.Contains(output, real) {
+			t.Errorf("Expected %q to be pseudonymized, got %s", real, output)
+		}
+	}
+	for _, kept := range []string{`"ami-0abc123"`, `"port":443`, `"127.0.0.1"`, ".amazonaws.com/app", "/resourceGroups/app",
+		":instance/anon-", ":instance-profile/anon-", "/*", `"1.2.3.4"`, "build 10.2.3.4.5 on 10.0.300.1"} {
+		if !strings.Contains(output, kept) {
+			t.Errorf("Expected %s to be kept, got %s", kept, output)
+		}
+	}
+
+	// The same value maps to the same pseudonym everywhere
+	values := doc.Resources[0].Values
+	account := values["owner_id"].(string)
+	if len(account) != 12 || !strings.Contains(values["arn"].(string), ":"+account+":") ||
+		!strings.HasPrefix(values["repository_url"].(string), account+".") {
+		t.Errorf("Expected the account ID to map consistently, got %v", values)
+	}
+	ip := values["private_ip"].(string)
+	if !strings.Contains(values["user_data"].(string), ip) {
+		t.Errorf("Expected the IP to map consistently, got %v", values)
+	}
+	if !strings.HasSuffix(values["private_dns"].(string), ".com") || !strings.HasPrefix(values["private_dns"].(string), "anon-") {
+		t.Errorf("Expected a pseudonymized host name, got %v", values["private_dns"])
+	}
+	host := strings.TrimPrefix(values["private_dns"].(string), strings.Split(values["private_dns"].(string), ".")[0])
+	if !strings.Contains(values["user_data"].(string), host) {
+		t.Errorf("Expected the domain to map consistently, got %v", values)
+	}
+
+	// Subnets stay subnets
+	block := netip.MustParsePrefix(values["cidr_block"].(string))
+	if block.Bits() != 16 || !block.Contains(netip.MustParseAddr(ip)) {
+		t.Errorf("Expected %s to stay inside %s", ip, block)
+	}
+
+	if result.Pseudonyms[PseudonymAccountIDs] != 1 || result.Pseudonyms[PseudonymARNs] != 3 || result.Pseudonyms[PseudonymSubscriptionIDs] != 2 {
+		t.Errorf("Unexpected counts: %v", result.Pseudonyms)
+	}
+
+	// The same key gives the same pseudonyms on the next run
+	var again bytes.Buffer
+	if err := Pseudonymize(strings.NewReader(input), &again, &FilterResult{}, pseudonymizeConfig(t, PseudonymizeConfig{Persistent: true})); err != nil {
+		t.Fatal(err)
+	}
+	var persistent bytes.Buffer
+	if err := Pseudonymize(strings.NewReader(input), &persistent, &FilterResult{}, pseudonymizeConfig(t, PseudonymizeConfig{Persistent: true})); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != persistent.String() {
+		t.Error("Expected persistent pseudonyms to be stable across runs")
+	}
+}
+
+func TestPseudonymizeKinds(t *testing.T) {
+	config := pseudonymizeConfig(t, PseudonymizeConfig{Kinds: []string{PseudonymIPAddresses}, KeepDomains: []string{"example.com"}})
+	p := config.Pseudonymizer
+	if got := p.pseudonymize("arn:aws:iam::123456789012:root", "arn"); got != "arn:aws:iam::123456789012:root" {
+		t.Errorf("Expected account IDs to be left alone, got %s", got)
+	}
+	if got := p.pseudonymize("10.1.2.3", "ip"); got == "10.1.2.3" {
+		t.Error("Expected the IP to be pseudonymized")
+	}
+
+	p = pseudonymizeConfig(t, PseudonymizeConfig{KeepDomains: []string{"example.com"}}).Pseudonymizer
+	if got := p.pseudonymize("api.example.com", "hostname"); !strings.HasSuffix(got, ".example.com") || got == "api.example.com" {
+		t.Errorf("Expected the kept suffix to stay and the rest to change, got %s", got)
+	}
+
+	if _, err := newPseudonymizer(PseudonymizeConfig{Enabled: true, Kinds: []string{"emails"}}, nil); err == nil {
+		t.Error("Expected an error for an unknown kind")
+	}
+}
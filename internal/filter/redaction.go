@@ -0,0 +1,237 @@
+package filter
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RedactionMode controls what happens to a value that a filter rule flags as sensitive
+type RedactionMode string
+
+const (
+	// RedactionOmit removes the key entirely (the default)
+	RedactionOmit RedactionMode = "omit"
+	// RedactionRedact replaces the value with RedactedPlaceholder
+	RedactionRedact RedactionMode = "redact"
+	// RedactionHash replaces the value with a keyed HMAC-SHA256 digest, so
+	// changes can be detected across uploads without revealing the value
+	RedactionHash RedactionMode = "hash"
+)
+
+// RedactedPlaceholder replaces values in redact mode
+const RedactedPlaceholder = "(sensitive)"
+
+// hashPrefix marks values replaced in hash mode
+const hashPrefix = "hmac-sha256:"
+
+// Rule categories that can each select a redaction mode in .cora.yaml.
+// Resource-level rules (omitted types, data sources) always omit. Single
+// omit_attributes patterns, attribute rules and detectors can select a mode of
+// their own, which takes precedence over their category's.
+const (
+	RulePatterns           = "patterns"            // attribute name patterns (platform and local) and attribute rules
+	RuleTerraformSensitive = "terraform_sensitive" // Terraform sensitive markers and declarations
+	RuleProviderSchema     = "provider_schema"     // attributes the provider schema declares sensitive
+	RuleDetectors          = "detectors"           // value-based secret detectors
+)
+
+// redactionRules lists the rule categories accepted under filtering.redaction
+var redactionRules = []string{RulePatterns, RuleTerraformSensitive, RuleProviderSchema, RuleDetectors}
+
+// HashKeyEnvVar overrides the hash key file with a key supplied directly,
+// which keeps hashes stable across CI runs that don't share a home directory.
+const HashKeyEnvVar = "CORA_HASH_KEY"
+
+// parseRedactionMode validates the redaction mode set for name
+func parseRedactionMode(name, value string) (RedactionMode, error) {
+	mode := RedactionMode(strings.ToLower(value))
+	switch mode {
+	case RedactionOmit, RedactionRedact, RedactionHash:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid redaction mode '%s' for '%s' (expected omit, redact or hash)", value, name)
+}
+
+// parseRedactionModes resolves the filtering.redaction section into a mode per
+// rule category. The "default" entry applies to every category not listed.
+// provider_schema is left unset unless listed, so that it follows
+// terraform_sensitive (see redactionMode).
+func parseRedactionModes(section map[string]string) (map[string]RedactionMode, error) {
+	modes := make(map[string]RedactionMode)
+
+	if value, ok := section["default"]; ok {
+		mode, err := parseRedactionMode("default", value)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range redactionRules {
+			if rule != RuleProviderSchema {
+				modes[rule] = mode
+			}
+		}
+	}
+
+	for name, value := range section {
+		if name == "default" {
+			continue
+		}
+		if !isRedactionRule(name) {
+			return nil, fmt.Errorf("unknown redaction rule '%s' (expected default, %s)", name, strings.Join(redactionRules, ", "))
+		}
+		mode, err := parseRedactionMode(name, value)
+		if err != nil {
+			return nil, err
+		}
+		modes[name] = mode
+	}
+
+	return modes, nil
+}
+
+// isRedactionRule reports whether name is a known rule category
+func isRedactionRule(name string) bool {
+	for _, rule := range redactionRules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+// usesHashing reports whether any rule category, pattern, attribute rule or
+// detector is configured for hash mode
+func (m *MergedConfig) usesHashing() bool {
+	for _, modes := range []map[string]RedactionMode{m.Redaction, m.PatternModes, m.DetectorModes} {
+		for _, mode := range modes {
+			if mode == RedactionHash {
+				return true
+			}
+		}
+	}
+	for _, rule := range m.AttributeRules {
+		if rule.mode == RedactionHash {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRedaction decides what replaces a sensitive value flagged by the given
+// rule category. It records the action and the removed value on the omission
+// and returns the replacement value, or false if the value should be removed.
+func applyRedaction(rule string, value interface{}, omission *OmittedField, config *MergedConfig) (interface{}, bool) {
+	omission.capture(value, config)
+	switch config.omissionMode(rule, omission) {
+	case RedactionRedact:
+		omission.Action = "redacted"
+		return RedactedPlaceholder, true
+	case RedactionHash:
+		omission.Action = "hashed"
+		return hashValue(config.HashKey, value), true
+	}
+	return nil, false
+}
+
+// redactionMode returns the effective mode for a rule category. Provider
+// schema hits follow terraform_sensitive unless provider_schema is set.
+func (m *MergedConfig) redactionMode(rule string) RedactionMode {
+	mode, ok := m.Redaction[rule]
+	if !ok && rule == RuleProviderSchema {
+		mode = m.Redaction[RuleTerraformSensitive]
+	}
+	return m.usableMode(mode)
+}
+
+// omissionMode returns the effective mode for an omission flagged by a rule
+// category: the mode of the pattern, attribute rule or detector that flagged
+// it if that sets one, otherwise the category's
+func (m *MergedConfig) omissionMode(rule string, omission *OmittedField) RedactionMode {
+	if omission.mode != "" {
+		return m.usableMode(omission.mode)
+	}
+	if mode, ok := m.DetectorModes[omission.Detector]; ok && omission.Detector != "" {
+		return m.usableMode(mode)
+	}
+	return m.redactionMode(rule)
+}
+
+// usableMode returns mode, or omit where it cannot be applied
+func (m *MergedConfig) usableMode(mode RedactionMode) RedactionMode {
+	// Never hash without a key; an unkeyed digest of a short secret is guessable
+	if mode == "" || (mode == RedactionHash && len(m.HashKey) == 0) {
+		return RedactionOmit
+	}
+	return mode
+}
+
+// hashValue returns the keyed HMAC-SHA256 digest of a value. Strings are hashed
+// as-is; other values are hashed by their JSON encoding.
+func hashValue(key []byte, value interface{}) string {
+	var data []byte
+	if s, ok := value.(string); ok {
+		data = []byte(s)
+	} else {
+		data, _ = encodeJSON(value)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// loadHashKey returns the HMAC key used in hash mode. The key comes from
+// CORA_HASH_KEY if set, otherwise from the key file, which is created with a
+// random key on first use. The key never leaves the local machine.
+func loadHashKey(path string) ([]byte, error) {
+	if envKey := os.Getenv(HashKeyEnvVar); envKey != "" {
+		return []byte(envKey), nil
+	}
+
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		path = filepath.Join(home, ".config", "cora", "hash.key")
+	} else if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		path = filepath.Join(home, path[2:])
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return nil, fmt.Errorf("hash key file %s is empty", path)
+		}
+		return []byte(key), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read hash key file: %w", err)
+	}
+
+	// Create a new random key with secure permissions
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate hash key: %w", err)
+	}
+	key := hex.EncodeToString(raw)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create hash key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(key+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write hash key file: %w", err)
+	}
+
+	return []byte(key), nil
+}
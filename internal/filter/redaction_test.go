@@ -0,0 +1,366 @@
+package filter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRedactionModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		section map[string]string
+		want    map[string]RedactionMode
+		wantErr bool
+	}{
+		{
+			name:    "default applies to every rule",
+			section: map[string]string{"default": "redact"},
+			want: map[string]RedactionMode{
+				RulePatterns:           RedactionRedact,
+				RuleTerraformSensitive: RedactionRedact,
+				RuleDetectors:          RedactionRedact,
+			},
+		},
+		{
+			name:    "rule overrides default",
+			section: map[string]string{"default": "omit", "terraform_sensitive": "Hash"},
+			want: map[string]RedactionMode{
+				RulePatterns:           RedactionOmit,
+				RuleTerraformSensitive: RedactionHash,
+				RuleDetectors:          RedactionOmit,
+			},
+		},
+		{
+			name:    "unknown mode",
+			section: map[string]string{"patterns": "mask"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown rule",
+			section: map[string]string{"outputs": "redact"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRedactionModes(tt.section)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got modes %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for rule, mode := range tt.want {
+				if got[rule] != mode {
+					t.Errorf("Expected %s mode %q, got %q", rule, mode, got[rule])
+				}
+			}
+		})
+	}
+}
+
+const redactionStateJSON = `{
+  "version": 4,
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_db_instance",
+      "name": "main",
+      "instances": [
+        {
+          "attributes": {
+            "identifier": "main",
+            "password": "hunter2",
+            "settings": [{"name": "a", "value": "x"}, {"name": "b", "value": "y"}]
+          },
+          "sensitive_attributes": [[{"type": "get_attr", "value": "settings"}, {"type": "index", "value": {"value": 0, "type": "number"}}]]
+        }
+      ]
+    }
+  ],
+  "outputs": {
+    "db_password": {"value": "hunter2", "type": "string", "sensitive": true}
+  }
+}`
+
+func TestFilterRedactMode(t *testing.T) {
+	config := DefaultConfig()
+	config.Redaction = map[string]RedactionMode{
+		RulePatterns:           RedactionRedact,
+		RuleTerraformSensitive: RedactionRedact,
+	}
+
+	result, err := Filter([]byte(redactionStateJSON), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+
+	var state struct {
+		Resources []struct {
+			Instances []struct {
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+		Outputs map[string]map[string]interface{} `json:"outputs"`
+	}
+	if err := json.Unmarshal(result.FilteredJSON, &state); err != nil {
+		t.Fatalf("Failed to parse filtered state: %v", err)
+	}
+
+	attrs := state.Resources[0].Instances[0].Attributes
+	if attrs["password"] != RedactedPlaceholder {
+		t.Errorf("Expected password to be redacted, got %v", attrs["password"])
+	}
+
+	// Replaced elements keep their index so the rest of the list lines up
+	settings, _ := attrs["settings"].([]interface{})
+	if len(settings) != 2 || settings[0] != RedactedPlaceholder {
+		t.Errorf("Expected settings[0] to be redacted in place, got %v", attrs["settings"])
+	}
+
+	if state.Outputs["db_password"]["value"] != RedactedPlaceholder {
+		t.Errorf("Expected output value to be redacted, got %v", state.Outputs["db_password"])
+	}
+
+	for _, o := range result.Omissions {
+		if o.Action != "redacted" {
+			t.Errorf("Expected %s to be recorded as redacted, got action %q", o.Path, o.Action)
+		}
+	}
+}
+
+func TestFilterHashMode(t *testing.T) {
+	filterWithKey := func(key string) string {
+		config := DefaultConfig()
+		config.Redaction = map[string]RedactionMode{RulePatterns: RedactionHash}
+		config.HashKey = []byte(key)
+
+		result, err := Filter([]byte(redactionStateJSON), config)
+		if err != nil {
+			t.Fatalf("Filter failed: %v", err)
+		}
+		var state struct {
+			Resources []struct {
+				Instances []struct {
+					Attributes map[string]interface{} `json:"attributes"`
+				} `json:"instances"`
+			} `json:"resources"`
+		}
+		if err := json.Unmarshal(result.FilteredJSON, &state); err != nil {
+			t.Fatalf("Failed to parse filtered state: %v", err)
+		}
+		hashed, _ := state.Resources[0].Instances[0].Attributes["password"].(string)
+		return hashed
+	}
+
+	first := filterWithKey("key-one")
+	if !strings.HasPrefix(first, hashPrefix) || strings.Contains(first, "hunter2") {
+		t.Fatalf("Expected a keyed hash, got %q", first)
+	}
+	if again := filterWithKey("key-one"); again != first {
+		t.Errorf("Expected the same key to give the same hash, got %q and %q", first, again)
+	}
+	if other := filterWithKey("key-two"); other == first {
+		t.Errorf("Expected a different key to give a different hash")
+	}
+}
+
+func TestHashModeWithoutKeyOmits(t *testing.T) {
+	config := DefaultConfig()
+	config.Redaction = map[string]RedactionMode{RulePatterns: RedactionHash}
+
+	result, err := Filter([]byte(redactionStateJSON), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if strings.Contains(string(result.FilteredJSON), `"password"`) {
+		t.Errorf("Expected password to be omitted when no hash key is available")
+	}
+}
+
+func TestFilterPlanRedactMode(t *testing.T) {
+	plan := `{
+  "format_version": "1.2",
+  "variables": {"db_password": {"value": "hunter2"}},
+  "planned_values": {"root_module": {}},
+  "resource_changes": [],
+  "configuration": {
+    "root_module": {
+      "resources": [
+        {
+          "address": "aws_db_instance.main",
+          "mode": "managed",
+          "type": "aws_db_instance",
+          "name": "main",
+          "expressions": {
+            "password": {"constant_value": "hunter2"},
+            "master_password": {"references": ["var.db_password"]}
+          }
+        }
+      ],
+      "variables": {"db_password": {"sensitive": true}}
+    }
+  }
+}`
+
+	config := DefaultConfig()
+	config.Redaction = map[string]RedactionMode{
+		RulePatterns:           RedactionRedact,
+		RuleTerraformSensitive: RedactionRedact,
+	}
+
+	result, err := FilterPlan([]byte(plan), config)
+	if err != nil {
+		t.Fatalf("FilterPlan failed: %v", err)
+	}
+	output := string(result.FilteredJSON)
+
+	if strings.Contains(output, "hunter2") {
+		t.Errorf("Expected secret to be removed from plan, got %s", output)
+	}
+	if !strings.Contains(output, `"db_password":{"value":"(sensitive)"}`) {
+		t.Errorf("Expected variable value to be redacted, got %s", output)
+	}
+	if !strings.Contains(output, `"password":{"constant_value":"(sensitive)"}`) {
+		t.Errorf("Expected constant_value to be redacted, got %s", output)
+	}
+	if !strings.Contains(output, `"master_password":{"references":["var.db_password"]}`) {
+		t.Errorf("Expected references to be kept, got %s", output)
+	}
+}
+
+func TestLoadHashKey(t *testing.T) {
+	t.Setenv(HashKeyEnvVar, "")
+	path := filepath.Join(t.TempDir(), "cora", "hash.key")
+
+	key, err := loadHashKey(path)
+	if err != nil {
+		t.Fatalf("loadHashKey failed: %v", err)
+	}
+	if len(key) == 0 {
+		t.Fatal("Expected a generated key")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected key file to be created: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected key file permissions 0600, got %o", perm)
+	}
+
+	again, err := loadHashKey(path)
+	if err != nil {
+		t.Fatalf("loadHashKey failed: %v", err)
+	}
+	if string(again) != string(key) {
+		t.Errorf("Expected the existing key to be reused")
+	}
+
+	t.Setenv(HashKeyEnvVar, "from-env")
+	fromEnv, err := loadHashKey(path)
+	if err != nil {
+		t.Fatalf("loadHashKey failed: %v", err)
+	}
+	if string(fromEnv) != "from-env" {
+		t.Errorf("Expected %s to override the key file, got %q", HashKeyEnvVar, fromEnv)
+	}
+}
+
+func TestPerRuleRedactionModes(t *testing.T) {
+	t.Setenv(HashKeyEnvVar, "test-key")
+	dir := t.TempDir()
+	configYAML := `version: 1
+filtering:
+  omit_attributes:
+    - pattern: connection_uri
+      mode: redact
+  attribute_rules:
+    - action: omit
+      resource_type: aws_instance
+      attribute: user_note
+      mode: hash
+  detectors:
+    github_token:
+      mode: redact
+`
+	if err := os.WriteFile(filepath.Join(dir, ".cora.yaml"), []byte(configYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	config, _, err := GetMergedConfig()
+	if err != nil {
+		t.Fatalf("GetMergedConfig failed: %v", err)
+	}
+
+	token := "ghp_" + strings.Repeat("a1B2", 9)
+	state := `{"version": 4, "resources": [{"mode": "managed", "type": "aws_instance", "name": "web", "instances": [{"attributes": {
+  "connection_uri": "postgres://db",
+  "password": "hunter2",
+  "user_note": "call Bob",
+  "description": "` + token + `"
+}}]}]}`
+	result, err := Filter([]byte(state), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	filtered, err := decodeObject(result.FilteredJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance := getArray(getArray(filtered, "resources")[0].(*object), "instances")[0].(*object)
+	attrs := getObject(instance, "attributes")
+
+	if got := getString(attrs, "connection_uri"); got != RedactedPlaceholder {
+		t.Errorf("Expected the pattern's redact mode, got %q", got)
+	}
+	if attrs.has("password") {
+		t.Errorf("Expected other patterns to keep the default omit mode")
+	}
+	if got := getString(attrs, "user_note"); !strings.HasPrefix(got, hashPrefix) {
+		t.Errorf("Expected the attribute rule's hash mode, got %q", got)
+	}
+	if got := getString(attrs, "description"); got != RedactedPlaceholder {
+		t.Errorf("Expected the detector's redact mode, got %q", got)
+	}
+
+	invalid := []AttributeRule{{Action: AttributeRulePreserve, Attribute: "tags", Mode: "redact"}}
+	if _, err := compileAttributeRules(invalid); err == nil {
+		t.Error("Expected an error for a mode on a preserve rule")
+	}
+}
+
+func TestProviderSchemaRedactionMode(t *testing.T) {
+	config := DefaultConfig()
+	config.Redaction = map[string]RedactionMode{RuleTerraformSensitive: RedactionRedact}
+	if got := config.redactionMode(RuleProviderSchema); got != RedactionRedact {
+		t.Errorf("Expected provider_schema to follow terraform_sensitive, got %q", got)
+	}
+
+	modes, err := parseRedactionModes(map[string]string{"default": "redact", "provider_schema": "omit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Redaction = modes
+	if got := config.redactionMode(RuleProviderSchema); got != RedactionOmit {
+		t.Errorf("Expected provider_schema's own mode, got %q", got)
+	}
+	if got := config.redactionMode(RuleTerraformSensitive); got != RedactionRedact {
+		t.Errorf("Expected terraform_sensitive to keep the default, got %q", got)
+	}
+}
@@ -3,9 +3,9 @@ package filter
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
-	"sort"
 	"strings"
 )
 
@@ -13,187 +13,352 @@ import (
 type OutputFormat string
 
 const (
-	OutputFormatText OutputFormat = "text"
-	OutputFormatJSON OutputFormat = "json"
+	OutputFormatText     OutputFormat = "text"
+	OutputFormatJSON     OutputFormat = "json"
+	OutputFormatSARIF    OutputFormat = "sarif"
+	OutputFormatMarkdown OutputFormat = "markdown"
+	OutputFormatJUnit    OutputFormat = "junit"
 )
 
 // DryRunReport is the JSON-serializable report for machine-readable output
 type DryRunReport struct {
-	Omissions []OmittedField `json:"omissions"`
-	Summary   FilterSummary  `json:"summary"`
-	Config    ConfigReport   `json:"config"`
+	Omissions  []OmittedField `json:"omissions"`
+	Leaks      []Leak         `json:"leaks,omitempty"`
+	Kept       []KeptType     `json:"kept,omitempty"`
+	Pseudonyms map[string]int `json:"pseudonyms,omitempty"`
+	Summary    FilterSummary  `json:"summary"`
+	Config     ConfigReport   `json:"config"`
 }
 
 // ConfigReport describes the configuration used for filtering
 type ConfigReport struct {
-	Source             string   `json:"source"`
-	OmitResourceTypes  []string `json:"omit_resource_types"`
-	OmitAttributeCount int      `json:"omit_attribute_pattern_count"`
-	PreserveAttributes []string `json:"preserve_attributes,omitempty"`
+	Source              string                   `json:"source"`
+	Mode                string                   `json:"mode"`
+	OmitResourceTypes   []string                 `json:"omit_resource_types"`
+	OmitModules         []string                 `json:"omit_modules,omitempty"`
+	OmitAttributeCount  int                      `json:"omit_attribute_pattern_count"`
+	PreserveAttributes  []string                 `json:"preserve_attributes,omitempty"`
+	AttributeRuleCount  int                      `json:"attribute_rule_count,omitempty"`
+	Detectors           []string                 `json:"detectors,omitempty"`
+	Redaction           map[string]RedactionMode `json:"redaction,omitempty"`
+	LeakScan            LeakScanMode             `json:"leak_scan"`
+	ProviderSchemaTypes int                      `json:"provider_schema_resource_types,omitempty"`
+	Pseudonymize        []string                 `json:"pseudonymize,omitempty"`
+	Enforced            bool                     `json:"enforced,omitempty"`
+	RejectedOverrides   []RejectedOverride       `json:"rejected_overrides,omitempty"`
 }
 
 // PrintDryRunReport outputs the filtering results without uploading
 func PrintDryRunReport(result *FilterResult, config *MergedConfig, configSource string, format OutputFormat) error {
+	return WriteReport(os.Stdout, result, config, configSource, format)
+}
+
+// WriteReport writes the filtering results to w in the given format
+func WriteReport(w io.Writer, result *FilterResult, config *MergedConfig, configSource string, format OutputFormat) error {
 	switch format {
 	case OutputFormatJSON:
-		return printJSONReport(result, config, configSource)
+		return printJSONReport(w, result, config, configSource)
 	case OutputFormatText:
-		return printTextReport(result, config, configSource)
+		return printTextReport(w, result, config, configSource)
+	case OutputFormatSARIF:
+		return printSARIFReport(w, result, config, configSource)
+	case OutputFormatMarkdown:
+		return printMarkdownReport(w, result, config, configSource)
+	case OutputFormatJUnit:
+		return printJUnitReport(w, result, config, configSource)
 	default:
 		return fmt.Errorf("unknown output format: %s", format)
 	}
 }
 
-func printJSONReport(result *FilterResult, config *MergedConfig, configSource string) error {
+func printJSONReport(w io.Writer, result *FilterResult, config *MergedConfig, configSource string) error {
 	report := DryRunReport{
-		Omissions: result.Omissions,
-		Summary:   result.Summary,
+		Omissions:  result.Omissions,
+		Leaks:      result.Leaks,
+		Kept:       keptByType(result.Kept),
+		Pseudonyms: result.Pseudonyms,
+		Summary:    result.Summary,
 		Config: ConfigReport{
-			Source:             configSource,
-			OmitResourceTypes:  config.OmitResourceTypes,
-			OmitAttributeCount: len(config.OmitAttributes),
-			PreserveAttributes: config.PreserveAttributes,
+			Source:              configSource,
+			Mode:                config.Mode(),
+			OmitResourceTypes:   config.OmitResourceTypes,
+			OmitModules:         config.OmitModules,
+			OmitAttributeCount:  len(config.OmitAttributes),
+			PreserveAttributes:  config.PreserveAttributes,
+			AttributeRuleCount:  len(config.AttributeRules),
+			Detectors:           detectorNames(config.Detectors),
+			Redaction:           config.Redaction,
+			LeakScan:            config.LeakScan,
+			ProviderSchemaTypes: config.ProviderSchema.ResourceTypes(),
+			Pseudonymize:        config.Pseudonymizer.kinds(),
+			Enforced:            config.PlatformEnforced,
+			RejectedOverrides:   config.RejectedOverrides,
 		},
 	}
 
-	encoder := json.NewEncoder(os.Stdout)
+	encoder := json.NewEncoder(w)
 	encoder.SetIndent("", "  ")
 	return encoder.Encode(report)
 }
 
-func printTextReport(result *FilterResult, config *MergedConfig, configSource string) error {
-	fmt.Println()
-	fmt.Println("🔒 Sensitive Data Filter - Dry Run Report")
-	fmt.Println(strings.Repeat("─", 50))
-	fmt.Println()
+func printTextReport(w io.Writer, result *FilterResult, config *MergedConfig, configSource string) error {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "🔒 Sensitive Data Filter - Dry Run Report")
+	fmt.Fprintln(w, strings.Repeat("─", 50))
+	fmt.Fprintln(w)
 
 	// Summary
-	fmt.Println("📊 Summary")
-	fmt.Printf("   Resources: %d total, %d omitted\n",
+	fmt.Fprintln(w, "📊 Summary")
+	fmt.Fprintf(w, "   Resources: %d total, %d omitted\n",
 		result.Summary.TotalResources, result.Summary.OmittedResources)
-	fmt.Printf("   Attributes: %d total, %d omitted\n",
+	fmt.Fprintf(w, "   Attributes: %d total, %d omitted\n",
 		result.Summary.TotalAttributes, result.Summary.OmittedAttributes)
-	fmt.Printf("   Config source: %s\n", configSource)
+	fmt.Fprintf(w, "   Config source: %s\n", configSource)
+	if config.Allowlist != nil {
+		fmt.Fprintf(w, "   Mode: allowlist (%d resource types listed)\n", len(config.Allowlist.ResourceTypes))
+	}
+	if len(config.Packs) > 0 {
+		fmt.Fprintf(w, "   Rule packs: %s\n", strings.Join(config.Packs, ", "))
+	}
+	if config.ProviderSchema != nil {
+		fmt.Fprintf(w, "   Provider schema: %d resource types with sensitive attributes\n", config.ProviderSchema.ResourceTypes())
+	}
+	if result.Pseudonyms != nil {
+		fmt.Fprintf(w, "   Pseudonymized: %s\n", pseudonymSummary(result.Pseudonyms))
+	} else if config.Pseudonymizer != nil {
+		fmt.Fprintf(w, "   Pseudonymization: %s\n", strings.Join(config.Pseudonymizer.Kinds, ", "))
+	}
 
 	// Show if platform settings are active
 	hasPlatformSettings := len(config.PlatformOmitResourceTypes) > 0 || len(config.PlatformOmitAttributes) > 0
-	if hasPlatformSettings {
-		fmt.Printf("   Organization settings: active\n")
+	if config.PlatformEnforced {
+		fmt.Fprintf(w, "   Organization settings: enforced\n")
+	} else if hasPlatformSettings {
+		fmt.Fprintf(w, "   Organization settings: active\n")
+	}
+	fmt.Fprintln(w)
+
+	// Local settings that the organization's settings overruled
+	if len(config.RejectedOverrides) > 0 {
+		fmt.Fprintln(w, "⚠️  Rejected Local Overrides")
+		fmt.Fprintln(w, "   These .cora.yaml settings conflict with your organization's settings and were ignored.")
+		fmt.Fprintln(w)
+		for _, r := range config.RejectedOverrides {
+			fmt.Fprintf(w, "   ⛔ %s: %s\n", r.Setting, r.Value)
+			fmt.Fprintf(w, "      %s\n", r.Reason)
+		}
+		fmt.Fprintln(w)
+	}
+
+	// In allowlist mode, what was kept is the short list
+	if config.Allowlist != nil {
+		printKeptResources(w, keptByType(result.Kept), 20)
 	}
-	fmt.Println()
 
 	if len(result.Omissions) == 0 {
-		fmt.Println("✅ No sensitive data detected")
-		fmt.Println()
+		fmt.Fprintln(w, "✅ No sensitive data detected")
+		fmt.Fprintln(w)
 		return nil
 	}
 
 	// Separate omissions into categories
-	platformResourceOmissions := []OmittedField{}
-	platformAttributeOmissions := []OmittedField{}
-	dataSourceOmissions := []OmittedField{}
-	resourceOmissions := []OmittedField{}
-	attributeOmissions := []OmittedField{}
-
-	for _, o := range result.Omissions {
-		if o.FromPlatform {
-			if o.Type == "resource" {
-				platformResourceOmissions = append(platformResourceOmissions, o)
-			} else {
-				platformAttributeOmissions = append(platformAttributeOmissions, o)
-			}
-		} else if o.Type == "resource" && o.Reason == "data source lookup omitted" {
-			dataSourceOmissions = append(dataSourceOmissions, o)
-		} else {
-			if o.Type == "resource" {
-				resourceOmissions = append(resourceOmissions, o)
-			} else {
-				attributeOmissions = append(attributeOmissions, o)
-			}
-		}
-	}
+	groups := groupOmissions(result.Omissions)
 
 	// Show platform settings first (if any)
-	if len(platformResourceOmissions) > 0 || len(platformAttributeOmissions) > 0 {
-		fmt.Println("🏢 Omitted by Organization Settings")
-		fmt.Println("   These filters are configured in your Cora account settings.")
-		fmt.Println()
-
-		if len(platformResourceOmissions) > 0 {
-			for _, o := range platformResourceOmissions {
-				fmt.Printf("   ⛔ %s\n", o.Path)
-				fmt.Printf("      %s\n", o.Reason)
+	if len(groups.platformResources) > 0 || len(groups.platformAttributes) > 0 {
+		fmt.Fprintln(w, "🏢 Omitted by Organization Settings")
+		fmt.Fprintln(w, "   These filters are configured in your Cora account settings.")
+		fmt.Fprintln(w)
+
+		if len(groups.platformResources) > 0 {
+			for _, o := range groups.platformResources {
+				fmt.Fprintf(w, "   ⛔ %s\n", o.Path)
+				fmt.Fprintf(w, "      %s\n", o.Reason)
 			}
 		}
 
-		if len(platformAttributeOmissions) > 0 {
-			grouped := groupAttributeOmissions(platformAttributeOmissions)
-			printGroupedAttributes(grouped, 10)
+		if len(groups.platformAttributes) > 0 {
+			grouped := groupAttributeOmissions(groups.platformAttributes)
+			printGroupedAttributes(w, grouped, 10)
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
 	// Data source omissions - show as a simple summary
-	if len(dataSourceOmissions) > 0 {
-		fmt.Printf("📂 Omitted %d data source lookups (read-only queries, not infrastructure)\n", len(dataSourceOmissions))
-		fmt.Println()
+	if len(groups.dataSources) > 0 {
+		fmt.Fprintf(w, "📂 Omitted %d data source lookups (read-only queries, not infrastructure)\n", len(groups.dataSources))
+		fmt.Fprintln(w)
+	}
+
+	// Provider private data - show as a simple summary
+	if len(groups.privateData) > 0 {
+		fmt.Fprintf(w, "🧩 Omitted opaque provider private data from %d instances\n", len(groups.privateData))
+		fmt.Fprintln(w)
+	}
+
+	// Everything the allowlist does not list - show as a simple summary
+	if len(groups.notAllowlisted) > 0 {
+		resources := 0
+		for _, o := range groups.notAllowlisted {
+			if o.Type == "resource" {
+				resources++
+			}
+		}
+		fmt.Fprintf(w, "📋 Omitted %d resources and %d attributes not in the allowlist\n", resources, len(groups.notAllowlisted)-resources)
+		fmt.Fprintln(w)
 	}
 
 	// Omitted resources (non-platform, non-data-source)
-	if len(resourceOmissions) > 0 {
-		fmt.Println("🗑️  Omitted Resources")
-		for _, o := range resourceOmissions {
-			fmt.Printf("   ⛔ %s\n", o.Path)
-			fmt.Printf("      %s\n", o.Reason)
+	if len(groups.resources) > 0 {
+		fmt.Fprintln(w, "🗑️  Omitted Resources")
+		for _, o := range groups.resources {
+			fmt.Fprintf(w, "   ⛔ %s\n", o.Path)
+			fmt.Fprintf(w, "      %s\n", o.Reason)
 		}
-		fmt.Println()
+		fmt.Fprintln(w)
 	}
 
 	// Omitted attributes - grouped by base path (without array indices)
-	if len(attributeOmissions) > 0 {
-		fmt.Println("🔐 Omitted Attributes")
-		grouped := groupAttributeOmissions(attributeOmissions)
-		printGroupedAttributes(grouped, 20)
-		fmt.Println()
+	if len(groups.attributes) > 0 {
+		fmt.Fprintln(w, "🔐 Omitted Attributes")
+		grouped := groupAttributeOmissions(groups.attributes)
+		printGroupedAttributes(w, grouped, 20)
+		fmt.Fprintln(w)
 	}
 
-	fmt.Println("ℹ️  Use --no-filter to upload without filtering (if allowed by your organization)")
-	fmt.Println()
+	// Attributes the provider schema declares sensitive
+	if len(groups.providerSchema) > 0 {
+		fmt.Fprintln(w, "📐 Sensitive in Provider Schema")
+		grouped := groupAttributeOmissions(groups.providerSchema)
+		printGroupedAttributes(w, grouped, 20)
+		fmt.Fprintln(w)
+	}
+
+	// Values flagged by detectors, regardless of attribute name
+	if len(groups.detected) > 0 {
+		fmt.Fprintln(w, "🔎 Detected Secret Values")
+		grouped := groupAttributeOmissions(groups.detected)
+		printGroupedAttributes(w, grouped, 20)
+		fmt.Fprintln(w)
+	}
+
+	// Copies of removed values found elsewhere in the output
+	if len(result.Leaks) > 0 {
+		if config.LeakScan == LeakScanRedact {
+			fmt.Fprintln(w, "🩹 Redacted Copies of Removed Values")
+		} else {
+			fmt.Fprintln(w, "🚨 Copies of Removed Values (upload would be aborted)")
+		}
+		for i, l := range result.Leaks {
+			if i >= 20 {
+				fmt.Fprintf(w, "   ... and %d more copies\n", len(result.Leaks)-20)
+				break
+			}
+			fmt.Fprintf(w, "   ⚠️  %s\n", l.Path)
+			fmt.Fprintf(w, "      %s copy of %s\n", l.Encoding, l.Source)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "ℹ️  Use --no-filter to upload without filtering (if allowed by your organization)")
+	fmt.Fprintln(w)
 
 	return nil
 }
 
-// printGroupedAttributes prints grouped attribute omissions with a limit
-func printGroupedAttributes(grouped map[string]groupedOmission, maxShow int) {
-	// Sort by count descending, then by path
-	sortedPaths := make([]string, 0, len(grouped))
-	for path := range grouped {
-		sortedPaths = append(sortedPaths, path)
+// omissionGroups holds omissions split into the categories the reports show
+type omissionGroups struct {
+	platformResources  []OmittedField // Resources omitted by organization settings
+	platformAttributes []OmittedField // Attributes omitted by organization settings
+	dataSources        []OmittedField // Data source lookups
+	privateData        []OmittedField // Opaque provider private data
+	notAllowlisted     []OmittedField // Resources, attributes and values not in the allowlist
+	detected           []OmittedField // Values flagged by detectors
+	providerSchema     []OmittedField // Attributes the provider schema declares sensitive
+	resources          []OmittedField // Other omitted resources
+	attributes         []OmittedField // Other omitted attributes
+}
+
+// groupOmissions splits omissions into report categories
+func groupOmissions(omissions []OmittedField) omissionGroups {
+	var g omissionGroups
+	for _, o := range omissions {
+		if o.FromPlatform {
+			if o.Type == "resource" {
+				g.platformResources = append(g.platformResources, o)
+			} else {
+				g.platformAttributes = append(g.platformAttributes, o)
+			}
+		} else if o.Type == "resource" && o.Reason == ReasonDataSource {
+			g.dataSources = append(g.dataSources, o)
+		} else if o.Reason == ReasonPrivateData {
+			g.privateData = append(g.privateData, o)
+		} else if o.Reason == ReasonNotAllowlisted {
+			g.notAllowlisted = append(g.notAllowlisted, o)
+		} else if o.Detector != "" {
+			g.detected = append(g.detected, o)
+		} else if o.Reason == ReasonProviderSchema {
+			g.providerSchema = append(g.providerSchema, o)
+		} else {
+			if o.Type == "resource" {
+				g.resources = append(g.resources, o)
+			} else {
+				g.attributes = append(g.attributes, o)
+			}
+		}
+	}
+	return g
+}
+
+// detectorNames returns the names of the enabled detectors
+func detectorNames(detectors []Detector) []string {
+	names := make([]string, 0, len(detectors))
+	for _, d := range detectors {
+		names = append(names, d.Name())
+	}
+	return names
+}
+
+// printKeptResources prints the resource types kept in allowlist mode with a limit
+func printKeptResources(w io.Writer, kept []KeptType, maxShow int) {
+	if len(kept) == 0 {
+		fmt.Fprintln(w, "⚠️  No resources matched the allowlist")
+		fmt.Fprintln(w)
+		return
 	}
-	sort.Slice(sortedPaths, func(i, j int) bool {
-		ci, cj := grouped[sortedPaths[i]], grouped[sortedPaths[j]]
-		if ci.count != cj.count {
-			return ci.count > cj.count
+
+	fmt.Fprintln(w, "✅ Kept by Allowlist")
+	for i, k := range kept {
+		if i >= maxShow {
+			fmt.Fprintf(w, "   ... and %d more resource types\n", len(kept)-maxShow)
+			break
 		}
-		return sortedPaths[i] < sortedPaths[j]
-	})
+		fmt.Fprintf(w, "   📦 %s (%d resources)\n", k.Type, k.Resources)
+		fmt.Fprintf(w, "      %s\n", strings.Join(k.Attributes, ", "))
+	}
+	fmt.Fprintln(w)
+}
+
+// printGroupedAttributes prints grouped attribute omissions with a limit
+func printGroupedAttributes(w io.Writer, grouped map[string]groupedOmission, maxShow int) {
+	sortedPaths := sortedGroupPaths(grouped)
 
 	shown := 0
 	for _, path := range sortedPaths {
 		if shown >= maxShow {
 			remaining := len(sortedPaths) - maxShow
-			fmt.Printf("   ... and %d more attribute groups\n", remaining)
+			fmt.Fprintf(w, "   ... and %d more attribute groups\n", remaining)
 			break
 		}
 
 		info := grouped[path]
 		if info.count > 1 {
-			fmt.Printf("   🚫 %s (%d occurrences)\n", path, info.count)
+			fmt.Fprintf(w, "   🚫 %s (%d occurrences)\n", path, info.count)
 		} else {
 			// Show the original path for single occurrences
-			fmt.Printf("   🚫 %s\n", info.originalPath)
+			fmt.Fprintf(w, "   🚫 %s\n", info.originalPath)
 		}
-		fmt.Printf("      %s\n", info.reason)
+		fmt.Fprintf(w, "      %s\n", info.reason)
 		shown++
 	}
 }
@@ -217,13 +382,19 @@ func groupAttributeOmissions(omissions []OmittedField) map[string]groupedOmissio
 		// Normalize path by replacing indices with [*]
 		normalizedPath := indexPattern.ReplaceAllString(o.Path, "[*]")
 
+		// Say when the value was replaced rather than removed
+		reason := o.Reason
+		if o.Action != "" {
+			reason = fmt.Sprintf("%s (%s)", reason, o.Action)
+		}
+
 		if existing, ok := grouped[normalizedPath]; ok {
 			existing.count++
 			grouped[normalizedPath] = existing
 		} else {
 			grouped[normalizedPath] = groupedOmission{
 				count:        1,
-				reason:       o.Reason,
+				reason:       reason,
 				originalPath: o.Path,
 			}
 		}
@@ -257,3 +428,21 @@ func PrintVerboseOmissions(result *FilterResult, logFunc func(string, ...interfa
 		logFunc("   %s %s", emoji, o.Path)
 	}
 }
+
+// PrintVerboseLeaks prints the copies of removed values found by the leak scan
+// to stderr for verbose mode
+func PrintVerboseLeaks(result *FilterResult, logFunc func(string, ...interface{})) {
+	if len(result.Leaks) == 0 {
+		return
+	}
+
+	logFunc("🚨 Found %d copies of removed values in the filtered output", len(result.Leaks))
+	maxShow := 5
+	for i, l := range result.Leaks {
+		if i >= maxShow {
+			logFunc("   ... and %d more copies", len(result.Leaks)-maxShow)
+			break
+		}
+		logFunc("   ⚠️  %s (%s copy of %s)", l.Path, l.Encoding, l.Source)
+	}
+}
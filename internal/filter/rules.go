@@ -0,0 +1,227 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Actions for scoped attribute rules
+const (
+	AttributeRuleOmit     = "omit"
+	AttributeRulePreserve = "preserve"
+)
+
+// AttributeRule omits or preserves an attribute path, optionally only on
+// resources of a given type or address. Rules are more specific than
+// omit_attributes and preserve_attributes, so they are checked first; the
+// first matching rule wins.
+type AttributeRule struct {
+	Action       string `yaml:"action"`        // "omit" or "preserve"
+	ResourceType string `yaml:"resource_type"` // Resource type, glob or re: pattern (optional)
+	Address      string `yaml:"address"`       // Resource address glob or re: pattern (optional)
+	Attribute    string `yaml:"attribute"`     // Attribute path, e.g. environment[*].variables.*
+	Mode         string `yaml:"mode"`          // Redaction mode for omit rules (optional; defaults to the patterns mode)
+
+	steps []string      // Parsed attribute path
+	pack  string        // Rule pack that supplied the rule, e.g. aws@1; empty for .cora.yaml rules
+	mode  RedactionMode // Parsed Mode
+}
+
+// String describes the rule for omission reports
+func (r *AttributeRule) String() string {
+	desc := r.Attribute
+	if r.ResourceType != "" {
+		desc += " on " + r.ResourceType
+	}
+	if r.Address != "" {
+		desc += " at " + r.Address
+	}
+	return desc
+}
+
+// omission builds the omission record for a value dropped by this rule
+func (r *AttributeRule) omission(path string) OmittedField {
+	reason := fmt.Sprintf("matches attribute rule '%s'", r)
+	if r.pack != "" {
+		reason += fmt.Sprintf(" from rule pack %s", r.pack)
+	}
+	return OmittedField{
+		Path:   path,
+		Reason: reason,
+		Type:   "attribute",
+		mode:   r.mode,
+	}
+}
+
+// compileAttributeRules validates rules from .cora.yaml and parses their paths
+func compileAttributeRules(rules []AttributeRule) ([]AttributeRule, error) {
+	compiled := make([]AttributeRule, 0, len(rules))
+	for i, rule := range rules {
+		rule.Action = strings.ToLower(rule.Action)
+		if rule.Action != AttributeRuleOmit && rule.Action != AttributeRulePreserve {
+			return nil, fmt.Errorf("attribute rule %d: invalid action '%s' (expected omit or preserve)", i+1, rule.Action)
+		}
+		if rule.Attribute == "" {
+			return nil, fmt.Errorf("attribute rule %d: attribute is required", i+1)
+		}
+		if err := validatePatterns([]string{rule.ResourceType, rule.Address}); err != nil {
+			return nil, fmt.Errorf("attribute rule %d: %w", i+1, err)
+		}
+		if rule.Mode != "" {
+			if rule.Action != AttributeRuleOmit {
+				return nil, fmt.Errorf("attribute rule %d: mode applies to omit rules only", i+1)
+			}
+			mode, err := parseRedactionMode(rule.Attribute, rule.Mode)
+			if err != nil {
+				return nil, fmt.Errorf("attribute rule %d: %w", i+1, err)
+			}
+			rule.mode = mode
+		}
+		rule.steps = parseAttributePath(rule.Attribute)
+		compiled = append(compiled, rule)
+	}
+	return compiled, nil
+}
+
+// parseAttributePath splits an attribute path such as environment[*].variables.*
+// into steps: "environment", "[*]", "variables", "*".
+func parseAttributePath(path string) []string {
+	var steps []string
+	for _, part := range strings.Split(path, ".") {
+		for {
+			open := strings.Index(part, "[")
+			if open < 0 {
+				break
+			}
+			if open > 0 {
+				steps = append(steps, part[:open])
+			}
+			end := strings.Index(part[open:], "]")
+			if end < 0 {
+				break
+			}
+			steps = append(steps, part[open:open+end+1])
+			part = part[open+end+1:]
+		}
+		if part != "" {
+			steps = append(steps, part)
+		}
+	}
+	return steps
+}
+
+// ruleScope tracks where an attribute sits within a resource, for matching
+// scoped attribute rules. A nil *ruleScope means no rules are configured,
+// so callers can pass it around without building paths.
+type ruleScope struct {
+	resourceType string
+	address      string
+	parent       *ruleScope
+	step         string // Attribute name or "[index]"; empty at the resource root
+}
+
+// newRuleScope creates the root scope for a resource's attributes, or nil if
+// no attribute rules are configured
+func newRuleScope(config *MergedConfig, resourceType, address string) *ruleScope {
+	if len(config.AttributeRules) == 0 {
+		return nil
+	}
+	return &ruleScope{resourceType: resourceType, address: address}
+}
+
+// child returns the scope of a nested attribute or map key
+func (s *ruleScope) child(key string) *ruleScope {
+	if s == nil {
+		return nil
+	}
+	return &ruleScope{resourceType: s.resourceType, address: s.address, parent: s, step: key}
+}
+
+// index returns the scope of a list element
+func (s *ruleScope) index(i int) *ruleScope {
+	return s.child(fmt.Sprintf("[%d]", i))
+}
+
+// steps returns the attribute path from the resource root to this scope
+func (s *ruleScope) steps() []string {
+	var steps []string
+	for node := s; node != nil && node.parent != nil; node = node.parent {
+		steps = append(steps, node.step)
+	}
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return steps
+}
+
+// matchAttributeRule returns the first rule that applies to the attribute at
+// this scope, or nil
+func matchAttributeRule(s *ruleScope, config *MergedConfig) *AttributeRule {
+	if s == nil {
+		return nil
+	}
+	steps := s.steps()
+	for i := range config.AttributeRules {
+		rule := &config.AttributeRules[i]
+		if rule.ResourceType != "" && !matchPattern(s.resourceType, rule.ResourceType) {
+			continue
+		}
+		if rule.Address != "" && !matchResourceAddress(s.address, rule.Address) {
+			continue
+		}
+		if matchRuleSteps(rule.steps, steps) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// matchResourceAddress matches an instance address such as aws_instance.web[0]
+// against a pattern, with or without its instance key
+func matchResourceAddress(address, pattern string) bool {
+	if matchPattern(address, pattern) {
+		return true
+	}
+	if strings.HasSuffix(address, "]") {
+		if open := lastKeyBracket(address); open > 0 {
+			return matchPattern(address[:open], pattern)
+		}
+	}
+	return false
+}
+
+// matchRuleSteps matches a rule path against an attribute path. "*" matches
+// any attribute name or map key, "[*]" any list index, and other steps are
+// matched as globs. List indexes the rule does not mention are skipped, so
+// environment.variables matches environment[0].variables.
+func matchRuleSteps(pattern, steps []string) bool {
+	for {
+		if len(steps) == 0 {
+			return len(pattern) == 0
+		}
+		step := steps[0]
+		isIndex := strings.HasPrefix(step, "[")
+
+		if isIndex && (len(pattern) == 0 || !strings.HasPrefix(pattern[0], "[")) {
+			// Implicit index, e.g. a nested block stored as a one-element list
+			steps = steps[1:]
+			continue
+		}
+		if len(pattern) == 0 {
+			return false
+		}
+
+		switch p := pattern[0]; {
+		case p == "*" && !isIndex, p == "[*]" && isIndex:
+		case isIndex:
+			if p != step {
+				return false
+			}
+		default:
+			if !strings.EqualFold(p, step) && !matchPattern(step, p) {
+				return false
+			}
+		}
+		pattern, steps = pattern[1:], steps[1:]
+	}
+}
@@ -0,0 +1,171 @@
+package filter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAttributePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"token", []string{"token"}},
+		{"environment.variables", []string{"environment", "variables"}},
+		{"environment[*].variables.*", []string{"environment", "[*]", "variables", "*"}},
+		{"ingress[0].cidr_blocks[*]", []string{"ingress", "[0]", "cidr_blocks", "[*]"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := parseAttributePath(tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMatchRuleSteps(t *testing.T) {
+	tests := []struct {
+		pattern string
+		steps   []string
+		want    bool
+	}{
+		{"token", []string{"token"}, true},
+		{"token", []string{"registration_token"}, false},
+		{"*_token", []string{"registration_token"}, true},
+		{"environment[*].variables.*", []string{"environment", "[0]", "variables", "DB_URL"}, true},
+		{"environment[*].variables.*", []string{"environment", "[0]", "variables"}, false},
+		{"environment.variables", []string{"environment", "[0]", "variables"}, true},
+		{"environment[1].variables", []string{"environment", "[0]", "variables"}, false},
+		{"ingress[*]", []string{"ingress", "[2]"}, true},
+		{"tags.*", []string{"tags"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+strings.Join(tt.steps, "."), func(t *testing.T) {
+			if got := matchRuleSteps(parseAttributePath(tt.pattern), tt.steps); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCompileAttributeRulesRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule AttributeRule
+	}{
+		{"unknown action", AttributeRule{Action: "drop", Attribute: "token"}},
+		{"missing attribute", AttributeRule{Action: "omit", ResourceType: "aws_instance"}},
+		{"invalid regex", AttributeRule{Action: "omit", ResourceType: "re:(", Attribute: "token"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileAttributeRules([]AttributeRule{tt.rule}); err == nil {
+				t.Errorf("Expected an error for %+v", tt.rule)
+			}
+		})
+	}
+}
+
+func TestFilterAttributeRules(t *testing.T) {
+	rules, err := compileAttributeRules([]AttributeRule{
+		{Action: "preserve", ResourceType: "github_actions_runner_group", Attribute: "token"},
+		{Action: "omit", ResourceType: "aws_lambda_function", Attribute: "environment[*].variables.*"},
+		{Action: "omit", Address: "aws_instance.bastion", Attribute: "user_data"},
+	})
+	if err != nil {
+		t.Fatalf("compileAttributeRules failed: %v", err)
+	}
+	config := DefaultConfig()
+	config.AttributeRules = rules
+
+	state := `{
+  "version": 4,
+  "resources": [
+    {"mode": "managed", "type": "github_actions_runner_group", "name": "ci", "instances": [{"attributes": {"token": "runner-group-id"}}]},
+    {"mode": "managed", "type": "github_repository", "name": "app", "instances": [{"attributes": {"token": "ghp_secret"}}]},
+    {"mode": "managed", "type": "aws_lambda_function", "name": "api", "instances": [{"attributes": {"environment": [{"variables": {"DB_URL": "postgres://x", "STAGE": "prod"}}]}}]},
+    {"mode": "managed", "type": "aws_ecs_task_definition", "name": "api", "instances": [{"attributes": {"environment": [{"variables": {"STAGE": "prod"}}]}}]},
+    {"mode": "managed", "type": "aws_instance", "name": "bastion", "instances": [{"index_key": 0, "attributes": {"user_data": "#!/bin/sh"}}]},
+    {"mode": "managed", "type": "aws_instance", "name": "web", "instances": [{"attributes": {"user_data": "#!/bin/sh"}}]}
+  ]
+}`
+
+	result, err := Filter([]byte(state), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	output := string(result.FilteredJSON)
+
+	if !strings.Contains(output, "runner-group-id") {
+		t.Errorf("Expected token to be preserved on github_actions_runner_group")
+	}
+	if !hasOmission(result, "github_repository.app.token") {
+		t.Errorf("Expected token to be omitted on other resources")
+	}
+	for _, path := range []string{
+		"aws_lambda_function.api.environment[0].variables.DB_URL",
+		"aws_lambda_function.api.environment[0].variables.STAGE",
+		"aws_instance.bastion[0].user_data",
+	} {
+		if !hasOmission(result, path) {
+			t.Errorf("Expected omission for %s, got %v", path, result.Omissions)
+		}
+	}
+	if hasOmission(result, "aws_ecs_task_definition.api.environment[0].variables.STAGE") || hasOmission(result, "aws_instance.web.user_data") {
+		t.Errorf("Expected rules to apply only to their resources, got %v", result.Omissions)
+	}
+
+	for _, o := range result.Omissions {
+		if o.Path == "aws_instance.bastion[0].user_data" && o.Reason != "matches attribute rule 'user_data at aws_instance.bastion'" {
+			t.Errorf("Expected the reason to name the rule, got %q", o.Reason)
+		}
+	}
+}
+
+func TestFilterPlanConfigurationAttributeRules(t *testing.T) {
+	rules, err := compileAttributeRules([]AttributeRule{
+		{Action: "omit", ResourceType: "aws_lambda_function", Attribute: "environment.variables"},
+	})
+	if err != nil {
+		t.Fatalf("compileAttributeRules failed: %v", err)
+	}
+	config := DefaultConfig()
+	config.AttributeRules = rules
+
+	plan := `{
+  "format_version": "1.2",
+  "resource_changes": [],
+  "configuration": {
+    "root_module": {
+      "resources": [
+        {
+          "address": "aws_lambda_function.api",
+          "mode": "managed",
+          "type": "aws_lambda_function",
+          "name": "api",
+          "expressions": {
+            "function_name": {"constant_value": "api"},
+            "environment": [{"variables": {"constant_value": {"DB_URL": "postgres://x"}}}]
+          }
+        }
+      ]
+    }
+  }
+}`
+
+	result, err := FilterPlan([]byte(plan), config)
+	if err != nil {
+		t.Fatalf("FilterPlan failed: %v", err)
+	}
+	if strings.Contains(string(result.FilteredJSON), "postgres://x") {
+		t.Errorf("Expected environment variables to be omitted from configuration, got %s", result.FilteredJSON)
+	}
+	if !hasOmission(result, "configuration.aws_lambda_function.api.environment[0].variables") {
+		t.Errorf("Expected configuration omission, got %v", result.Omissions)
+	}
+}
@@ -0,0 +1,220 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReasonProviderSchema is the omission reason for attributes a provider
+// declares sensitive in its schema
+const ReasonProviderSchema = "marked as sensitive in the provider schema"
+
+// ProviderSchema holds the attributes that providers declare sensitive, read
+// from `terraform providers schema -json`. Providers know which of their
+// attributes hold secrets, so this is more precise than attribute name
+// patterns and catches secrets with unremarkable names.
+//
+// Resource types are looked up by name alone: provider resource type names
+// are prefixed with the provider name, so they do not collide in practice.
+type ProviderSchema struct {
+	resources   map[string]*schemaNode
+	dataSources map[string]*schemaNode
+}
+
+// schemaNode is a tree of the sensitive attributes of a resource type. Unlike
+// sensitivePaths it describes every instance of the type, so list, set and map
+// elements share a single elem subtree instead of being keyed by index.
+//
+// A nil *schemaNode means nothing below this point is sensitive.
+type schemaNode struct {
+	sensitive  bool                   // The value at this path is sensitive in its entirety
+	attributes map[string]*schemaNode // Attributes and nested blocks of an object
+	elem       *schemaNode            // Elements of a list, set or map
+}
+
+// child returns the subtree for an attribute name or map key
+func (n *schemaNode) child(key string) *schemaNode {
+	if n == nil {
+		return nil
+	}
+	if n.sensitive {
+		return n
+	}
+	if n.elem != nil {
+		return n.elem
+	}
+	return n.attributes[key]
+}
+
+// index returns the subtree for a list or set element
+func (n *schemaNode) index(i int) *schemaNode {
+	if n == nil {
+		return nil
+	}
+	if n.sensitive {
+		return n
+	}
+	return n.elem
+}
+
+// isSensitive reports whether the value at this path is sensitive as a whole
+func (n *schemaNode) isSensitive() bool {
+	return n != nil && n.sensitive
+}
+
+// Layout of `terraform providers schema -json`, reduced to what the filter needs
+
+type schemaDocument struct {
+	FormatVersion   string                          `json:"format_version"`
+	ProviderSchemas map[string]providerSchemaEntity `json:"provider_schemas"`
+}
+
+type providerSchemaEntity struct {
+	ResourceSchemas   map[string]resourceSchema `json:"resource_schemas"`
+	DataSourceSchemas map[string]resourceSchema `json:"data_source_schemas"`
+}
+
+type resourceSchema struct {
+	Block schemaBlock `json:"block"`
+}
+
+type schemaBlock struct {
+	Attributes map[string]schemaAttribute `json:"attributes"`
+	BlockTypes map[string]schemaBlockType `json:"block_types"`
+}
+
+type schemaAttribute struct {
+	Sensitive  bool              `json:"sensitive"`
+	NestedType *schemaNestedType `json:"nested_type"`
+}
+
+type schemaNestedType struct {
+	Attributes  map[string]schemaAttribute `json:"attributes"`
+	NestingMode string                     `json:"nesting_mode"`
+}
+
+type schemaBlockType struct {
+	NestingMode string      `json:"nesting_mode"`
+	Block       schemaBlock `json:"block"`
+}
+
+// LoadProviderSchema reads a provider schema file written by
+// `terraform providers schema -json`
+func LoadProviderSchema(path string) (*ProviderSchema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provider schema: %w", err)
+	}
+	defer f.Close()
+
+	schema, err := ReadProviderSchema(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s", err, path)
+	}
+	return schema, nil
+}
+
+// ReadProviderSchema parses the output of `terraform providers schema -json`
+func ReadProviderSchema(r io.Reader) (*ProviderSchema, error) {
+	var doc schemaDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid provider schema: %w", err)
+	}
+	if doc.FormatVersion == "" || doc.ProviderSchemas == nil {
+		return nil, fmt.Errorf("invalid provider schema: expected 'terraform providers schema -json' output")
+	}
+
+	schema := &ProviderSchema{
+		resources:   make(map[string]*schemaNode),
+		dataSources: make(map[string]*schemaNode),
+	}
+	for _, provider := range doc.ProviderSchemas {
+		for resourceType, rs := range provider.ResourceSchemas {
+			if node := buildSchemaBlock(rs.Block); node != nil {
+				schema.resources[resourceType] = node
+			}
+		}
+		for resourceType, rs := range provider.DataSourceSchemas {
+			if node := buildSchemaBlock(rs.Block); node != nil {
+				schema.dataSources[resourceType] = node
+			}
+		}
+	}
+	return schema, nil
+}
+
+// ResourceTypes returns the number of resource and data source types with
+// sensitive attributes
+func (p *ProviderSchema) ResourceTypes() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.resources) + len(p.dataSources)
+}
+
+// lookup returns the sensitive attribute tree for a resource, or nil if its
+// type declares no sensitive attributes. mode is "managed" or "data".
+func (p *ProviderSchema) lookup(mode, resourceType string) *schemaNode {
+	if p == nil {
+		return nil
+	}
+	if mode == "data" {
+		return p.dataSources[resourceType]
+	}
+	return p.resources[resourceType]
+}
+
+// buildSchemaBlock builds the tree for a block, or returns nil if nothing in
+// it is sensitive
+func buildSchemaBlock(block schemaBlock) *schemaNode {
+	node := buildSchemaAttributes(block.Attributes)
+	for name, blockType := range block.BlockTypes {
+		child := nestSchemaNode(buildSchemaBlock(blockType.Block), blockType.NestingMode)
+		if child == nil {
+			continue
+		}
+		if node == nil {
+			node = &schemaNode{attributes: make(map[string]*schemaNode)}
+		}
+		node.attributes[name] = child
+	}
+	return node
+}
+
+// buildSchemaAttributes builds the tree for a set of attributes, including
+// nested attribute types, or returns nil if none of them is sensitive
+func buildSchemaAttributes(attributes map[string]schemaAttribute) *schemaNode {
+	var node *schemaNode
+	for name, attr := range attributes {
+		var child *schemaNode
+		if attr.Sensitive {
+			child = &schemaNode{sensitive: true}
+		} else if attr.NestedType != nil {
+			child = nestSchemaNode(buildSchemaAttributes(attr.NestedType.Attributes), attr.NestedType.NestingMode)
+		}
+		if child == nil {
+			continue
+		}
+		if node == nil {
+			node = &schemaNode{attributes: make(map[string]*schemaNode)}
+		}
+		node.attributes[name] = child
+	}
+	return node
+}
+
+// nestSchemaNode wraps the tree of a nested block or attribute type according
+// to how it appears in state: single blocks are objects, list and set blocks
+// are arrays, and map blocks are objects keyed by name.
+func nestSchemaNode(node *schemaNode, nestingMode string) *schemaNode {
+	if node == nil {
+		return nil
+	}
+	switch nestingMode {
+	case "list", "set", "map":
+		return &schemaNode{elem: node}
+	}
+	return node
+}
@@ -0,0 +1,163 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+// Attribute names are chosen so that the default patterns do not match them
+const testProviderSchema = `{
+  "format_version": "1.0",
+  "provider_schemas": {
+    "registry.terraform.io/hashicorp/example": {
+      "resource_schemas": {
+        "example_cluster": {
+          "version": 0,
+          "block": {
+            "attributes": {
+              "id": {"type": "string", "computed": true},
+              "init_script": {"type": "string", "computed": true, "sensitive": true},
+              "users": {
+                "nested_type": {
+                  "nesting_mode": "map",
+                  "attributes": {
+                    "role": {"type": "string", "optional": true},
+                    "motd": {"type": "string", "optional": true, "sensitive": true}
+                  }
+                },
+                "optional": true
+              }
+            },
+            "block_types": {
+              "node_pool": {
+                "nesting_mode": "list",
+                "block": {
+                  "attributes": {
+                    "name": {"type": "string", "required": true},
+                    "bootstrap": {"type": "string", "optional": true, "sensitive": true}
+                  }
+                }
+              },
+              "network": {
+                "nesting_mode": "single",
+                "block": {"attributes": {"cidr": {"type": "string", "optional": true}}}
+              }
+            }
+          }
+        },
+        "example_bucket": {
+          "version": 0,
+          "block": {"attributes": {"id": {"type": "string", "computed": true}}}
+        }
+      },
+      "data_source_schemas": {
+        "example_cluster": {
+          "version": 0,
+          "block": {"attributes": {"kubeconfig": {"type": "string", "computed": true, "sensitive": true}}}
+        }
+      }
+    }
+  }
+}`
+
+const testSchemaState = `{
+  "version": 4,
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "example_cluster",
+      "name": "main",
+      "instances": [
+        {
+          "attributes": {
+            "id": "c-1",
+            "init_script": "t0ken-value",
+            "users": {"alice": {"role": "admin", "motd": "s3cret-value"}},
+            "node_pool": [{"name": "default", "bootstrap": "b00tstrap-value"}],
+            "network": {"cidr": "10.0.0.0/16"}
+          }
+        }
+      ]
+    }
+  ]
+}`
+
+func TestReadProviderSchema(t *testing.T) {
+	schema, err := ReadProviderSchema(strings.NewReader(testProviderSchema))
+	if err != nil {
+		t.Fatalf("ReadProviderSchema failed: %v", err)
+	}
+
+	// example_bucket has no sensitive attributes, so it is left out
+	if got := schema.ResourceTypes(); got != 2 {
+		t.Errorf("Expected 2 resource types with sensitive attributes, got %d", got)
+	}
+	if schema.lookup("managed", "example_bucket") != nil {
+		t.Errorf("Expected no tree for example_bucket")
+	}
+
+	cluster := schema.lookup("managed", "example_cluster")
+	if !cluster.child("init_script").isSensitive() {
+		t.Errorf("Expected init_script to be sensitive")
+	}
+	if cluster.child("id").isSensitive() || cluster.child("network") != nil {
+		t.Errorf("Expected id and network not to be sensitive")
+	}
+	if !cluster.child("node_pool").index(3).child("bootstrap").isSensitive() {
+		t.Errorf("Expected node_pool[*].bootstrap to be sensitive")
+	}
+	if !cluster.child("users").child("anyone").child("motd").isSensitive() {
+		t.Errorf("Expected users[*].motd to be sensitive")
+	}
+	if !schema.lookup("data", "example_cluster").child("kubeconfig").isSensitive() {
+		t.Errorf("Expected the data source's kubeconfig to be sensitive")
+	}
+
+	if _, err := ReadProviderSchema(strings.NewReader(`{"version": 4, "resources": []}`)); err == nil {
+		t.Errorf("Expected an error for a document that is not a provider schema")
+	}
+}
+
+func TestFilterWithProviderSchema(t *testing.T) {
+	schema, err := ReadProviderSchema(strings.NewReader(testProviderSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.ProviderSchema = schema
+
+	result, err := Filter([]byte(testSchemaState), config)
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+
+	want := map[string]bool{
+		"example_cluster.main.init_script":            true,
+		"example_cluster.main.users.alice.motd":       true,
+		"example_cluster.main.node_pool[0].bootstrap": true,
+	}
+	for _, o := range result.Omissions {
+		if o.Reason != ReasonProviderSchema {
+			continue
+		}
+		if !want[o.Path] {
+			t.Errorf("Unexpected provider schema omission: %s", o.Path)
+		}
+		delete(want, o.Path)
+	}
+	for path := range want {
+		t.Errorf("Expected %s to be omitted by the provider schema", path)
+	}
+
+	filtered := string(result.FilteredJSON)
+	for _, value := range []string{"t0ken-value", "s3cret-value", "b00tstrap-value"} {
+		if strings.Contains(filtered, value) {
+			t.Errorf("Expected %q to be removed from the output", value)
+		}
+	}
+	for _, value := range []string{"alice", "admin", "default", "10.0.0.0/16"} {
+		if !strings.Contains(filtered, value) {
+			t.Errorf("Expected %q to be kept in the output", value)
+		}
+	}
+}
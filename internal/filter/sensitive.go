@@ -0,0 +1,159 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// sensitivePaths is a tree of the value paths Terraform marked sensitive.
+// Each level is keyed by attribute name, map key or list index (formatted as a
+// decimal string), so a marker on settings[0].value only matches that exact
+// value and not every attribute named "value" on the resource.
+//
+// A nil *sensitivePaths means nothing below this point is sensitive.
+type sensitivePaths struct {
+	whole    bool // The value at this path is sensitive in its entirety
+	children map[string]*sensitivePaths
+}
+
+// child returns the subtree for key. Everything below a wholly sensitive
+// value is sensitive too, so a whole node is its own child.
+func (s *sensitivePaths) child(key string) *sensitivePaths {
+	if s == nil {
+		return nil
+	}
+	if s.whole {
+		return s
+	}
+	return s.children[key]
+}
+
+// index returns the subtree for a list element
+func (s *sensitivePaths) index(i int) *sensitivePaths {
+	return s.child(strconv.Itoa(i))
+}
+
+// isSensitive reports whether the value at this path is sensitive as a whole
+func (s *sensitivePaths) isSensitive() bool {
+	return s != nil && s.whole
+}
+
+// add marks the value at the given path as sensitive
+func (s *sensitivePaths) add(steps []string) {
+	node := s
+	for _, step := range steps {
+		if node.whole {
+			return
+		}
+		if node.children == nil {
+			node.children = make(map[string]*sensitivePaths)
+		}
+		next, ok := node.children[step]
+		if !ok {
+			next = &sensitivePaths{}
+			node.children[step] = next
+		}
+		node = next
+	}
+	node.whole = true
+	node.children = nil
+}
+
+// parseSensitiveAttributes converts Terraform's state sensitive_attributes
+// (a list of paths such as [{"type":"get_attr","value":"settings"},
+// {"type":"index","value":{"value":0,"type":"number"}}]) into a path tree.
+func parseSensitiveAttributes(sensitive []interface{}) *sensitivePaths {
+	if len(sensitive) == 0 {
+		return nil
+	}
+
+	root := &sensitivePaths{}
+	for _, item := range sensitive {
+		pathItems, ok := item.([]interface{})
+		if !ok {
+			continue
+		}
+
+		steps := make([]string, 0, len(pathItems))
+		valid := true
+		for _, pathItem := range pathItems {
+			step, ok := parseSensitiveStep(pathItem)
+			if !ok {
+				valid = false
+				break
+			}
+			steps = append(steps, step)
+		}
+		// Skip paths we can't interpret rather than guessing
+		if valid {
+			root.add(steps)
+		}
+	}
+
+	return root
+}
+
+// parseSensitiveStep converts a single get_attr or index step to a tree key
+func parseSensitiveStep(pathItem interface{}) (string, bool) {
+	step, ok := pathItem.(*object)
+	if !ok {
+		return "", false
+	}
+
+	value, _ := step.get("value")
+	switch getString(step, "type") {
+	case "get_attr":
+		name, ok := value.(string)
+		return name, ok
+	case "index":
+		// Index values are cty-encoded as {"value": 0, "type": "number"}
+		if wrapped, ok := value.(*object); ok {
+			value, _ = wrapped.get("value")
+		}
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case json.Number:
+			return v.String(), true
+		case float64:
+			return fmt.Sprint(v), true
+		}
+	}
+	return "", false
+}
+
+// parseSensitiveFromPlan converts a plan sensitivity marker (sensitive_values,
+// before_sensitive or after_sensitive) into a path tree. The marker mirrors the
+// shape of the value: true marks a value sensitive, objects and arrays nest.
+func parseSensitiveFromPlan(marker interface{}) *sensitivePaths {
+	switch m := marker.(type) {
+	case bool:
+		if m {
+			return &sensitivePaths{whole: true}
+		}
+	case *object:
+		var node *sensitivePaths
+		for _, key := range m.orderedKeys() {
+			if child := parseSensitiveFromPlan(m.values[key]); child != nil {
+				if node == nil {
+					node = &sensitivePaths{children: make(map[string]*sensitivePaths)}
+				}
+				node.children[key] = child
+			}
+		}
+		return node
+	case []interface{}:
+		var node *sensitivePaths
+		for i, item := range m {
+			if child := parseSensitiveFromPlan(item); child != nil {
+				if node == nil {
+					node = &sensitivePaths{children: make(map[string]*sensitivePaths)}
+				}
+				node.children[strconv.Itoa(i)] = child
+			}
+		}
+		return node
+	}
+	return nil
+}
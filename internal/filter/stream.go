@@ -0,0 +1,641 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Document is a Terraform JSON document that is filtered as a stream of
+// tokens rather than decoded into memory as a whole. Only one resource (or one
+// small section, such as outputs or configuration) is held at a time, so peak
+// memory stays close to the size of the largest resource.
+//
+// NewDocument reads the document once up front to validate it and to collect
+// the few things the filter needs before it reaches them: the top-level keys,
+// which decide the layout, the sensitive declarations in a plan's
+// configuration, which comes after the values they apply to, and the address
+// of every child module, which Terraform writes after the module's resources.
+type Document struct {
+	r               io.ReadSeeker
+	keys            map[string]bool
+	declared        sensitiveDeclarations
+	moduleAddresses map[string]string // Module location (e.g. "values.root_module.child_modules[0]") -> address
+}
+
+// NewDocument scans a Terraform JSON document. It returns an error if the
+// input is not a single valid JSON object.
+func NewDocument(r io.ReadSeeker) (*Document, error) {
+	d := &Document{
+		r:               r,
+		keys:            make(map[string]bool),
+		declared:        parseSensitiveDeclarations(nil),
+		moduleAddresses: make(map[string]string),
+	}
+
+	dec, err := d.decoder()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.scan(dec); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Format reports which Terraform JSON layout the document uses
+func (d *Document) Format() DocumentFormat {
+	return detectFormat(d.Has)
+}
+
+// Has reports whether the document has the given top-level key
+func (d *Document) Has(key string) bool {
+	return d.keys[key]
+}
+
+// decoder rewinds the document and returns a decoder positioned at its start
+func (d *Document) decoder() (*json.Decoder, error) {
+	if _, err := d.r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind document: %w", err)
+	}
+	dec := json.NewDecoder(d.r)
+	dec.UseNumber()
+	return dec, nil
+}
+
+// scan reads the whole document, recording what the filter needs ahead of time
+func (d *Document) scan(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return fmt.Errorf("empty document")
+	}
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("expected a JSON object at the top level")
+	}
+
+	err = scanMembers(dec, func(key string) error {
+		d.keys[key] = true
+		switch key {
+		case "configuration":
+			value, err := decodeValue(dec)
+			if err != nil {
+				return err
+			}
+			configuration, _ := value.(*object)
+			d.declared = parseSensitiveDeclarations(getObject(configuration, "root_module"))
+			return nil
+		case "values", "planned_values":
+			return d.scanValues(dec, key)
+		case "prior_state":
+			return scanObject(dec, func(key string) error {
+				if key == "values" {
+					return d.scanValues(dec, "prior_state.values")
+				}
+				return skipValue(dec)
+			})
+		default:
+			return skipValue(dec)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after top-level value")
+	}
+	return nil
+}
+
+// scanValues scans a show-json values object for module addresses
+func (d *Document) scanValues(dec *json.Decoder, path string) error {
+	return scanObject(dec, func(key string) error {
+		if key == "root_module" {
+			return d.scanModule(dec, path+".root_module")
+		}
+		return skipValue(dec)
+	})
+}
+
+// scanModule records the address of a show-json module and its children
+func (d *Document) scanModule(dec *json.Decoder, path string) error {
+	return scanObject(dec, func(key string) error {
+		switch key {
+		case "address":
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if address, ok := tok.(string); ok {
+				d.moduleAddresses[path] = address
+				return nil
+			}
+			_, err = decodeFrom(dec, tok)
+			return err
+		case "child_modules":
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if tok != json.Delim('[') {
+				_, err = decodeFrom(dec, tok)
+				return err
+			}
+			for i := 0; dec.More(); i++ {
+				if err := d.scanModule(dec, childModulePath(path, i)); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		default:
+			return skipValue(dec)
+		}
+	})
+}
+
+// scanObject calls handle for each member of the next value if it is an
+// object, and skips the value otherwise. handle must consume the member's value.
+func scanObject(dec *json.Decoder, handle func(key string) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		_, err = decodeFrom(dec, tok)
+		return err
+	}
+	return scanMembers(dec, handle)
+}
+
+// scanMembers calls handle for each member of an object whose opening brace
+// has been read, then reads the closing brace
+func scanMembers(dec *json.Decoder, handle func(key string) error) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("invalid object key %v", tok)
+		}
+		if err := handle(key); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// childModulePath is the location of the i-th child of the module at path
+func childModulePath(path string, i int) string {
+	return fmt.Sprintf("%s.child_modules[%d]", path, i)
+}
+
+// streamer filters a document while copying it from a decoder to a writer
+type streamer struct {
+	doc    *Document
+	dec    *json.Decoder
+	w      *bufio.Writer
+	config *MergedConfig
+	result *FilterResult
+
+	workers int
+	jobs    chan *filterJob // Resources waiting for a worker, started on first use
+}
+
+// newStreamer rewinds doc and prepares to filter it into w
+func newStreamer(doc *Document, w io.Writer, config *MergedConfig) (*streamer, error) {
+	dec, err := doc.decoder()
+	if err != nil {
+		return nil, err
+	}
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &streamer{
+		doc:     doc,
+		dec:     dec,
+		w:       bufio.NewWriter(w),
+		config:  config,
+		result:  &FilterResult{Omissions: []OmittedField{}},
+		workers: workers,
+	}, nil
+}
+
+// FilterStream filters a Terraform state document into w. It behaves like
+// Filter, but only holds one resource in memory at a time. The returned
+// result has no FilteredJSON; the filtered state is written to w instead.
+func FilterStream(doc *Document, w io.Writer, config *MergedConfig) (*FilterResult, error) {
+	s, err := newStreamer(doc, w, config)
+	if err != nil {
+		return nil, err
+	}
+	defer s.stop()
+
+	if doc.Format() == FormatShowState {
+		err = s.object(func(key string) error {
+			if key == "values" {
+				return s.values("values", "values", nil, true)
+			}
+			return s.copy()
+		})
+	} else {
+		err = s.object(func(key string) error {
+			switch key {
+			case "resources":
+				return s.rawResources()
+			case "outputs":
+				return s.transform(func(v interface{}) {
+					if outputs, ok := v.(*object); ok {
+						filterOutputs(outputs, "outputs", config, s.result, nil)
+					}
+				})
+			default:
+				return s.copy()
+			}
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter state: %w", err)
+	}
+	return s.finish()
+}
+
+// FilterPlanStream filters a Terraform plan document into w. It behaves like
+// FilterPlan, but only holds one resource change in memory at a time. The
+// returned result has no FilteredJSON; the filtered plan is written to w instead.
+func FilterPlanStream(doc *Document, w io.Writer, config *MergedConfig) (*FilterResult, error) {
+	s, err := newStreamer(doc, w, config)
+	if err != nil {
+		return nil, err
+	}
+	defer s.stop()
+
+	// Variables and outputs declared `sensitive = true` in the root module
+	declared := doc.declared
+
+	err = s.object(func(key string) error {
+		switch key {
+		case "resource_changes":
+			return s.resourceChanges(true)
+		case "resource_drift":
+			// resource_drift has the same shape as resource_changes and carries real values
+			return s.resourceChanges(false)
+		case "deferred_changes":
+			// deferred_changes wrap a resource_change per entry
+			return s.resources(func(item interface{}, result *FilterResult) bool {
+				entry, ok := item.(*object)
+				if !ok {
+					return true
+				}
+				rc := getObject(entry, "resource_change")
+				return rc == nil || filterResourceChange(rc, config, result)
+			})
+		case "output_changes":
+			return s.transform(func(v interface{}) {
+				if outputChanges, ok := v.(*object); ok {
+					filterOutputChanges(outputChanges, config, s.result, declared.outputs)
+				}
+			})
+		case "planned_values":
+			return s.values("planned_values", "planned_values", declared.outputs, false)
+		case "prior_state":
+			// prior_state uses the show-json state layout
+			return s.object(func(key string) error {
+				if key == "values" {
+					return s.values("prior_state.values", "values", declared.outputs, false)
+				}
+				return s.copy()
+			})
+		case "variables":
+			return s.transform(func(v interface{}) {
+				if variables, ok := v.(*object); ok {
+					filterVariables(variables, config, s.result, declared.variables)
+				}
+			})
+		case "configuration":
+			// Filter constant expressions in the configuration section
+			return s.transform(func(v interface{}) {
+				if configuration, ok := v.(*object); ok {
+					filterConfiguration(configuration, config, s.result)
+				}
+			})
+		default:
+			return s.copy()
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter plan: %w", err)
+	}
+	return s.finish()
+}
+
+// finish flushes the output and returns the result
+func (s *streamer) finish() (*FilterResult, error) {
+	if err := s.w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write filtered output: %w", err)
+	}
+	s.result.countOmittedResources()
+	return s.result, nil
+}
+
+// rawResources streams the resources array of a raw state
+func (s *streamer) rawResources() error {
+	return s.resources(func(item interface{}, result *FilterResult) bool {
+		result.Summary.TotalResources++
+		resource, ok := item.(*object)
+		return !ok || filterRawResource(resource, s.config, result)
+	})
+}
+
+// resourceChanges streams a resource_changes or resource_drift array
+func (s *streamer) resourceChanges(count bool) error {
+	return s.resources(func(item interface{}, result *FilterResult) bool {
+		if count {
+			result.Summary.TotalResources++
+		}
+		rc, ok := item.(*object)
+		return !ok || filterResourceChange(rc, s.config, result)
+	})
+}
+
+// values streams a show-json values object (state values, planned_values or
+// prior_state.values). location identifies it for module address lookups and
+// basePath prefixes output omission paths. count adds its resources and
+// attributes to the summary totals.
+func (s *streamer) values(location, basePath string, sensitiveOutputs map[string]bool, count bool) error {
+	return s.object(func(key string) error {
+		switch key {
+		case "root_module":
+			return s.module(location+".root_module", count)
+		case "outputs":
+			return s.transform(func(v interface{}) {
+				if outputs, ok := v.(*object); ok {
+					filterOutputs(outputs, basePath+".outputs", s.config, s.result, sensitiveOutputs)
+				}
+			})
+		default:
+			return s.copy()
+		}
+	})
+}
+
+// module streams a show-json module and its children. Child modules matching
+// omit_modules are dropped as a whole.
+func (s *streamer) module(location string, count bool) error {
+	return s.object(func(key string) error {
+		switch key {
+		case "resources":
+			return s.resources(func(item interface{}, result *FilterResult) bool {
+				resource, ok := item.(*object)
+				if count {
+					result.Summary.TotalResources++
+					result.Summary.TotalAttributes += countAttributes(getObject(resource, "values"))
+				}
+				return !ok || filterPlannedResource(resource, s.config, result)
+			})
+		case "child_modules":
+			return s.arrayStream(func(i int, sep func()) error {
+				childLocation := childModulePath(location, i)
+				moduleAddress := s.doc.moduleAddresses[childLocation]
+				if pattern, found := ModuleMatchingPattern(moduleAddress, s.config.OmitModules); found {
+					value, err := decodeValue(s.dec)
+					if err != nil {
+						return err
+					}
+					childModule, _ := value.(*object)
+					if count {
+						s.result.Summary.TotalResources += countModuleResources(childModule)
+						s.result.Summary.TotalAttributes += countModuleAttributes(childModule)
+					}
+					omitPlannedModule(childModule, moduleAddress, pattern, s.config, s.result)
+					return nil
+				}
+				sep()
+				return s.module(childLocation, count)
+			}, nil)
+		default:
+			return s.copy()
+		}
+	})
+}
+
+// object streams the next value, calling handle for each member if it is an
+// object and copying it unchanged otherwise. handle must consume and write the
+// member's value; the key has already been written.
+func (s *streamer) object(handle func(key string) error) error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return s.copyFrom(tok)
+	}
+
+	s.w.WriteByte('{')
+	for i := 0; s.dec.More(); i++ {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("invalid object key %v", tok)
+		}
+		if i > 0 {
+			s.w.WriteByte(',')
+		}
+		if err := encodeString(s.w, key); err != nil {
+			return err
+		}
+		s.w.WriteByte(':')
+		if err := handle(key); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	s.w.WriteByte('}')
+	return nil
+}
+
+// resources streams the next value, decoding one element at a time if it is
+// an array of resources and copying it unchanged otherwise. keep filters each
+// element in place, recording omissions in result, and returns false to drop
+// it. Elements are filtered on a pool of workers, and written and merged into
+// the overall result in their original order, so the output is the same as
+// filtering them one by one.
+func (s *streamer) resources(keep func(item interface{}, result *FilterResult) bool) error {
+	if s.workers == 1 {
+		return s.arrayStream(func(i int, sep func()) error {
+			item, err := decodeValue(s.dec)
+			if err != nil {
+				return err
+			}
+			if !keep(item, s.result) {
+				return nil
+			}
+			sep()
+			return encodeValue(s.w, item)
+		}, nil)
+	}
+
+	// Elements are decoded in order and queued for the workers; the oldest is
+	// written once the window is full, which bounds how many are held at once.
+	window := 4 * s.workers
+	var pending []*filterJob
+	writeOldest := func(sep func()) error {
+		job := pending[0]
+		pending = pending[1:]
+		<-job.done
+		if job.err != nil {
+			return job.err
+		}
+		s.result.merge(&job.result)
+		if job.kept {
+			sep()
+			s.w.Write(job.encoded.Bytes())
+		}
+		return nil
+	}
+
+	return s.arrayStream(func(i int, sep func()) error {
+		item, err := decodeValue(s.dec)
+		if err != nil {
+			return err
+		}
+		job := &filterJob{item: item, keep: keep, done: make(chan struct{})}
+		pending = append(pending, job)
+		s.dispatch(job)
+
+		if len(pending) >= window {
+			return writeOldest(sep)
+		}
+		return nil
+	}, func(sep func()) error {
+		for len(pending) > 0 {
+			if err := writeOldest(sep); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// filterJob is one resource filtered by a worker
+type filterJob struct {
+	item interface{}
+	keep func(item interface{}, result *FilterResult) bool
+
+	result  FilterResult // Omissions and counts for this resource only
+	kept    bool
+	encoded bytes.Buffer
+	err     error
+	done    chan struct{}
+}
+
+// run filters and encodes the job's resource
+func (j *filterJob) run() {
+	defer close(j.done)
+	j.kept = j.keep(j.item, &j.result)
+	if j.kept {
+		j.err = encodeValue(&j.encoded, j.item)
+	}
+	j.item = nil
+}
+
+// dispatch hands a job to the worker pool, starting the pool on first use
+func (s *streamer) dispatch(job *filterJob) {
+	if s.jobs == nil {
+		s.jobs = make(chan *filterJob, 4*s.workers)
+		for i := 0; i < s.workers; i++ {
+			go func() {
+				for job := range s.jobs {
+					job.run()
+				}
+			}()
+		}
+	}
+	s.jobs <- job
+}
+
+// stop shuts down the worker pool, if it was started
+func (s *streamer) stop() {
+	if s.jobs != nil {
+		close(s.jobs)
+		s.jobs = nil
+	}
+}
+
+// arrayStream streams the next value, calling handle for each element if it
+// is an array and copying it unchanged otherwise. handle must consume the
+// element, and call sep before writing anything so dropped elements leave no
+// trailing commas. flush, if not nil, is called after the last element to
+// write anything handle held back.
+func (s *streamer) arrayStream(handle func(i int, sep func()) error, flush func(sep func()) error) error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		return s.copyFrom(tok)
+	}
+
+	s.w.WriteByte('[')
+	written := 0
+	sep := func() {
+		if written > 0 {
+			s.w.WriteByte(',')
+		}
+		written++
+	}
+	for i := 0; s.dec.More(); i++ {
+		if err := handle(i, sep); err != nil {
+			return err
+		}
+	}
+	if flush != nil {
+		if err := flush(sep); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	s.w.WriteByte(']')
+	return nil
+}
+
+// transform decodes the next value, lets fn filter it in place and writes it
+func (s *streamer) transform(fn func(v interface{})) error {
+	value, err := decodeValue(s.dec)
+	if err != nil {
+		return err
+	}
+	fn(value)
+	return encodeValue(s.w, value)
+}
+
+// copy writes the next value unchanged
+func (s *streamer) copy() error {
+	return s.transform(func(interface{}) {})
+}
+
+// copyFrom writes the rest of a value whose first token has already been read
+func (s *streamer) copyFrom(tok json.Token) error {
+	value, err := decodeFrom(s.dec, tok)
+	if err != nil {
+		return err
+	}
+	return encodeValue(s.w, value)
+}